@@ -56,7 +56,23 @@ func Create() *Apu {
 	}
 }
 
-func (a *Apu) WriteByteAt(address uint16, value byte) {
+// PowerOn clears every register https://wiki.nesdev.com/w/index.php/CPU_power_up_state
+func (a *Apu) PowerOn() {
+	*a.Pluse1 = Pluse{}
+	*a.Pluse2 = Pluse{}
+	*a.Triangle = Triangle{}
+	*a.Noise = Noise{}
+	*a.Dmc = Dmc{}
+	a.ChannelEnable = 0
+	a.FrameCounter = 0
+}
+
+// Reset silences every channel, everything else is left as it was
+func (a *Apu) Reset() {
+	a.ChannelEnable = 0
+}
+
+func (a *Apu) WriteByteAt(address uint16, value byte) error {
 	switch {
 	case address >= 0x4000 && address <= 0x4003:
 		a.Pluse1.WriteByteAt(address-0x4000, value)
@@ -73,27 +89,23 @@ func (a *Apu) WriteByteAt(address uint16, value byte) {
 	case address == 0x4017:
 		a.FrameCounter = value
 	default:
-		panic(ErrInvalidAddress)
+		return ErrInvalidAddress
 	}
+
+	return nil
 }
 
-func (a *Apu) ReadByteAt(address uint16) byte {
-	switch {
-	case address >= 0x4000 && address <= 0x4003:
-		return a.Pluse1.ReadByteAt(address - 0x4000)
-	case address >= 0x4004 && address <= 0x4007:
-		return a.Pluse2.ReadByteAt(address - 0x4004)
-	case address >= 0x4008 && address <= 0x400B:
-		return a.Triangle.ReadByteAt(address - 0x4008)
-	case address >= 0x400C && address <= 0x400F:
-		return a.Noise.ReadByteAt(address - 0x400C)
-	case address >= 0x4010 && address <= 0x4013:
-		return a.Dmc.ReadByteAt(address - 0x4010)
-	case address == 0x4015:
-		return a.ChannelEnable
-	case address == 0x4017:
-		return a.FrameCounter
-	default:
-		panic(ErrInvalidAddress)
+func (a *Apu) ReadByteAt(address uint16) (byte, error) {
+	return a.PeekByteAt(address)
+}
+
+// PeekByteAt is ReadByteAt without any side effects, there aren't any until
+// reading $4015 acknowledges the frame IRQ. Only $4015 drives the data bus,
+// the rest are write only and read as open bus.
+func (a *Apu) PeekByteAt(address uint16) (byte, error) {
+	if address == 0x4015 {
+		return a.ChannelEnable, nil
 	}
+
+	return 0, ErrInvalidAddress
 }
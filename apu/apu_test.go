@@ -18,7 +18,20 @@ func TestApuReadWrites(t *testing.T) {
 			continue
 		}
 
-		a.WriteByteAt(i, 0x02)
-		assert.Equalf(t, byte(0x02), a.ReadByteAt(uint16(i)), "%02X", i)
+		assert.NoError(t, a.WriteByteAt(i, 0x02))
+		value, err := a.ReadByteAt(i)
+		// Only the status can be read back, the rest are write only
+		if i == 0x4015 {
+			assert.NoError(t, err)
+			assert.Equal(t, byte(0x02), value)
+		} else {
+			assert.Equalf(t, apu.ErrInvalidAddress, err, "%02X", i)
+		}
 	}
+	assert.Equal(t, byte(0x02), a.Pluse1.ReadByteAt(0))
+	assert.Equal(t, byte(0x02), a.FrameCounter)
+
+	assert.Equal(t, apu.ErrInvalidAddress, a.WriteByteAt(0x4014, 0))
+	_, err := a.ReadByteAt(0x4016)
+	assert.Equal(t, apu.ErrInvalidAddress, err)
 }
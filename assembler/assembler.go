@@ -0,0 +1,757 @@
+package assembler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/disassembler"
+)
+
+var (
+	ErrSyntax             = fmt.Errorf("syntax error")
+	ErrUnknownInstruction = fmt.Errorf("unknown instruction")
+	ErrInvalidAddressMode = fmt.Errorf("invalid address mode")
+	ErrUndefinedSymbol    = fmt.Errorf("undefined symbol")
+	ErrDuplicateSymbol    = fmt.Errorf("duplicate symbol")
+	ErrOutOfRange         = fmt.Errorf("value out of range")
+)
+
+// aliases are other names assemblers use for the undocumented instructions
+var aliases = map[string]string{
+	"SAX": "AAX",
+	"ISB": "ISC",
+	"INS": "ISC",
+	"DCM": "DCP",
+	"ASR": "ALR",
+	"SBX": "AXS",
+	"ANE": "XAA",
+	"AHX": "SHA",
+	"LSE": "SRE",
+	"ASO": "SLO",
+}
+
+// encodings maps mnemonic then address mode to an opcode
+type encodings map[string]map[cpu.AddressMode]byte
+
+// createEncodings prefers documented opcodes, then the lowest opcode, when
+// more than one does the same thing
+func createEncodings(variant cpu.Variant) encodings {
+	d := disassembler.Create(variant)
+	operations := cpu.GetVariantOpcodes(variant)
+
+	opcodes := make([]int, 0, len(operations))
+	for opcode := range operations {
+		opcodes = append(opcodes, int(opcode))
+	}
+	sort.Ints(opcodes)
+
+	result := encodings{}
+	unofficial := map[string]map[cpu.AddressMode]bool{}
+	for _, opcode := range opcodes {
+		inst := d.DisassembleBytes([]byte{byte(opcode), 0, 0}, 0)[0]
+
+		modes, ok := result[inst.Mnemonic]
+		if !ok {
+			modes = map[cpu.AddressMode]byte{}
+			result[inst.Mnemonic] = modes
+			unofficial[inst.Mnemonic] = map[cpu.AddressMode]bool{}
+		}
+
+		if _, ok := modes[inst.Mode]; ok && (inst.Unofficial || !unofficial[inst.Mnemonic][inst.Mode]) {
+			continue
+		}
+		modes[inst.Mode] = byte(opcode)
+		unofficial[inst.Mnemonic][inst.Mode] = inst.Unofficial
+	}
+
+	return result
+}
+
+type Segment struct {
+	// Bank is the 16KB PRG bank picked with .bank, -1 when there wasn't one
+	Bank   int
+	Origin uint16
+	Data   []byte
+}
+
+func (s *Segment) End() int {
+	return int(s.Origin) + len(s.Data)
+}
+
+type Program struct {
+	Segments []*Segment
+	Symbols  map[string]uint16
+}
+
+// Bytes lays every segment out from the lowest origin to the highest end,
+// gaps are zero. Banks are ignored.
+func (p *Program) Bytes() []byte {
+	if len(p.Segments) == 0 {
+		return []byte{}
+	}
+
+	start, end := 0x10000, 0
+	for _, segment := range p.Segments {
+		if len(segment.Data) == 0 {
+			continue
+		}
+		if int(segment.Origin) < start {
+			start = int(segment.Origin)
+		}
+		if segment.End() > end {
+			end = segment.End()
+		}
+	}
+	if end <= start {
+		return []byte{}
+	}
+
+	result := make([]byte, end-start)
+	for _, segment := range p.Segments {
+		if len(segment.Data) == 0 {
+			continue
+		}
+		copy(result[int(segment.Origin)-start:], segment.Data)
+	}
+
+	return result
+}
+
+type Assembler struct {
+	// Dir is where .incbin looks for relative paths
+	Dir string
+	// ReadFile loads .incbin files, os.ReadFile when nil
+	ReadFile func(name string) ([]byte, error)
+
+	variant cpu.Variant
+}
+
+func Create(variant cpu.Variant) *Assembler {
+	return &Assembler{
+		variant: variant,
+	}
+}
+
+// Assemble assembles 2A03 source
+func Assemble(source string) (*Program, error) {
+	return Create(cpu.Variant2A03).Assemble(source)
+}
+
+// AssembleFile assembles the file with .incbin relative to it
+func AssembleFile(path string) (*Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := Create(cpu.Variant2A03)
+	a.Dir = filepath.Dir(path)
+	return a.Assemble(string(source))
+}
+
+// pass is the state of one trip through the source. The first pass finds
+// where every label is, the second emits the bytes using the sizes the first
+// pass settled on so the labels don't move.
+type pass struct {
+	assembler *Assembler
+	final     bool
+	encodings encodings
+	symbols   map[string]int
+	defined   map[string]bool
+	// modes is the address mode picked for each line in the first pass
+	modes    map[int]cpu.AddressMode
+	scope    string
+	pc       int
+	segment  *Segment
+	segments []*Segment
+	line     int
+}
+
+func (a *Assembler) Assemble(source string) (*Program, error) {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	first := &pass{
+		assembler: a,
+		encodings: createEncodings(a.variant),
+		symbols:   map[string]int{},
+		defined:   map[string]bool{},
+		modes:     map[int]cpu.AddressMode{},
+	}
+	if err := first.run(lines); err != nil {
+		return nil, err
+	}
+
+	second := &pass{
+		assembler: a,
+		final:     true,
+		encodings: createEncodings(a.variant),
+		symbols:   first.symbols,
+		defined:   map[string]bool{},
+		modes:     first.modes,
+	}
+	if err := second.run(lines); err != nil {
+		return nil, err
+	}
+
+	result := &Program{
+		Segments: second.segments,
+		Symbols:  make(map[string]uint16, len(second.symbols)),
+	}
+	for name, value := range second.symbols {
+		result.Symbols[name] = uint16(value)
+	}
+
+	return result, nil
+}
+
+func (p *pass) errorf(err error, format string, args ...interface{}) error {
+	return errors.Wrapf(err, "line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *pass) run(lines []string) error {
+	p.startSegment(-1, 0)
+
+	for i, line := range lines {
+		p.line = i + 1
+		if err := p.assembleLine(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *pass) startSegment(bank int, origin int) {
+	p.pc = origin
+	p.segment = &Segment{
+		Bank:   bank,
+		Origin: uint16(origin),
+	}
+	p.segments = append(p.segments, p.segment)
+}
+
+// symbolName puts local labels in the scope of the last global label
+func (p *pass) symbolName(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return p.scope + name
+	}
+	return name
+}
+
+func (p *pass) resolve(name string) (int, bool) {
+	value, ok := p.symbols[p.symbolName(name)]
+	return value, ok
+}
+
+// evaluate fails on undefined symbols in the final pass
+func (p *pass) evaluate(text string) (int, bool, error) {
+	value, known, err := evaluate(text, p.pc, p.resolve)
+	if err != nil {
+		return 0, false, p.errorf(err, "%s", text)
+	}
+	if !known && p.final {
+		return 0, false, p.errorf(ErrUndefinedSymbol, "%s", text)
+	}
+	return value, known, nil
+}
+
+func (p *pass) define(name string, value int) error {
+	name = p.symbolName(name)
+	if p.defined[name] {
+		return p.errorf(ErrDuplicateSymbol, "%s", name)
+	}
+	p.defined[name] = true
+	p.symbols[name] = value
+	return nil
+}
+
+func (p *pass) emit(data ...byte) {
+	p.segment.Data = append(p.segment.Data, data...)
+	p.pc += len(data)
+}
+
+// stripComment removes everything after a ; that isn't in quotes
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"':
+			quote = c
+		case c == '\'' && i+2 < len(line) && line[i+2] == '\'':
+			i += 2
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitArguments splits on commas outside of quotes and brackets
+func splitArguments(text string) []string {
+	result := []string{}
+	depth := 0
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			result = append(result, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(result, strings.TrimSpace(text[start:]))
+}
+
+func splitWord(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i+1:])
+	}
+	return text, ""
+}
+
+func (p *pass) assembleLine(line string) error {
+	line = strings.TrimSpace(stripComment(line))
+
+	// Labels
+	for {
+		i := strings.Index(line, ":")
+		if i <= 0 || !validSymbol(line[:i]) {
+			break
+		}
+
+		name := line[:i]
+		if !strings.HasPrefix(name, "@") {
+			p.scope = name
+		}
+		if err := p.define(name, p.pc); err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line[i+1:])
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	// Constants
+	if i := strings.Index(line, "="); i > 0 && validSymbol(strings.TrimSpace(line[:i])) {
+		name := strings.TrimSpace(line[:i])
+		value, known, err := p.evaluate(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return err
+		}
+		// Left undefined so it isn't taken for zero page in the first pass
+		if !known {
+			p.defined[p.symbolName(name)] = true
+			return nil
+		}
+		return p.define(name, value)
+	}
+
+	word, rest := splitWord(line)
+	if strings.HasPrefix(word, ".") {
+		return p.directive(strings.ToLower(word), rest)
+	}
+
+	return p.instruction(strings.ToUpper(word), rest)
+}
+
+func validSymbol(name string) bool {
+	if name == "" || !isSymbolStart(name[0]) || name[0] == '.' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isSymbolChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pass) known(text string) (int, error) {
+	value, known, err := p.evaluate(text)
+	if err != nil {
+		return 0, err
+	}
+	if !known {
+		return 0, p.errorf(ErrUndefinedSymbol, "%s must be defined before it's used here", text)
+	}
+	return value, nil
+}
+
+func unquote(text string) (string, bool) {
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		return text[1 : len(text)-1], true
+	}
+	return "", false
+}
+
+func (p *pass) directive(name, rest string) error {
+	args := splitArguments(rest)
+
+	switch name {
+	case ".org":
+		origin, err := p.known(rest)
+		if err != nil {
+			return err
+		}
+		if origin < 0 || origin > 0xFFFF {
+			return p.errorf(ErrOutOfRange, ".org %s", rest)
+		}
+		p.startSegment(p.segment.Bank, origin)
+
+	case ".bank":
+		bank, err := p.known(rest)
+		if err != nil {
+			return err
+		}
+		p.startSegment(bank, p.pc)
+
+	case ".byte", ".db":
+		for _, arg := range args {
+			if text, ok := unquote(arg); ok {
+				p.emit([]byte(text)...)
+				continue
+			}
+
+			value, _, err := p.evaluate(arg)
+			if err != nil {
+				return err
+			}
+			if p.final && (value < -0x80 || value > 0xFF) {
+				return p.errorf(ErrOutOfRange, "%s", arg)
+			}
+			p.emit(byte(value))
+		}
+
+	case ".word", ".dw":
+		for _, arg := range args {
+			value, _, err := p.evaluate(arg)
+			if err != nil {
+				return err
+			}
+			if p.final && (value < -0x8000 || value > 0xFFFF) {
+				return p.errorf(ErrOutOfRange, "%s", arg)
+			}
+			p.emit(byte(value), byte(value>>8))
+		}
+
+	case ".res", ".align":
+		count, err := p.known(args[0])
+		if err != nil {
+			return err
+		}
+		if name == ".align" {
+			if count <= 0 {
+				return p.errorf(ErrOutOfRange, ".align %s", rest)
+			}
+			count = (count - p.pc%count) % count
+		}
+
+		fill := 0
+		if len(args) > 1 {
+			if fill, _, err = p.evaluate(args[1]); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < count; i++ {
+			p.emit(byte(fill))
+		}
+
+	case ".incbin":
+		return p.incbin(args)
+
+	case ".setcpu":
+		cpuName, _ := unquote(rest)
+		switch strings.ToUpper(cpuName) {
+		case "6502", "6502X":
+			p.encodings = createEncodings(cpu.Variant2A03)
+		case "65C02":
+			p.encodings = createEncodings(cpu.Variant65C02)
+		default:
+			return p.errorf(ErrSyntax, "unknown cpu %s", rest)
+		}
+
+	default:
+		return p.errorf(ErrSyntax, "unknown directive %s", name)
+	}
+
+	return nil
+}
+
+func (p *pass) incbin(args []string) error {
+	path, ok := unquote(args[0])
+	if !ok {
+		return p.errorf(ErrSyntax, ".incbin needs a quoted file name")
+	}
+	if !filepath.IsAbs(path) && p.assembler.Dir != "" {
+		path = filepath.Join(p.assembler.Dir, path)
+	}
+
+	readFile := p.assembler.ReadFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	data, err := readFile(path)
+	if err != nil {
+		return p.errorf(err, ".incbin %s", path)
+	}
+
+	start, length := 0, len(data)
+	if len(args) > 1 {
+		if start, err = p.known(args[1]); err != nil {
+			return err
+		}
+		length = len(data) - start
+	}
+	if len(args) > 2 {
+		if length, err = p.known(args[2]); err != nil {
+			return err
+		}
+	}
+	if start < 0 || length < 0 || start+length > len(data) {
+		return p.errorf(ErrOutOfRange, ".incbin %s", path)
+	}
+
+	p.emit(data[start : start+length]...)
+	return nil
+}
+
+// operandForm is the shape of an operand before zero page or absolute has
+// been picked
+type operandForm int
+
+const (
+	formNone operandForm = iota
+	formImmediate
+	formAddress
+	formX
+	formY
+	formIndirect
+	formIndirectX
+	formIndirectY
+)
+
+func hasSuffix(text, suffix string) bool {
+	return strings.HasSuffix(strings.ToUpper(strings.ReplaceAll(text, " ", "")), suffix)
+}
+
+// trimSuffix cuts the index register off the end whatever the spacing
+func trimSuffix(text string, length int) string {
+	count := 0
+	for i := len(text) - 1; i >= 0; i-- {
+		if text[i] == ' ' || text[i] == '\t' {
+			continue
+		}
+		count++
+		if count == length {
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return ""
+}
+
+// wrapped is true when the opening bracket closes at the very end
+func wrapped(text string) bool {
+	if !strings.HasPrefix(text, "(") || !strings.HasSuffix(text, ")") {
+		return false
+	}
+
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i == len(text)-1
+			}
+		}
+	}
+	return false
+}
+
+func parseOperand(operand string, modes map[cpu.AddressMode]byte) (operandForm, string) {
+	switch {
+	case operand == "":
+		return formNone, ""
+	case strings.EqualFold(operand, "A"):
+		if _, ok := modes[cpu.AddressModeAccumulator]; ok {
+			return formNone, ""
+		}
+	case strings.HasPrefix(operand, "#"):
+		return formImmediate, strings.TrimSpace(operand[1:])
+	}
+
+	if strings.HasPrefix(operand, "(") {
+		switch {
+		case hasSuffix(operand, ",X)"):
+			return formIndirectX, strings.TrimSpace(trimSuffix(operand, 3)[1:])
+		case hasSuffix(operand, "),Y"):
+			inner := trimSuffix(operand, 2)
+			if wrapped(inner) {
+				return formIndirectY, strings.TrimSpace(inner[1 : len(inner)-1])
+			}
+		case wrapped(operand):
+			_, indirect := modes[cpu.AddressModeIndirect]
+			_, zeroPageIndirect := modes[cpu.AddressModeZeroPageIndirect]
+			if indirect || zeroPageIndirect {
+				return formIndirect, strings.TrimSpace(operand[1 : len(operand)-1])
+			}
+		}
+	}
+
+	switch {
+	case hasSuffix(operand, ",X"):
+		return formX, trimSuffix(operand, 2)
+	case hasSuffix(operand, ",Y"):
+		return formY, trimSuffix(operand, 2)
+	}
+
+	return formAddress, operand
+}
+
+// sizePrefix handles ca65's a: and z: to force absolute or zero page
+func sizePrefix(text string) (string, string) {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(lower, "a:"):
+		return "a", text[2:]
+	case strings.HasPrefix(lower, "z:"):
+		return "z", text[2:]
+	}
+	return "", text
+}
+
+// pickMode chooses between the zero page and absolute versions. Anything
+// not known in the first pass is assumed to need two bytes.
+func (p *pass) pickMode(modes map[cpu.AddressMode]byte, zeroPage, absolute cpu.AddressMode, force string, value int, known bool) (cpu.AddressMode, bool) {
+	if mode, ok := p.modes[p.line]; p.final && ok {
+		return mode, true
+	}
+
+	_, hasZeroPage := modes[zeroPage]
+	_, hasAbsolute := modes[absolute]
+
+	useZeroPage := hasZeroPage && (force == "z" || (force == "" && known && value >= 0 && value < 0x100))
+	if !hasAbsolute && hasZeroPage && force != "a" {
+		useZeroPage = true
+	}
+
+	mode := absolute
+	if useZeroPage {
+		mode = zeroPage
+	}
+	if _, ok := modes[mode]; !ok {
+		return 0, false
+	}
+
+	p.modes[p.line] = mode
+	return mode, true
+}
+
+func (p *pass) instruction(mnemonic, operand string) error {
+	if alias, ok := aliases[mnemonic]; ok {
+		if _, ok := p.encodings[mnemonic]; !ok {
+			mnemonic = alias
+		}
+	}
+
+	modes, ok := p.encodings[mnemonic]
+	if !ok {
+		return p.errorf(ErrUnknownInstruction, "%s", mnemonic)
+	}
+
+	form, text := parseOperand(operand, modes)
+	force, text := sizePrefix(text)
+
+	var value int
+	known := true
+	if form != formNone {
+		var err error
+		if value, known, err = p.evaluate(text); err != nil {
+			return err
+		}
+	}
+
+	var mode cpu.AddressMode
+	found := true
+	switch form {
+	case formNone:
+		mode = cpu.AddressModeImplied
+		if _, ok := modes[cpu.AddressModeAccumulator]; ok {
+			mode = cpu.AddressModeAccumulator
+		}
+	case formImmediate:
+		mode = cpu.AddressModeImmediate
+	case formAddress:
+		if _, ok := modes[cpu.AddressModeRelative]; ok {
+			mode = cpu.AddressModeRelative
+		} else {
+			mode, found = p.pickMode(modes, cpu.AddressModeZeroPage, cpu.AddressModeAbsolute, force, value, known)
+		}
+	case formX:
+		mode, found = p.pickMode(modes, cpu.AddressModeZeroPageX, cpu.AddressModeAbsoluteX, force, value, known)
+	case formY:
+		mode, found = p.pickMode(modes, cpu.AddressModeZeroPageY, cpu.AddressModeAbsoluteY, force, value, known)
+	case formIndirect:
+		mode, found = p.pickMode(modes, cpu.AddressModeZeroPageIndirect, cpu.AddressModeIndirect, force, value, known)
+	case formIndirectX:
+		mode, found = p.pickMode(modes, cpu.AddressModeIndirectX, cpu.AddressModeAbsoluteIndirectX, force, value, known)
+	case formIndirectY:
+		mode = cpu.AddressModeIndirectY
+	}
+
+	opcode, ok := modes[mode]
+	if !found || !ok {
+		return p.errorf(ErrInvalidAddressMode, "%s %s", mnemonic, operand)
+	}
+
+	switch mode.OperandLength() {
+	case 0:
+		p.emit(opcode)
+
+	case 1:
+		if mode == cpu.AddressModeRelative {
+			offset := value - (p.pc + 2)
+			if p.final && (offset < -128 || offset > 127) {
+				return p.errorf(ErrOutOfRange, "branch to %s is %d bytes away", operand, offset)
+			}
+			value = offset
+		} else if p.final && (value < -0x80 || value > 0xFF) {
+			return p.errorf(ErrOutOfRange, "%s %s", mnemonic, operand)
+		}
+		p.emit(opcode, byte(value))
+
+	case 2:
+		if p.final && (value < 0 || value > 0xFFFF) {
+			return p.errorf(ErrOutOfRange, "%s %s", mnemonic, operand)
+		}
+		p.emit(opcode, byte(value), byte(value>>8))
+	}
+
+	return nil
+}
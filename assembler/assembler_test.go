@@ -0,0 +1,234 @@
+package assembler_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/assembler"
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/disassembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func assemble(t *testing.T, source string) []byte {
+	program, err := assembler.Assemble(source)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	return program.Bytes()
+}
+
+func TestAddressModes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		source   string
+		expected []byte
+	}{
+		{"LDA #$10", []byte{0xA9, 0x10}},
+		{"lda #16", []byte{0xA9, 0x10}},
+		{"LDA $10", []byte{0xA5, 0x10}},
+		{"LDA $10,X", []byte{0xB5, 0x10}},
+		{"LDX $10,Y", []byte{0xB6, 0x10}},
+		{"LDA $1234", []byte{0xAD, 0x34, 0x12}},
+		{"LDA $0010", []byte{0xA5, 0x10}},
+		{"LDA a:$10", []byte{0xAD, 0x10, 0x00}},
+		{"LDA $1234,X", []byte{0xBD, 0x34, 0x12}},
+		{"LDA $1234, Y", []byte{0xB9, 0x34, 0x12}},
+		{"LDA $10,Y", []byte{0xB9, 0x10, 0x00}},
+		{"STX $10,Y", []byte{0x96, 0x10}},
+		{"LDA ($10,X)", []byte{0xA1, 0x10}},
+		{"LDA ($10),Y", []byte{0xB1, 0x10}},
+		{"JMP ($1234)", []byte{0x6C, 0x34, 0x12}},
+		{"JMP $1234", []byte{0x4C, 0x34, 0x12}},
+		{"ASL", []byte{0x0A}},
+		{"ASL A", []byte{0x0A}},
+		{"ROR a", []byte{0x6A}},
+		{"NOP", []byte{0xEA}},
+		{"SBC #1", []byte{0xE9, 0x01}},
+		{"BRK", []byte{0x00}},
+		{"LAX $10", []byte{0xA7, 0x10}},
+		{"SAX $10", []byte{0x87, 0x10}},
+		{"LDA #<$1234", []byte{0xA9, 0x34}},
+		{"LDA #>$1234", []byte{0xA9, 0x12}},
+		{"LDA #%1010", []byte{0xA9, 0x0A}},
+		{"LDA #'A'", []byte{0xA9, 0x41}},
+		{"LDA ($10+2)*2", []byte{0xA5, 0x24}},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, assemble(t, test.source), test.source)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Assemble(`
+		.org $8000
+	temp = $10
+	reset:
+		LDX #0          ; comment
+	@loop:
+		STA temp,X
+		INX
+		BNE @loop
+		JMP next
+	next:
+	@loop:  DEX
+		BPL @loop
+		LDA forward     ; forward references are absolute
+		RTS
+	forward = $20
+	`)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []byte{
+		0xA2, 0x00,
+		0x95, 0x10,
+		0xE8,
+		0xD0, 0xFB,
+		0x4C, 0x0A, 0x80,
+		0xCA,
+		0x10, 0xFD,
+		0xAD, 0x20, 0x00,
+		0x60,
+	}, program.Bytes())
+	assert.Equal(t, uint16(0x8000), program.Symbols["reset"])
+	assert.Equal(t, uint16(0x8002), program.Symbols["reset@loop"])
+	assert.Equal(t, uint16(0x800A), program.Symbols["next@loop"])
+}
+
+func TestDirectives(t *testing.T) {
+	t.Parallel()
+
+	a := assembler.Create(cpu.Variant2A03)
+	a.ReadFile = func(name string) ([]byte, error) {
+		if name != "chr/tiles.bin" {
+			return nil, fmt.Errorf("missing %s", name)
+		}
+		return []byte{1, 2, 3, 4}, nil
+	}
+	a.Dir = "chr"
+
+	program, err := a.Assemble(`
+		.org $C000
+	start:
+		.byte 1, $02, "AB", <start
+		.word start, $1234
+		.res 3, $EA
+		.align 16
+		.incbin "tiles.bin", 1, 2
+		.db *-start
+	`)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x01, 0x02, 'A', 'B', 0x00,
+		0x00, 0xC0, 0x34, 0x12,
+		0xEA, 0xEA, 0xEA,
+		0x00, 0x00, 0x00, 0x00,
+		0x02, 0x03,
+		0x12,
+	}, program.Bytes())
+}
+
+func TestSegments(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Assemble(`
+		.org $0004
+		.byte 4
+		.org $0000
+		.byte 0
+	`)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 4}, program.Bytes())
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		source   string
+		expected error
+	}{
+		{"FOO #1", assembler.ErrUnknownInstruction},
+		{"LDA missing", assembler.ErrUndefinedSymbol},
+		{"STA #1", assembler.ErrInvalidAddressMode},
+		{"a:\na: NOP", assembler.ErrDuplicateSymbol},
+		{"LDA #$100", assembler.ErrOutOfRange},
+		{"BNE far\n.res 200\nfar:", assembler.ErrOutOfRange},
+		{"LDA #(1", assembler.ErrSyntax},
+		{".bogus", assembler.ErrSyntax},
+	}
+
+	for _, test := range testCases {
+		_, err := assembler.Assemble(test.source)
+		assert.Truef(t, errors.Is(err, test.expected), "%s: %v", test.source, err)
+	}
+
+	_, err := assembler.Assemble("NOP\n\nLDA missing")
+	assert.Contains(t, err.Error(), "line 3")
+}
+
+func TestCmos(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Create(cpu.Variant65C02).Assemble(`
+		.org $8000
+	start:
+		BRA start
+		LDA ($10)
+		JMP ($1234,X)
+		STZ $10
+		INC A
+		NOP
+	`)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x80, 0xFE,
+		0xB2, 0x10,
+		0x7C, 0x34, 0x12,
+		0x64, 0x10,
+		0x1A,
+		0xEA,
+	}, program.Bytes())
+
+	// The undocumented NOPs aren't picked over $EA
+	program, err = assembler.Assemble(".setcpu \"65C02\"\nnop")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xEA}, program.Bytes())
+}
+
+// What the disassembler writes for ca65 assembles back into the same bytes
+func TestDisassemblerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 0, 0x300)
+	for i := 0; i < 0x100; i++ {
+		data = append(data, byte(i), 0x10, 0x80)
+	}
+
+	insts := disassembler.Disassemble(data, 0x8000)
+	f := &disassembler.Formatter{Syntax: disassembler.SyntaxCa65}
+	var buffer bytesBuffer
+	assert.NoError(t, f.Write(&buffer, cpu.Variant2A03, insts))
+
+	program, err := assembler.Assemble(buffer.String())
+	assert.NoError(t, err)
+	assert.Equal(t, data, program.Bytes())
+}
+
+type bytesBuffer struct {
+	data []byte
+}
+
+func (b *bytesBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *bytesBuffer) String() string {
+	return string(b.data)
+}
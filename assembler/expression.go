@@ -0,0 +1,258 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resolver looks up a symbol, ok is false when it isn't defined yet
+type resolver func(name string) (value int, ok bool)
+
+// expression is a recursive descent parser that evaluates as it goes.
+// Precedence from loosest to tightest is | ^ & << >> + - * / % then the
+// unary operators - ~ < (low byte) and > (high byte).
+type expression struct {
+	text    string
+	pos     int
+	pc      int
+	resolve resolver
+	// known is false once an undefined symbol was used
+	known bool
+}
+
+func evaluate(text string, pc int, resolve resolver) (int, bool, error) {
+	e := &expression{
+		text:    text,
+		pc:      pc,
+		resolve: resolve,
+		known:   true,
+	}
+
+	value, err := e.or()
+	if err != nil {
+		return 0, false, err
+	}
+
+	e.skipSpace()
+	if e.pos != len(e.text) {
+		return 0, false, errors.Wrapf(ErrSyntax, "unexpected %q in %q", e.text[e.pos:], text)
+	}
+
+	return value, e.known, nil
+}
+
+func (e *expression) skipSpace() {
+	for e.pos < len(e.text) && (e.text[e.pos] == ' ' || e.text[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+// accept consumes op if it's next
+func (e *expression) accept(op string) bool {
+	e.skipSpace()
+	if strings.HasPrefix(e.text[e.pos:], op) {
+		e.pos += len(op)
+		return true
+	}
+	return false
+}
+
+type binaryOperator struct {
+	op    string
+	apply func(left, right int) (int, error)
+}
+
+func (e *expression) binary(next func() (int, error), operators ...binaryOperator) (int, error) {
+	left, err := next()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		matched := false
+		for _, operator := range operators {
+			if !e.accept(operator.op) {
+				continue
+			}
+
+			right, err := next()
+			if err != nil {
+				return 0, err
+			}
+			if left, err = operator.apply(left, right); err != nil {
+				return 0, err
+			}
+			matched = true
+			break
+		}
+
+		if !matched {
+			return left, nil
+		}
+	}
+}
+
+func (e *expression) or() (int, error) {
+	return e.binary(e.xor, binaryOperator{"|", func(l, r int) (int, error) { return l | r, nil }})
+}
+
+func (e *expression) xor() (int, error) {
+	return e.binary(e.and, binaryOperator{"^", func(l, r int) (int, error) { return l ^ r, nil }})
+}
+
+func (e *expression) and() (int, error) {
+	return e.binary(e.shift, binaryOperator{"&", func(l, r int) (int, error) { return l & r, nil }})
+}
+
+func (e *expression) shift() (int, error) {
+	return e.binary(e.add,
+		binaryOperator{"<<", func(l, r int) (int, error) { return l << uint(r), nil }},
+		binaryOperator{">>", func(l, r int) (int, error) { return l >> uint(r), nil }},
+	)
+}
+
+func (e *expression) add() (int, error) {
+	return e.binary(e.mul,
+		binaryOperator{"+", func(l, r int) (int, error) { return l + r, nil }},
+		binaryOperator{"-", func(l, r int) (int, error) { return l - r, nil }},
+	)
+}
+
+func (e *expression) mul() (int, error) {
+	divide := func(op func(l, r int) int) func(l, r int) (int, error) {
+		return func(l, r int) (int, error) {
+			if r == 0 {
+				// An unknown symbol in the first pass is zero
+				if !e.known {
+					return 0, nil
+				}
+				return 0, errors.Wrapf(ErrSyntax, "divide by zero in %q", e.text)
+			}
+			return op(l, r), nil
+		}
+	}
+
+	return e.binary(e.unary,
+		binaryOperator{"*", func(l, r int) (int, error) { return l * r, nil }},
+		binaryOperator{"/", divide(func(l, r int) int { return l / r })},
+		binaryOperator{"%", divide(func(l, r int) int { return l % r })},
+	)
+}
+
+func (e *expression) unary() (int, error) {
+	e.skipSpace()
+	if e.pos >= len(e.text) {
+		return 0, errors.Wrapf(ErrSyntax, "missing value in %q", e.text)
+	}
+
+	var apply func(int) int
+	switch e.text[e.pos] {
+	case '-':
+		apply = func(v int) int { return -v }
+	case '+':
+		apply = func(v int) int { return v }
+	case '~':
+		apply = func(v int) int { return ^v }
+	case '<':
+		apply = func(v int) int { return v & 0xFF }
+	case '>':
+		apply = func(v int) int { return (v >> 8) & 0xFF }
+	default:
+		return e.primary()
+	}
+
+	e.pos++
+	value, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	return apply(value), nil
+}
+
+func isSymbolStart(c byte) bool {
+	return c == '_' || c == '@' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSymbolChar(c byte) bool {
+	return isSymbolStart(c) || (c >= '0' && c <= '9')
+}
+
+func (e *expression) number(start int, base int, valid func(byte) bool) (int, error) {
+	for e.pos < len(e.text) && valid(e.text[e.pos]) {
+		e.pos++
+	}
+
+	value, err := strconv.ParseInt(e.text[start:e.pos], base, 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrSyntax, "bad number %q", e.text[start:e.pos])
+	}
+	return int(value), nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isDecimal(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isBinary(c byte) bool {
+	return c == '0' || c == '1'
+}
+
+func (e *expression) primary() (int, error) {
+	c := e.text[e.pos]
+
+	switch {
+	case c == '(':
+		e.pos++
+		value, err := e.or()
+		if err != nil {
+			return 0, err
+		}
+		if !e.accept(")") {
+			return 0, errors.Wrapf(ErrSyntax, "missing ) in %q", e.text)
+		}
+		return value, nil
+
+	case c == '$':
+		e.pos++
+		return e.number(e.pos, 16, isHex)
+
+	case c == '%':
+		e.pos++
+		return e.number(e.pos, 2, isBinary)
+
+	case isDecimal(c):
+		return e.number(e.pos, 10, isDecimal)
+
+	case c == '\'':
+		if e.pos+2 >= len(e.text) || e.text[e.pos+2] != '\'' {
+			return 0, errors.Wrapf(ErrSyntax, "bad character in %q", e.text)
+		}
+		value := int(e.text[e.pos+1])
+		e.pos += 3
+		return value, nil
+
+	case c == '*':
+		e.pos++
+		return e.pc, nil
+
+	case isSymbolStart(c):
+		start := e.pos
+		for e.pos < len(e.text) && isSymbolChar(e.text[e.pos]) {
+			e.pos++
+		}
+
+		value, ok := e.resolve(e.text[start:e.pos])
+		if !ok {
+			e.known = false
+		}
+		return value, nil
+	}
+
+	return 0, errors.Wrapf(ErrSyntax, "unexpected %q in %q", e.text[e.pos:], e.text)
+}
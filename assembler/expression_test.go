@@ -0,0 +1,60 @@
+package assembler_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/assembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		expression string
+		expected   uint16
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 2 - 3", 5},
+		{"$FF & %1010", 0x0A},
+		{"$F0 | $0F", 0xFF},
+		{"$FF ^ $0F", 0xF0},
+		{"1 << 4 + 1", 0x20},
+		{"$100 >> 4", 0x10},
+		{"17 / 5", 3},
+		{"17 % 5", 2},
+		{"-1", 0xFFFF},
+		{"~0 & $FF", 0xFF},
+		{"<$1234", 0x34},
+		{">$1234", 0x12},
+		{"'a'", 0x61},
+		{"base + 2", 0x8002},
+		{"*", 0x8000},
+	}
+
+	for _, test := range testCases {
+		program, err := assembler.Assemble(".org $8000\nbase:\nvalue = " + test.expression)
+		if assert.NoError(t, err, test.expression) {
+			assert.Equal(t, test.expected, program.Symbols["value"], test.expression)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []string{
+		"1 +",
+		"(1",
+		"1 / 0",
+		"$",
+		"1 2",
+	}
+
+	for _, test := range testCases {
+		_, err := assembler.Assemble("value = " + test)
+		assert.Truef(t, errors.Is(err, assembler.ErrSyntax), "%s: %v", test, err)
+	}
+}
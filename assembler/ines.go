@@ -0,0 +1,78 @@
+package assembler
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	prgBankSize = 0x4000
+	chrBankSize = 0x2000
+)
+
+// INes describes the cart around the assembled PRG
+type INes struct {
+	// PrgBanks is the number of 16KB banks, at least 1
+	PrgBanks int
+	Chr      []byte
+	Mapper   byte
+	// VerticalMirroring is for horizontal scrolling games
+	VerticalMirroring bool
+	Battery           bool
+}
+
+// INes builds a complete .nes file. Segments with a .bank land in that 16KB
+// bank at the offset of their origin in it, the rest are placed in the last
+// banks by address so $C000-$FFFF is always the last bank. Unused PRG is
+// $FF.
+func (p *Program) INes(header INes) ([]byte, error) {
+	if header.PrgBanks < 1 || header.PrgBanks > 0xFF {
+		return nil, errors.Wrapf(ErrOutOfRange, "%d PRG banks", header.PrgBanks)
+	}
+	chrBanks := (len(header.Chr) + chrBankSize - 1) / chrBankSize
+	if chrBanks > 0xFF {
+		return nil, errors.Wrapf(ErrOutOfRange, "%d CHR banks", chrBanks)
+	}
+
+	prg := make([]byte, header.PrgBanks*prgBankSize)
+	for i := range prg {
+		prg[i] = 0xFF
+	}
+
+	for _, segment := range p.Segments {
+		if len(segment.Data) == 0 {
+			continue
+		}
+
+		var offset int
+		if segment.Bank >= 0 {
+			offset = segment.Bank*prgBankSize + int(segment.Origin)%prgBankSize
+		} else {
+			if segment.Origin < 0x8000 {
+				return nil, errors.Wrapf(ErrOutOfRange, "segment at $%04X is outside PRG", segment.Origin)
+			}
+			offset = len(prg) - (0x10000 - int(segment.Origin))
+		}
+
+		if offset < 0 || offset+len(segment.Data) > len(prg) {
+			return nil, errors.Wrapf(ErrOutOfRange, "segment at $%04X doesn't fit in %d PRG banks", segment.Origin, header.PrgBanks)
+		}
+		copy(prg[offset:], segment.Data)
+	}
+
+	flags6 := (header.Mapper & 0x0F) << 4
+	if header.VerticalMirroring {
+		flags6 |= 0x01
+	}
+	if header.Battery {
+		flags6 |= 0x02
+	}
+	flags7 := header.Mapper & 0xF0
+
+	result := []byte{'N', 'E', 'S', 0x1A, byte(header.PrgBanks), byte(chrBanks), flags6, flags7}
+	result = append(result, make([]byte, 8)...)
+	result = append(result, prg...)
+	result = append(result, header.Chr...)
+	result = append(result, make([]byte, chrBanks*chrBankSize-len(header.Chr))...)
+
+	return result, nil
+}
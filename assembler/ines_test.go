@@ -0,0 +1,85 @@
+package assembler_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/assembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestINes(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Assemble(`
+		.org $C000
+	reset:
+		JMP reset
+		.org $FFFA
+		.word reset, reset, reset
+	`)
+	assert.NoError(t, err)
+
+	rom, err := program.INes(assembler.INes{
+		PrgBanks:          1,
+		Chr:               []byte{1, 2},
+		Mapper:            0x12,
+		VerticalMirroring: true,
+		Battery:           true,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 16+0x4000+0x2000, len(rom))
+	assert.Equal(t, []byte{'N', 'E', 'S', 0x1A, 1, 1, 0x23, 0x10}, rom[:8])
+
+	prg := rom[16 : 16+0x4000]
+	assert.Equal(t, []byte{0x4C, 0x00, 0xC0}, prg[:3])
+	assert.Equal(t, byte(0xFF), prg[3])
+	assert.Equal(t, []byte{0x00, 0xC0, 0x00, 0xC0, 0x00, 0xC0}, prg[0x3FFA:])
+
+	chr := rom[16+0x4000:]
+	assert.Equal(t, []byte{1, 2, 0}, chr[:3])
+}
+
+func TestINesBanks(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Assemble(`
+		.bank 0
+		.org $8000
+		.byte 1
+		.bank 1
+		.org $8000
+		.byte 2
+		.org $FFFC
+		.word $8000
+	`)
+	assert.NoError(t, err)
+
+	rom, err := program.INes(assembler.INes{PrgBanks: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0), rom[5])
+
+	prg := rom[16:]
+	assert.Equal(t, 0x8000, len(prg))
+	assert.Equal(t, byte(1), prg[0])
+	assert.Equal(t, byte(2), prg[0x4000])
+	assert.Equal(t, []byte{0x00, 0x80}, prg[0x7FFC:0x7FFE])
+}
+
+func TestINesErrors(t *testing.T) {
+	t.Parallel()
+
+	program, err := assembler.Assemble(".org $0200\n.byte 1")
+	assert.NoError(t, err)
+	_, err = program.INes(assembler.INes{PrgBanks: 1})
+	assert.True(t, errors.Is(err, assembler.ErrOutOfRange))
+
+	program, err = assembler.Assemble(".org $8000\n.byte 1")
+	assert.NoError(t, err)
+	_, err = program.INes(assembler.INes{PrgBanks: 1})
+	assert.True(t, errors.Is(err, assembler.ErrOutOfRange))
+
+	_, err = program.INes(assembler.INes{PrgBanks: 0})
+	assert.True(t, errors.Is(err, assembler.ErrOutOfRange))
+}
@@ -0,0 +1,257 @@
+package cdl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/memory"
+)
+
+// The FCEUX code/data log, one byte of flags per PRG byte followed by one per
+// CHR byte http://fceux.com/web/help/CodeDataLogger.html
+const (
+	// PRG flags xPdcAADC
+	PrgCode         byte = 0x01
+	PrgData         byte = 0x02
+	PrgBankMask     byte = 0x0C
+	PrgIndirectCode byte = 0x10
+	PrgIndirectData byte = 0x20
+	PrgPcm          byte = 0x40
+
+	// CHR flags xxxxxxRD, $2007 reads aren't done by the PPU so only
+	// rendering is logged
+	ChrRendered byte = 0x01
+)
+
+var (
+	ErrSizeMismatch = fmt.Errorf("cdl size doesn't match the rom")
+	ErrNotRomMapper = fmt.Errorf("cart can't map addresses to rom offsets")
+)
+
+// Logger records how every ROM byte was used. Offsets are into the ROM so
+// bank switching doesn't mix banks up.
+type Logger struct {
+	Prg []byte
+	Chr []byte
+
+	cpu    *cpu.Cpu
+	memory *memory.Memory
+	mapper memory.RomMapper
+	hooks  []cpu.Hook
+	rts    *cpu.Operation
+	rti    *cpu.Operation
+	read   memory.Hook
+	chr    memory.Hook
+
+	// The instruction being run, reads before its opcode is fetched are
+	// peeks by tracers and hooks
+	executing bool
+	fetched   bool
+	pc        uint16
+	length    uint16
+	readsData bool
+	indirect  bool
+	// jumped is set when the next instruction was reached through an
+	// address read from memory
+	jumped bool
+}
+
+func Create(prgSize, chrSize int) *Logger {
+	return &Logger{
+		Prg: make([]byte, prgSize),
+		Chr: make([]byte, chrSize),
+	}
+}
+
+// prgBank is where in CPU space the byte was mapped, FCEUX's AA bits
+func prgBank(address uint16) byte {
+	return byte(address>>13) & 0x03 << 2
+}
+
+func (l *Logger) logPrg(address uint16, flags byte) {
+	offset := l.mapper.PrgOffset(address)
+	if offset < 0 || offset >= len(l.Prg) {
+		return
+	}
+	l.Prg[offset] = l.Prg[offset]&^PrgBankMask | flags | prgBank(address)
+}
+
+// LogChr marks the CHR byte the PPU address is mapped to
+func (l *Logger) LogChr(address uint16, flags byte) {
+	if l.mapper == nil {
+		return
+	}
+
+	offset := l.mapper.ChrOffset(address)
+	if offset < 0 || offset >= len(l.Chr) {
+		return
+	}
+	l.Chr[offset] |= flags
+}
+
+// Attach starts logging everything c runs through m, the cart has to be a
+// memory.RomMapper
+func (l *Logger) Attach(c *cpu.Cpu, m *memory.Memory) error {
+	mapper, ok := m.Cart().(memory.RomMapper)
+	if !ok {
+		return ErrNotRomMapper
+	}
+
+	l.Detach()
+	l.cpu = c
+	l.memory = m
+	l.mapper = mapper
+	opcodes := cpu.GetVariantOpcodes(c.Variant())
+	l.rts = opcodes[0x60]
+	l.rti = opcodes[0x40]
+	l.hooks = []cpu.Hook{c.AddBeforeHook(l.before), c.AddAfterHook(l.after)}
+	l.read = m.AddReadHook(0x4020, 0xFFFF, l.onRead)
+	l.chr = m.AddChrHook(l.onChr)
+
+	return nil
+}
+
+func (l *Logger) Detach() {
+	if l.cpu == nil {
+		return
+	}
+
+	for _, hook := range l.hooks {
+		l.cpu.RemoveHook(hook)
+	}
+	l.memory.RemoveHook(l.read)
+	l.memory.RemoveHook(l.chr)
+	l.cpu = nil
+	l.memory = nil
+	l.hooks = nil
+	l.executing = false
+}
+
+func (l *Logger) before(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+	if operation == nil {
+		return
+	}
+
+	l.executing = true
+	l.fetched = false
+	l.pc = pc
+	l.length = 1 + operation.AddressMode.OperandLength()
+	// Everything else only makes dummy reads outside of the stack
+	switch operation.AddressMode {
+	case cpu.AddressModeImplied, cpu.AddressModeAccumulator, cpu.AddressModeImmediate, cpu.AddressModeRelative:
+		l.readsData = false
+	default:
+		l.readsData = true
+	}
+	switch operation.AddressMode {
+	case cpu.AddressModeIndirectX, cpu.AddressModeIndirectY, cpu.AddressModeZeroPageIndirect:
+		l.indirect = true
+	default:
+		l.indirect = false
+	}
+
+	flags := PrgCode
+	if l.jumped {
+		flags |= PrgIndirectCode
+	}
+	for i := uint16(0); i < l.length; i++ {
+		l.logPrg(pc+i, flags)
+	}
+}
+
+func (l *Logger) after(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+	l.executing = false
+
+	switch operation.AddressMode {
+	case cpu.AddressModeIndirect, cpu.AddressModeAbsoluteIndirectX:
+		l.jumped = true
+	default:
+		l.jumped = operation == l.rts || operation == l.rti
+	}
+}
+
+func (l *Logger) onRead(address uint16, value byte) byte {
+	if !l.executing {
+		return value
+	}
+	if !l.fetched {
+		l.fetched = address == l.pc
+		return value
+	}
+
+	if !l.readsData || address-l.pc < l.length {
+		return value
+	}
+
+	flags := PrgData
+	if l.indirect {
+		flags |= PrgIndirectData
+	}
+	l.logPrg(address, flags)
+
+	return value
+}
+
+func (l *Logger) onChr(address uint16, value byte) {
+	l.LogChr(address, ChrRendered)
+}
+
+// Merge ORs in the flags from another log of the same ROM
+func (l *Logger) Merge(other *Logger) error {
+	if len(other.Prg) != len(l.Prg) || len(other.Chr) != len(l.Chr) {
+		return ErrSizeMismatch
+	}
+
+	for i, flags := range other.Prg {
+		// The bank is from whichever log saw it last
+		if flags&(PrgCode|PrgData) != 0 {
+			l.Prg[i] &^= PrgBankMask
+		}
+		l.Prg[i] |= flags
+	}
+	for i, flags := range other.Chr {
+		l.Chr[i] |= flags
+	}
+
+	return nil
+}
+
+// Load merges a saved log into this one so sessions add up
+func (l *Logger) Load(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(l.Prg)+len(l.Chr) {
+		return errors.Wrapf(ErrSizeMismatch, "%d bytes for %d PRG and %d CHR", len(data), len(l.Prg), len(l.Chr))
+	}
+
+	return l.Merge(&Logger{
+		Prg: data[:len(l.Prg)],
+		Chr: data[len(l.Prg):],
+	})
+}
+
+func (l *Logger) Save(w io.Writer) error {
+	if _, err := w.Write(l.Prg); err != nil {
+		return err
+	}
+	_, err := w.Write(l.Chr)
+	return err
+}
+
+// Coverage is how many PRG bytes have been seen as code or data
+func (l *Logger) Coverage() (code, data int) {
+	for _, flags := range l.Prg {
+		if flags&PrgCode != 0 {
+			code++
+		}
+		if flags&PrgData != 0 {
+			data++
+		}
+	}
+	return code, data
+}
@@ -0,0 +1,159 @@
+package cdl_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/cdl"
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// createRom is a 16K NROM image with prg at the start of its PRG bank
+func createRom(prg map[int][]byte) []byte {
+	result := append([]byte{0x4E, 0x45, 0x53, 0x1A, 0x01, 0x01}, make([]byte, 10)...)
+	bank := make([]byte, 16384)
+	for offset, data := range prg {
+		copy(bank[offset:], data)
+	}
+	result = append(result, bank...)
+	return append(result, make([]byte, 8192)...)
+}
+
+func createLogged(t *testing.T) (*cpu.Cpu, *memory.Memory, *cdl.Logger) {
+	m := memory.Create()
+	rom := createRom(map[int][]byte{
+		0x00: {
+			0xA9, 0x20, // LDA #$20
+			0x85, 0x00, // STA $00
+			0xA9, 0x80, // LDA #$80
+			0x85, 0x01, // STA $01
+			0xAD, 0x10, 0x80, // LDA $8010
+			0xB1, 0x00, // LDA ($00),Y
+			0x6C, 0x30, 0xC0, // JMP ($C030)
+		},
+		0x10: {0xFF},
+		0x20: {0xFF},
+		0x30: {0x40, 0x80},
+		0x40: {
+			0xEA,             // NOP
+			0x20, 0x48, 0x80, // JSR $8048
+			0xEA, // NOP
+		},
+		0x48: {0x60}, // RTS
+	})
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+
+	c := cpu.CreateCpu(m)
+	c.Registers.PC = 0x8000
+
+	l := cdl.Create(16384, 8192)
+	assert.NoError(t, l.Attach(c, m))
+
+	return c, m, l
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	for _, accurate := range []bool{false, true} {
+		c, m, l := createLogged(t)
+		c.CycleAccurate = accurate
+		// Peeks before the opcode is fetched aren't data
+		c.AddBeforeHook(func(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+			m.ReadByteAt(0x8050)
+		})
+
+		for i := 0; i < 11; i++ {
+			assert.NoError(t, c.Excute())
+		}
+
+		for i := 0; i < 0x10; i++ {
+			assert.Equal(t, cdl.PrgCode, l.Prg[i], "offset 0x%02X", i)
+		}
+		assert.Equal(t, cdl.PrgData, l.Prg[0x10])
+		assert.Equal(t, cdl.PrgData|cdl.PrgIndirectData, l.Prg[0x20])
+		// Mirrored at $C000 so it's in the second AA bank
+		assert.Equal(t, cdl.PrgData|0x08, l.Prg[0x30])
+		assert.Equal(t, cdl.PrgData|0x08, l.Prg[0x31])
+		assert.Equal(t, cdl.PrgCode|cdl.PrgIndirectCode, l.Prg[0x40])
+		// Returned to from RTS
+		assert.Equal(t, cdl.PrgCode, l.Prg[0x41])
+		assert.Equal(t, cdl.PrgCode|cdl.PrgIndirectCode, l.Prg[0x44])
+		assert.Equal(t, byte(0), l.Prg[0x11])
+		assert.Equal(t, byte(0), l.Prg[0x50])
+
+		code, data := l.Coverage()
+		assert.Equal(t, 22, code)
+		assert.Equal(t, 4, data)
+	}
+}
+
+func TestChr(t *testing.T) {
+	t.Parallel()
+
+	_, _, l := createLogged(t)
+	l.LogChr(0x0010, cdl.ChrRendered)
+	l.LogChr(0x2000, cdl.ChrRendered)
+
+	assert.Equal(t, cdl.ChrRendered, l.Chr[0x10])
+	// Past the pattern tables
+	assert.Equal(t, len(l.Chr)-1, bytes.Count(l.Chr, []byte{0}))
+}
+
+func TestChrFetch(t *testing.T) {
+	t.Parallel()
+
+	_, m, l := createLogged(t)
+	m.FetchChr(0x1234)
+	assert.Equal(t, cdl.ChrRendered, l.Chr[0x1234])
+
+	l.Detach()
+	m.FetchChr(0x0020)
+	assert.Equal(t, byte(0), l.Chr[0x0020])
+}
+
+func TestDetach(t *testing.T) {
+	t.Parallel()
+
+	c, _, l := createLogged(t)
+	l.Detach()
+	assert.NoError(t, c.Excute())
+	assert.Equal(t, byte(0), l.Prg[0])
+}
+
+func TestNotRomMapper(t *testing.T) {
+	t.Parallel()
+
+	m := memory.Create()
+	l := cdl.Create(16384, 8192)
+	assert.Equal(t, cdl.ErrNotRomMapper, l.Attach(cpu.CreateCpu(m), m))
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	first := cdl.Create(4, 2)
+	first.Prg[0] = cdl.PrgCode | 0x04
+	first.Prg[1] = cdl.PrgData
+	first.Chr[1] = cdl.ChrRendered
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, first.Save(buf))
+	assert.Equal(t, []byte{0x05, 0x02, 0x00, 0x00, 0x00, 0x01}, buf.Bytes())
+
+	// Loading merges with what's already logged
+	second := cdl.Create(4, 2)
+	second.Prg[0] = cdl.PrgCode | 0x08
+	second.Prg[2] = cdl.PrgCode
+	second.Chr[0] = cdl.ChrRendered
+	assert.NoError(t, second.Load(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, []byte{cdl.PrgCode | 0x04, cdl.PrgData, cdl.PrgCode, 0x00}, second.Prg)
+	assert.Equal(t, []byte{cdl.ChrRendered, cdl.ChrRendered}, second.Chr)
+
+	err := cdl.Create(4, 4).Load(bytes.NewReader(buf.Bytes()))
+	assert.True(t, errors.Is(err, cdl.ErrSizeMismatch))
+	assert.Equal(t, cdl.ErrSizeMismatch, cdl.Create(2, 2).Merge(first))
+}
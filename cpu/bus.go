@@ -0,0 +1,42 @@
+package cpu
+
+// Bus is everything the CPU can reach, memory.Memory is the NES one
+type Bus interface {
+	ReadByteAt(address uint16) byte
+	WriteByteAt(address uint16, value byte)
+}
+
+// Peeker is a bus that can be read without side effects like clearing a
+// status flag, traces use it when the bus has it
+type Peeker interface {
+	PeekByteAt(address uint16) byte
+}
+
+// PpuPosition is the video chip's position printed in traces, ppu.Ppu is the
+// NES one
+type PpuPosition interface {
+	Position() (dot, scanline, frame int)
+}
+
+// Ram is a flat 64KB bus with nothing mapped into it, for running the CPU
+// outside of a NES
+type Ram [0x10000]byte
+
+func (r *Ram) ReadByteAt(address uint16) byte {
+	return r[address]
+}
+
+func (r *Ram) WriteByteAt(address uint16, value byte) {
+	r[address] = value
+}
+
+func (r *Ram) PeekByteAt(address uint16) byte {
+	return r[address]
+}
+
+// WriteBytes copies data into ram starting at address
+func (r *Ram) WriteBytes(address uint16, data []byte) {
+	for i, value := range data {
+		r[address+uint16(i)] = value
+	}
+}
@@ -0,0 +1,44 @@
+package cpu_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRam(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	c := cpu.CreateCpuVariant(ram, cpu.VariantNmos6502)
+	ram.WriteBytes(cpu.ResetVector, []byte{0x00, 0x02})
+	// LDA #$42; STA $2002; STA $FFF0
+	ram.WriteBytes(0x0200, []byte{0xA9, 0x42, 0x8D, 0x02, 0x20, 0x8D, 0xF0, 0xFF})
+	c.PowerOn()
+
+	for i := 0; i < 3; i++ {
+		c.Excute()
+	}
+
+	assert.Equal(t, uint16(0x0208), c.Registers.PC)
+	// Nothing is mirrored or mapped
+	assert.Equal(t, byte(0x42), ram.ReadByteAt(0x2002))
+	assert.Equal(t, byte(0x42), ram.ReadByteAt(0xFFF0))
+	assert.Equal(t, byte(0x00), ram.ReadByteAt(0x0002))
+}
+
+func TestTracePeeksBus(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	// LDA $2002
+	ram.WriteBytes(0x0200, []byte{0xAD, 0x02, 0x20})
+	ram.WriteByteAt(0x2002, 0x80)
+
+	line := cpu.FormatTraceLine(c, cpu.TraceFormatNesTest)
+	assert.True(t, strings.Contains(line, "LDA $2002 = 80"), line)
+}
@@ -1,44 +1,243 @@
 package cpu
 
 import (
-	"encoding/binary"
 	"fmt"
-	"log"
-	"strings"
+
+	"github.com/pkg/errors"
 
 	nesmath "github.com/sardap/gos/math"
-	"github.com/sardap/gos/memory"
-	"github.com/sardap/gos/ppu"
 )
 
+// https://wiki.nesdev.com/w/index.php/CPU_interrupts
+const (
+	NmiVector   = 0xFFFA
+	ResetVector = 0xFFFC
+	IrqVector   = 0xFFFE
+
+	StackOffset = 0x0100
+
+	interuptCycles = 7
+)
+
+var (
+	ErrUnknownOpcode = fmt.Errorf("unkown opcode")
+)
+
+// IrqSource is a device pulling the shared IRQ line low. The line is wired
+// OR so it stays asserted until every source has released it.
+type IrqSource byte
+
+const (
+	IrqSourceExternal IrqSource = 1 << iota
+	IrqSourceApuFrame
+	IrqSourceDmc
+	IrqSourceMapper
+)
+
+// Variant is the chip being emulated
+type Variant int
+
+const (
+	// Variant2A03 is the Ricoh CPU in the NES, a NMOS 6502 with decimal mode
+	// cut out
+	Variant2A03 Variant = iota
+	// VariantNmos6502 is the stock 6502 with decimal mode
+	VariantNmos6502
+	// Variant65C02 is the CMOS 6502 with its extra instructions and without
+	// the undocumented NMOS ones or the indirect JMP bug
+	Variant65C02
+)
+
+func (v Variant) String() string {
+	switch v {
+	case Variant2A03:
+		return "2A03"
+	case VariantNmos6502:
+		return "6502"
+	case Variant65C02:
+		return "65C02"
+	}
+
+	panic(fmt.Errorf("unkown variant"))
+}
+
 type Cpu struct {
-	Registers   *Registers
-	Memory      *memory.Memory
-	Ppu         *ppu.Ppu
+	Registers *Registers
+	Bus       Bus
+	// Ppu is only used for the PPU position in traces, nil outside of a NES
+	Ppu         PpuPosition
 	Cycles      int
 	ExtraCycles byte
-	// http://nesdev.com/the%20%27B%27%20flag%20&%20BRK%20instruction.txt
-	Interupt bool
+	// TotalCycles counts every cycle since power on
+	TotalCycles int64
+	// Halted is set by the JAM opcodes, only a reset recovers
+	Halted bool
+	// CycleAccurate makes every bus access real hardware does happen on its
+	// own cycle, including the dummy reads and writes. Otherwise only the
+	// accesses that matter to the result are made and the cycles are added
+	// at the end of the instruction.
+	CycleAccurate bool
+	// Tick is called once for every CPU cycle
+	Tick func()
+	// Tracer sees every instruction before it runs, nil disables tracing
+	Tracer Tracer
+
+	variant Variant
+	opcodes *opcodeTable
+	hooks   hooks
+
+	nmiLine      bool
+	nmiPending   bool
+	irqLines     IrqSource
+	irqPending   bool
+	resetPending bool
+}
+
+// CreateCpu creates a 2A03
+func CreateCpu(bus Bus) *Cpu {
+	return CreateCpuVariant(bus, Variant2A03)
 }
 
-func CreateCpu(mem *memory.Memory, ppu *ppu.Ppu) *Cpu {
+func CreateCpuVariant(bus Bus, variant Variant) *Cpu {
 	return &Cpu{
 		Registers: CreateRegisters(),
-		Memory:    mem,
-		Ppu:       ppu,
+		Bus:       bus,
 		Cycles:    0,
-		Interupt:  true,
+		variant:   variant,
+		opcodes:   variantOpcodeTable(variant),
+	}
+}
+
+func (c *Cpu) Variant() Variant {
+	return c.variant
+}
+
+// decimal is true when ADC and SBC should work in BCD
+func (c *Cpu) decimal() bool {
+	return c.variant != Variant2A03 && c.Registers.P.ReadFlag(FlagDecimal)
+}
+
+// PowerOn puts the registers into their power up state and runs the reset
+// sequence https://wiki.nesdev.com/w/index.php/CPU_power_up_state
+func (c *Cpu) PowerOn() {
+	c.Registers.A = StartingA
+	c.Registers.X = StartingX
+	c.Registers.Y = StartingY
+	c.Registers.P.Write(StartingP)
+	c.Registers.SP = 0x00
+
+	c.nmiLine = false
+	c.nmiPending = false
+	c.irqLines = 0
+	c.irqPending = false
+	c.resetPending = false
+	c.Halted = false
+	c.TotalCycles = 0
+
+	c.reset()
+	c.catchUp(interuptCycles)
+}
+
+// SetNmi drives the NMI line. NMI is edge triggered so only going from
+// released to asserted queues an interrupt.
+func (c *Cpu) SetNmi(asserted bool) {
+	if asserted && !c.nmiLine {
+		c.nmiPending = true
+	}
+	c.nmiLine = asserted
+}
+
+// SetIrq drives the IRQ line for a single source. IRQ is level triggered and
+// is ignored while FlagInteruprtDisable is set.
+func (c *Cpu) SetIrq(source IrqSource, asserted bool) {
+	if asserted {
+		c.irqLines |= source
+	} else {
+		c.irqLines &^= source
 	}
 }
 
+func (c *Cpu) IrqAsserted() bool {
+	return c.irqLines != 0
+}
+
+// Reset pulls the RESET line, the CPU will jump through the reset vector
+// before the next instruction.
+func (c *Cpu) Reset() {
+	c.resetPending = true
+}
+
+func (c *Cpu) cycle() {
+	c.Cycles++
+	c.TotalCycles++
+	if c.Tick != nil {
+		c.Tick()
+	}
+}
+
+// Stall clocks the CPU without it doing anything, DMA halts it like this
+func (c *Cpu) Stall(cycles int) {
+	for i := 0; i < cycles; i++ {
+		c.cycle()
+	}
+}
+
+// catchUp clocks the cycles the fast path didn't spend on bus accesses
+func (c *Cpu) catchUp(cycles int) {
+	if c.CycleAccurate {
+		return
+	}
+
+	for i := 0; i < cycles; i++ {
+		c.cycle()
+	}
+}
+
+func (c *Cpu) read(address uint16) byte {
+	if c.CycleAccurate {
+		c.cycle()
+	}
+	return c.Bus.ReadByteAt(address)
+}
+
+func (c *Cpu) write(address uint16, value byte) {
+	if c.CycleAccurate {
+		c.cycle()
+	}
+	c.Bus.WriteByteAt(address, value)
+}
+
+// dummyRead is a bus access the CPU makes but throws away the result of
+func (c *Cpu) dummyRead(address uint16) {
+	if c.CycleAccurate {
+		c.read(address)
+	}
+}
+
+// dummyWrite is the write of the unmodified value read-modify-write
+// instructions make before writing the result. Mappers like MMC1 act on it
+// so it's made without CycleAccurate too.
+func (c *Cpu) dummyWrite(address uint16, value byte) {
+	c.write(address, value)
+}
+
+func (c *Cpu) readUint16(address uint16) uint16 {
+	return uint16(c.read(address)) | uint16(c.read(address+1))<<8
+}
+
+func (c *Cpu) stackAddress() uint16 {
+	return StackOffset + uint16(c.Registers.SP)
+}
+
 func (c *Cpu) PushByte(value byte) {
-	c.Memory.WriteByteAt(memory.StackOffset+uint16(c.Registers.SP), value)
+	c.write(c.stackAddress(), value)
 	c.Registers.SP--
 }
 
-func (c *Cpu) PushP() {
+// http://nesdev.com/the%20%27B%27%20flag%20&%20BRK%20instruction.txt
+func (c *Cpu) PushP(breakCommand bool) {
 	value := c.Registers.P.Read()
-	value = nesmath.SetBit(value, byte(FlagBreakCommand), c.Interupt)
+	value = nesmath.SetBit(value, byte(FlagBreakCommand), breakCommand)
 	value = nesmath.SetBit(value, byte(FlagUnsued), true)
 
 	c.PushByte(value)
@@ -46,8 +245,7 @@ func (c *Cpu) PushP() {
 
 func (c *Cpu) PopByte() byte {
 	c.Registers.SP++
-	result := c.Memory.ReadByteAt(memory.StackOffset + uint16(c.Registers.SP))
-	return result
+	return c.read(c.stackAddress())
 }
 
 func (c *Cpu) PopP() {
@@ -64,150 +262,245 @@ func (c *Cpu) PushUint16(value uint16) {
 }
 
 func (c *Cpu) PopUint16() uint16 {
-	return binary.LittleEndian.Uint16([]byte{c.PopByte(), c.PopByte()})
+	low := c.PopByte()
+	return uint16(low) | uint16(c.PopByte())<<8
 }
 
-func (c *Cpu) logStep(operation Operation) {
-	var builder strings.Builder
-
-	builder.WriteString(fmt.Sprintf("%04X  ", c.Registers.PC))
-	builder.WriteString(fmt.Sprintf("%02X ", c.Memory.ReadByteAt(c.Registers.PC)))
-	if operation.Length >= 2 || operation.AddressMode == AddressModeRelative {
-		builder.WriteString(fmt.Sprintf("%02X ", c.Memory.ReadByteAt(c.Registers.PC+1)))
+// interrupt is the sequence shared by BRK, IRQ and NMI, it returns the vector
+// actually used
+func (c *Cpu) interrupt(returnAddress, vector uint16, breakCommand bool) uint16 {
+	c.PushUint16(returnAddress)
+	c.PushP(breakCommand)
+	c.Registers.P.SetFlag(FlagInteruprtDisable, true)
+	if c.variant == Variant65C02 {
+		c.Registers.P.SetFlag(FlagDecimal, false)
 	}
-	if operation.Length >= 3 {
-		builder.WriteString(fmt.Sprintf("%02X ", c.Memory.ReadByteAt(c.Registers.PC+2)))
+
+	// A NMI arriving during a BRK or IRQ hijacks the vector fetch
+	if vector == IrqVector && c.nmiPending {
+		c.nmiPending = false
+		vector = NmiVector
 	}
-	for builder.Len() < 16 {
-		builder.WriteString(" ")
+
+	c.Registers.PC = c.readUint16(vector)
+	return vector
+}
+
+func (c *Cpu) reset() {
+	c.dummyRead(c.Registers.PC)
+	c.dummyRead(c.Registers.PC)
+	// Reset goes through the same motions as an interrupt but the stack
+	// writes are turned into reads
+	for i := 0; i < 3; i++ {
+		c.dummyRead(c.stackAddress())
+		c.Registers.SP--
 	}
+	c.Registers.P.SetFlag(FlagInteruprtDisable, true)
+	c.Registers.PC = c.readUint16(ResetVector)
+}
 
-	builder.WriteString(strings.Split(operation.Name, " ")[0])
-	builder.WriteString(" ")
-	if operation.Length >= 2 || operation.Length == 0 {
-		if operation.AddressMode == AddressModeImmediate {
-			builder.WriteString("#$")
-		} else {
-			builder.WriteString("$")
-		}
-		if operation.Length >= 3 || operation.Length == 0 {
-			builder.WriteString(fmt.Sprintf("%02X", c.Memory.ReadByteAt(c.Registers.PC+2)))
-		}
-		builder.WriteString(fmt.Sprintf("%02X", c.Memory.ReadByteAt(c.Registers.PC+1)))
+// serviceInterrupt runs a pending interrupt sequence in place of the next
+// instruction, reset takes priority over NMI which takes priority over IRQ.
+func (c *Cpu) serviceInterrupt() bool {
+	from := c.Registers.PC
+	var vector uint16
+	switch {
+	case c.resetPending:
+		c.resetPending = false
+		c.Halted = false
+		c.nmiPending = false
+		c.irqPending = false
+		c.reset()
+		vector = ResetVector
+	case c.nmiPending:
+		c.nmiPending = false
+		c.irqPending = false
+		c.dummyRead(c.Registers.PC)
+		c.dummyRead(c.Registers.PC)
+		vector = c.interrupt(c.Registers.PC, NmiVector, false)
+	case c.irqPending:
+		c.irqPending = false
+		c.dummyRead(c.Registers.PC)
+		c.dummyRead(c.Registers.PC)
+		vector = c.interrupt(c.Registers.PC, IrqVector, false)
+	default:
+		return false
 	}
 
-	for builder.Len() < 48 {
-		builder.WriteString(" ")
+	c.catchUp(interuptCycles)
+
+	for _, hook := range c.hooks.interrupt {
+		hook.interrupt(c, from, vector)
 	}
 
-	builder.WriteString(
-		fmt.Sprintf(
-			"A:%02X X:%02X Y:%02X P:%02X SP:%02X ",
-			c.Registers.A, c.Registers.X, c.Registers.Y,
-			c.Registers.P.Read(), c.Registers.SP,
-		),
-	)
+	return true
+}
 
-	builder.WriteString("\n")
+// pollInterrupts latches the IRQ line at the end of an instruction. CLI, SEI
+// and PLP change the I flag after the poll so they see the old value.
+func (c *Cpu) pollInterrupts(opcode byte, interuptDisable bool) {
+	switch opcode {
+	case 0x58, 0x78, 0x28:
+	default:
+		interuptDisable = c.Registers.P.ReadFlag(FlagInteruprtDisable)
+	}
 
-	log.Print(builder.String())
+	c.irqPending = c.irqLines != 0 && !interuptDisable
 }
 
-func (c *Cpu) Excute() {
-	opcode := c.Memory.ReadByteAt(c.Registers.PC)
+// Excute runs a single instruction or interrupt sequence. Opcodes missing
+// from the variant's table are an error and leave PC on the opcode.
+func (c *Cpu) Excute() error {
+	// A jammed CPU keeps the clock running but ignores everything except reset
+	if c.Halted && !c.resetPending {
+		c.dummyRead(0xFFFF)
+		c.catchUp(1)
+		return nil
+	}
 
-	operation, ok := opcodes[opcode]
-	if !ok {
-		panic(fmt.Errorf("unkown opcode %02X", opcode))
+	if c.serviceInterrupt() {
+		return nil
 	}
 
-	c.logStep(*operation)
+	if len(c.hooks.before) > 0 {
+		opcode, _ := tracePeek(c, c.Registers.PC)
+		runHooks(c.hooks.before, c, c.Registers.PC, c.opcodes[opcode])
+	}
+
+	if c.Tracer != nil {
+		c.Tracer.Trace(c)
+	}
+
+	pc := c.Registers.PC
+	opcode := c.read(pc)
+
+	operation := c.opcodes[opcode]
+	if operation == nil {
+		return errors.Wrapf(ErrUnknownOpcode, "%02X at $%04X", opcode, c.Registers.PC)
+	}
+
+	// Single byte instructions still read the byte after the opcode, apart
+	// from the 65C02's one cycle NOPs
+	switch operation.AddressMode {
+	case AddressModeImplied, AddressModeAccumulator:
+		if operation.MinCycles > 1 {
+			c.dummyRead(c.Registers.PC + 1)
+		}
+	}
+
+	interuptDisable := c.Registers.P.ReadFlag(FlagInteruprtDisable)
 
 	operation.Inst(c, operation.AddressMode)
 
 	c.Registers.PC += operation.Length
-	c.Cycles += operation.MinCycles + int(c.ExtraCycles)
+	c.catchUp(operation.MinCycles + int(c.ExtraCycles))
 	c.ExtraCycles = 0
+
+	c.pollInterrupts(opcode, interuptDisable)
+
+	if len(c.hooks.after) > 0 {
+		runHooks(c.hooks.after, c, pc, operation)
+	}
+
+	return nil
 }
 
-func (c *Cpu) GetOprandAddress(addressMode AddressMode) uint16 {
-	byteOperand := c.Memory.ReadByteAt(c.Registers.PC + 1)
+func pageCrossed(a, b uint16) bool {
+	return a&0xFF00 != b&0xFF00
+}
+
+// indexed adds the index to base, when the page is crossed the CPU first
+// reads from the address with the high byte not fixed yet. Instructions that
+// write always spend that cycle, reads only pay it when the page changes.
+func (c *Cpu) indexed(base uint16, index byte, write bool) uint16 {
+	address := base + uint16(index)
+	crossed := pageCrossed(base, address)
+
+	if crossed || write {
+		c.dummyRead(base&0xFF00 | address&0x00FF)
+	}
+	if crossed && !write {
+		c.ExtraCycles++
+	}
+
+	return address
+}
 
+func (c *Cpu) operandAddress(addressMode AddressMode, write bool) uint16 {
 	switch addressMode {
 	case AddressModeImmediate:
 		return c.Registers.PC + 1
 
 	case AddressModeZeroPage:
-		return uint16(byteOperand)
+		return uint16(c.read(c.Registers.PC + 1))
 
 	case AddressModeZeroPageX:
-		return nesmath.WrapUint16(uint16(byteOperand)+uint16(c.Registers.X), 0xFF)
+		pointer := c.read(c.Registers.PC + 1)
+		c.dummyRead(uint16(pointer))
+		return uint16(pointer + c.Registers.X)
 
 	case AddressModeZeroPageY:
-		return nesmath.WrapUint16(uint16(byteOperand)+uint16(c.Registers.Y), 0xFF)
+		pointer := c.read(c.Registers.PC + 1)
+		c.dummyRead(uint16(pointer))
+		return uint16(pointer + c.Registers.Y)
 
 	case AddressModeAbsolute:
-		return c.Memory.ReadUint16At(c.Registers.PC + 1)
+		return c.readUint16(c.Registers.PC + 1)
 
 	case AddressModeAbsoluteX:
-		address := c.Memory.ReadUint16At(c.Registers.PC+1) + uint16(c.Registers.X)
-		if samePage(address, c.Registers.PC) {
-			c.ExtraCycles++
-		}
-		return address
+		return c.indexed(c.readUint16(c.Registers.PC+1), c.Registers.X, write)
 
 	case AddressModeAbsoluteY:
-		address := c.Memory.ReadUint16At(c.Registers.PC+1) + uint16(c.Registers.Y)
-		if samePage(address, c.Registers.PC) {
-			c.ExtraCycles++
-		}
-		return address
+		return c.indexed(c.readUint16(c.Registers.PC+1), c.Registers.Y, write)
 
 	case AddressModeIndirect:
 		// Guess who spent 5 hours staring at this fucking thing
 		// Only to find out it's a bug with the 6502 https://atariage.com/forums/topic/72382-6502-indirect-addressing-ff-behavior/
-		address := uint16(c.Memory.ReadUint16At(c.Registers.PC + 1))
-		buffer := make([]byte, 2)
-		binary.LittleEndian.PutUint16(buffer, address)
-		secondAddress := binary.LittleEndian.Uint16([]byte{
-			buffer[0] + 1,
-			buffer[1],
-		})
-		return binary.LittleEndian.Uint16([]byte{
-			c.Memory.ReadByteAt(address),
-			c.Memory.ReadByteAt(secondAddress),
-		})
+		address := c.readUint16(c.Registers.PC + 1)
+		secondAddress := address&0xFF00 | uint16(byte(address)+1)
+		// The 65C02 fixed it at the cost of a cycle
+		if c.variant == Variant65C02 {
+			c.dummyRead(c.Registers.PC + 2)
+			secondAddress = address + 1
+		}
+		return uint16(c.read(address)) | uint16(c.read(secondAddress))<<8
+
+	case AddressModeZeroPageIndirect:
+		pointer := c.read(c.Registers.PC + 1)
+		return uint16(c.read(uint16(pointer))) | uint16(c.read(uint16(pointer+1)))<<8
+
+	case AddressModeAbsoluteIndirectX:
+		base := c.readUint16(c.Registers.PC + 1)
+		c.dummyRead(c.Registers.PC + 2)
+		return c.readUint16(base + uint16(c.Registers.X))
 
 	case AddressModeIndirectX:
-		address := uint16(byteOperand) + uint16(c.Registers.X)
-		return binary.LittleEndian.Uint16([]byte{
-			c.Memory.ReadByteAt(nesmath.WrapUint16(address, 0xFF)),
-			c.Memory.ReadByteAt(nesmath.WrapUint16(address+1, 0xFF)),
-		})
+		pointer := c.read(c.Registers.PC + 1)
+		c.dummyRead(uint16(pointer))
+		pointer += c.Registers.X
+		return uint16(c.read(uint16(pointer))) | uint16(c.read(uint16(pointer+1)))<<8
 
 	case AddressModeIndirectY:
-		indirect := binary.LittleEndian.Uint16([]byte{
-			c.Memory.ReadByteAt(nesmath.WrapUint16(uint16(byteOperand), 0xFF)),
-			c.Memory.ReadByteAt(nesmath.WrapUint16(uint16(byteOperand)+1, 0xFF)),
-		})
-		address := indirect + uint16(c.Registers.Y)
-		if samePage(address, c.Registers.PC) {
-			c.ExtraCycles++
-		}
-		return address
+		pointer := c.read(c.Registers.PC + 1)
+		base := uint16(c.read(uint16(pointer))) | uint16(c.read(uint16(pointer+1)))<<8
+		return c.indexed(base, c.Registers.Y, write)
 
 	default:
 		panic(fmt.Errorf("address mode not implmented"))
 	}
 }
 
+func (c *Cpu) GetOprandAddress(addressMode AddressMode) uint16 {
+	return c.operandAddress(addressMode, false)
+}
+
 func (c *Cpu) ReadByteByMode(mode AddressMode) byte {
 	switch mode {
 	case AddressModeAccumulator:
 		return c.Registers.A
 	default:
 		address := c.GetOprandAddress(mode)
-		return c.Memory.ReadByteAt(address)
+		return c.read(address)
 	}
 }
 
@@ -216,7 +509,34 @@ func (c *Cpu) WriteByteByMode(mode AddressMode, value byte) {
 	case AddressModeAccumulator:
 		c.Registers.A = value
 	default:
-		address := c.GetOprandAddress(mode)
-		c.Memory.WriteByteAt(address, value)
+		address := c.operandAddress(mode, true)
+		c.write(address, value)
+	}
+}
+
+// readModify is the first half of a read-modify-write instruction, the
+// address is handed back to writeModified so it's only resolved once
+func (c *Cpu) readModify(mode AddressMode) (uint16, byte) {
+	switch mode {
+	case AddressModeAccumulator:
+		return 0, c.Registers.A
+	default:
+		address := c.operandAddress(mode, true)
+		return address, c.read(address)
+	}
+}
+
+// writeModified writes the original value back before the result like the
+// real hardware does, the 65C02 reads it again instead
+func (c *Cpu) writeModified(mode AddressMode, address uint16, original, value byte) {
+	switch {
+	case mode == AddressModeAccumulator:
+		c.Registers.A = value
+	case c.variant == Variant65C02:
+		c.dummyRead(address)
+		c.write(address, value)
+	default:
+		c.dummyWrite(address, original)
+		c.write(address, value)
 	}
 }
@@ -2,8 +2,10 @@ package cpu_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/memory"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,14 +28,14 @@ func TestZeroPageX(t *testing.T) {
 	// Wraping
 	c.Registers.PC = 0x1000
 	c.Registers.X = 0x8A
-	c.Memory.WriteUint16At(0x1001, 0xFF)
+	mem(c).WriteUint16At(0x1001, 0xFF)
 
 	assert.Equal(t, uint16(0x89), c.GetOprandAddress(cpu.AddressModeZeroPageX))
 
 	// Normal
 	c.Registers.PC = 0x1000
 	c.Registers.X = 0x8A
-	c.Memory.WriteUint16At(0x1001, 0x01)
+	mem(c).WriteUint16At(0x1001, 0x01)
 
 	assert.Equal(t, uint16(0x8B), c.GetOprandAddress(cpu.AddressModeZeroPageX))
 }
@@ -44,7 +46,7 @@ func TestZeroPageY(t *testing.T) {
 	// Wraping
 	c.Registers.PC = 0x1000
 	c.Registers.Y = 0xFF
-	c.Memory.WriteUint16At(0x1001, 0x80)
+	mem(c).WriteUint16At(0x1001, 0x80)
 
 	assert.Equal(t, uint16(0x7F), c.GetOprandAddress(cpu.AddressModeZeroPageY))
 }
@@ -54,17 +56,17 @@ func TestInderect(t *testing.T) {
 
 	// 6502 wraping bug https://atariage.com/forums/topic/72382-6502-indirect-addressing-ff-behavior/
 	c.Registers.PC = 0
-	c.Memory.WriteUint16At(0x01, 0x02FF)
-	c.Memory.WriteByteAt(0x02FF, 0x00)
-	c.Memory.WriteByteAt(0x0200, 0x03)
+	mem(c).WriteUint16At(0x01, 0x02FF)
+	mem(c).WriteByteAt(0x02FF, 0x00)
+	mem(c).WriteByteAt(0x0200, 0x03)
 
 	assert.Equal(t, uint16(0x0300), c.GetOprandAddress(cpu.AddressModeIndirect))
 
 	// Normal
 	c.Registers.PC = 0
-	c.Memory.WriteUint16At(0x01, 0x02FF)
-	c.Memory.WriteByteAt(0x03FE, 0x00)
-	c.Memory.WriteByteAt(0x03FF, 0x03)
+	mem(c).WriteUint16At(0x01, 0x02FF)
+	mem(c).WriteByteAt(0x03FE, 0x00)
+	mem(c).WriteByteAt(0x03FF, 0x03)
 
 	assert.Equal(t, uint16(0x0300), c.GetOprandAddress(cpu.AddressModeIndirect))
 }
@@ -75,11 +77,11 @@ func TestInderectY(t *testing.T) {
 	// Inderect
 	c.Registers.Y = 0xFF
 	c.Registers.PC = 0
-	c.Memory.WriteByteAt(0x01, 0xFF)
-	c.Memory.WriteByteAt(0xFF, 0x46)
-	c.Memory.WriteByteAt(0x00, 0x01)
-	c.Memory.WriteUint16At(0x0146, 0x0245)
-	c.Memory.WriteByteAt(0x0245, 0x12)
+	mem(c).WriteByteAt(0x01, 0xFF)
+	mem(c).WriteByteAt(0xFF, 0x46)
+	mem(c).WriteByteAt(0x00, 0x01)
+	mem(c).WriteUint16At(0x0146, 0x0245)
+	mem(c).WriteByteAt(0x0245, 0x12)
 
 	assert.Equal(t, byte(0x12), c.ReadByteByMode(cpu.AddressModeIndirectY))
 }
@@ -91,10 +93,10 @@ func TestInderectXWrap(t *testing.T) {
 	c.Registers.X = 0x0A
 	c.Registers.A = 0
 	c.Registers.PC = 0
-	c.Memory.WriteByteAt(0x01, 0xF5)
-	c.Memory.WriteByteAt(0xFF, 0x00)
-	c.Memory.WriteByteAt(0x00, 0x04)
-	c.Memory.WriteByteAt(0x0400, 0x5D)
+	mem(c).WriteByteAt(0x01, 0xF5)
+	mem(c).WriteByteAt(0xFF, 0x00)
+	mem(c).WriteByteAt(0x00, 0x04)
+	mem(c).WriteByteAt(0x0400, 0x5D)
 
 	assert.Equal(t, byte(0x5D), c.ReadByteByMode(cpu.AddressModeIndirectX))
 
@@ -102,10 +104,375 @@ func TestInderectXWrap(t *testing.T) {
 	c.Registers.X = 0x81
 	c.Registers.A = 0
 	c.Registers.PC = 0
-	c.Memory.WriteByteAt(0x01, 0xFF)
-	c.Memory.WriteByteAt(0x80, 0x00)
-	c.Memory.WriteByteAt(0x81, 0x02)
-	c.Memory.WriteByteAt(0x0200, 0x5A)
+	mem(c).WriteByteAt(0x01, 0xFF)
+	mem(c).WriteByteAt(0x80, 0x00)
+	mem(c).WriteByteAt(0x81, 0x02)
+	mem(c).WriteByteAt(0x0200, 0x5A)
 
 	assert.Equal(t, byte(0x5A), c.ReadByteByMode(cpu.AddressModeIndirectX))
 }
+
+func TestNmi(t *testing.T) {
+	c := createCpu()
+
+	c.Registers.PC = 0x1234
+	c.Registers.P.Write(0x24)
+	mem(c).WriteUint16At(cpu.NmiVector, 0x8000)
+
+	// Holding the line only triggers once
+	c.SetNmi(true)
+	c.Excute()
+
+	assert.Equal(t, uint16(0x8000), c.Registers.PC)
+	assert.Equal(t, 7, c.Cycles)
+	assert.True(t, c.Registers.P.ReadFlag(cpu.FlagInteruprtDisable))
+	// B flag is clear when pushed by hardware
+	assert.Equal(t, byte(0x24), c.PopByte())
+	assert.Equal(t, uint16(0x1234), c.PopUint16())
+
+	// NOP
+	mem(c).WriteByteAt(0x8000, 0xEA)
+	c.Excute()
+	assert.Equal(t, uint16(0x8001), c.Registers.PC)
+
+	c.SetNmi(false)
+	c.SetNmi(true)
+	c.Excute()
+	assert.Equal(t, uint16(0x8000), c.Registers.PC)
+}
+
+func TestIrq(t *testing.T) {
+	c := createCpu()
+
+	c.Registers.PC = 0x0200
+	mem(c).WriteUint16At(cpu.IrqVector, 0x9000)
+	// CLI; NOP; NOP
+	mem(c).WriteByteAt(0x0200, 0x58)
+	mem(c).WriteByteAt(0x0201, 0xEA)
+	mem(c).WriteByteAt(0x0202, 0xEA)
+
+	// Ignored while interrupts are disabled
+	c.Registers.P.SetFlag(cpu.FlagInteruprtDisable, true)
+	c.SetIrq(cpu.IrqSourceExternal, true)
+	assert.True(t, c.IrqAsserted())
+
+	// CLI only takes effect after the next instruction
+	c.Excute()
+	assert.Equal(t, uint16(0x0201), c.Registers.PC)
+	c.Excute()
+	assert.Equal(t, uint16(0x0202), c.Registers.PC)
+	c.Excute()
+	assert.Equal(t, uint16(0x9000), c.Registers.PC)
+	assert.Equal(t, byte(0x20), c.PopByte()&0x30)
+	assert.Equal(t, uint16(0x0202), c.PopUint16())
+
+	// Level triggered stays until every source releases it
+	c.SetIrq(cpu.IrqSourceMapper, true)
+	c.SetIrq(cpu.IrqSourceExternal, false)
+	assert.True(t, c.IrqAsserted())
+	c.SetIrq(cpu.IrqSourceMapper, false)
+	assert.False(t, c.IrqAsserted())
+}
+
+func TestReset(t *testing.T) {
+	c := createCpu()
+
+	c.Registers.SP = 0xFD
+	c.Registers.A = 0x12
+	mem(c).WriteUint16At(cpu.ResetVector, 0xC123)
+
+	c.Reset()
+	c.Excute()
+
+	assert.Equal(t, uint16(0xC123), c.Registers.PC)
+	assert.Equal(t, byte(0xFA), c.Registers.SP)
+	assert.Equal(t, byte(0x12), c.Registers.A)
+	assert.Equal(t, 7, c.Cycles)
+	assert.True(t, c.Registers.P.ReadFlag(cpu.FlagInteruprtDisable))
+}
+
+func TestBrk(t *testing.T) {
+	c := createCpu()
+
+	c.Registers.PC = 0x0300
+	c.Registers.P.Write(0x20)
+	mem(c).WriteUint16At(cpu.IrqVector, 0x9000)
+	mem(c).WriteByteAt(0x0300, 0x00)
+
+	c.Excute()
+
+	assert.Equal(t, uint16(0x9000), c.Registers.PC)
+	assert.Equal(t, 7, c.Cycles)
+	assert.Equal(t, byte(0x30), c.PopByte())
+	assert.Equal(t, uint16(0x0302), c.PopUint16())
+
+	// NMI hijacks BRK
+	c.Registers.PC = 0x0300
+	mem(c).WriteUint16At(cpu.NmiVector, 0xA000)
+	c.SetNmi(true)
+
+	cpu.Brk(c, cpu.AddressModeImplied)
+
+	assert.Equal(t, uint16(0xA000), c.Registers.PC)
+}
+
+type busAccess struct {
+	address uint16
+	value   byte
+	write   bool
+}
+
+// Records the first access of each cycle so the step log's reads are ignored
+type recordingCart struct {
+	testCart
+	cycles   int
+	accesses []busAccess
+}
+
+func (c *recordingCart) record(access busAccess) {
+	if len(c.accesses) < c.cycles {
+		c.accesses = append(c.accesses, access)
+	}
+}
+
+func (c *recordingCart) WriteByteAt(address uint16, value byte) error {
+	c.record(busAccess{address, value, true})
+	return c.testCart.WriteByteAt(address, value)
+}
+
+func (c *recordingCart) ReadByteAt(address uint16) (byte, error) {
+	value, err := c.testCart.ReadByteAt(address)
+	c.record(busAccess{address, value, false})
+	return value, err
+}
+
+func createAccurateCpu(variant cpu.Variant) (*cpu.Cpu, *recordingCart) {
+	cart := &recordingCart{}
+	c := cpu.CreateCpuVariant(memory.Create(), variant)
+	mem(c).SetCart(cart)
+	c.CycleAccurate = true
+	c.Tick = func() {
+		cart.cycles++
+	}
+	return c, cart
+}
+
+func TestDummyAccesses(t *testing.T) {
+	testCases := []struct {
+		name     string
+		program  []byte
+		x        byte
+		y        byte
+		expected []busAccess
+	}{
+		{
+			name:    "STA oper,X",
+			program: []byte{0x9D, 0xF0, 0x80},
+			x:       0x20,
+			expected: []busAccess{
+				{0x8000, 0x9D, false},
+				{0x8001, 0xF0, false},
+				{0x8002, 0x80, false},
+				{0x8010, 0x00, false},
+				{0x8110, 0x00, true},
+			},
+		},
+		{
+			name:    "LDA oper,X no page cross",
+			program: []byte{0xBD, 0x10, 0x90},
+			x:       0x01,
+			expected: []busAccess{
+				{0x8000, 0xBD, false},
+				{0x8001, 0x10, false},
+				{0x8002, 0x90, false},
+				{0x9011, 0x00, false},
+			},
+		},
+		{
+			name:    "LDA oper,X page cross",
+			program: []byte{0xBD, 0xF0, 0x8F},
+			x:       0x20,
+			expected: []busAccess{
+				{0x8000, 0xBD, false},
+				{0x8001, 0xF0, false},
+				{0x8002, 0x8F, false},
+				{0x8F10, 0x00, false},
+				{0x9010, 0x00, false},
+			},
+		},
+		{
+			name:    "LDA oper,Y page cross",
+			program: []byte{0xB9, 0xFF, 0x8F},
+			y:       0x01,
+			expected: []busAccess{
+				{0x8000, 0xB9, false},
+				{0x8001, 0xFF, false},
+				{0x8002, 0x8F, false},
+				{0x8F00, 0x00, false},
+				{0x9000, 0x41, false},
+			},
+		},
+		{
+			name:    "INC oper",
+			program: []byte{0xEE, 0x00, 0x90},
+			expected: []busAccess{
+				{0x8000, 0xEE, false},
+				{0x8001, 0x00, false},
+				{0x8002, 0x90, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x41, true},
+				{0x9000, 0x42, true},
+			},
+		},
+		{
+			name:    "INX",
+			program: []byte{0xE8},
+			expected: []busAccess{
+				{0x8000, 0xE8, false},
+				{0x8001, 0x00, false},
+			},
+		},
+		{
+			name:    "BNE page cross",
+			program: []byte{0xD0, 0x80},
+			expected: []busAccess{
+				{0x8000, 0xD0, false},
+				{0x8001, 0x80, false},
+				{0x8002, 0x00, false},
+				{0x8082, 0x00, false},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		c, cart := createAccurateCpu(cpu.Variant2A03)
+		c.Registers.PC = 0x8000
+		c.Registers.X = test.x
+		c.Registers.Y = test.y
+		c.Registers.P.Write(0)
+		copy(cart.data[0x8000:], test.program)
+		cart.data[0x9000] = 0x41
+
+		c.Excute()
+
+		assert.Equal(t, test.expected, cart.accesses, test.name)
+		assert.Equal(t, len(test.expected), c.Cycles, test.name)
+	}
+}
+
+func TestLoadPageCross(t *testing.T) {
+	testCases := []struct {
+		name    string
+		program []byte
+		index   byte
+		cycles  int
+	}{
+		{"LDA oper,X", []byte{0xBD, 0x10, 0x90}, 0x01, 4},
+		{"LDA oper,X page cross", []byte{0xBD, 0xF0, 0x90}, 0x20, 5},
+		{"LDA oper,Y", []byte{0xB9, 0x10, 0x90}, 0x01, 4},
+		{"LDA oper,Y page cross", []byte{0xB9, 0xF0, 0x90}, 0x20, 5},
+		// The pointer at $10 is $90F0
+		{"LDA (oper),Y", []byte{0xB1, 0x10}, 0x01, 5},
+		{"LDA (oper),Y page cross", []byte{0xB1, 0x10}, 0x20, 6},
+	}
+
+	for _, accurate := range []bool{false, true} {
+		for _, test := range testCases {
+			c, cart := createAccurateCpu(cpu.Variant2A03)
+			c.CycleAccurate = accurate
+			c.Registers.PC = 0x8000
+			c.Registers.X = test.index
+			c.Registers.Y = test.index
+			copy(cart.data[0x8000:], test.program)
+			mem(c).WriteByteAt(0x10, 0xF0)
+			mem(c).WriteByteAt(0x11, 0x90)
+
+			assert.NoError(t, c.Excute(), test.name)
+			assert.Equal(t, test.cycles, c.Cycles, "%s accurate %v", test.name, accurate)
+		}
+	}
+}
+
+func TestCycleAccurateMatchesFast(t *testing.T) {
+	for _, variant := range []cpu.Variant{cpu.Variant2A03, cpu.VariantNmos6502, cpu.Variant65C02} {
+		testCycleAccurateMatchesFast(t, variant)
+	}
+}
+
+func testCycleAccurateMatchesFast(t *testing.T, variant cpu.Variant) {
+	for opcode := 0; opcode < 0x100; opcode++ {
+		for _, index := range []byte{0x01, 0xF0} {
+			for _, p := range []byte{0x00, 0xFF} {
+				cycles := [2]int{}
+				for i, accurate := range []bool{false, true} {
+					c, cart := createAccurateCpu(variant)
+					c.CycleAccurate = accurate
+					c.Registers.PC = 0x8000
+					c.Registers.X = index
+					c.Registers.Y = index
+					c.Registers.P.Write(p)
+					for address := 0x4020; address < 0x10000; address++ {
+						cart.data[address] = 0x90
+					}
+					cart.data[0x8000] = byte(opcode)
+
+					c.Excute()
+
+					cycles[i] = c.Cycles
+				}
+
+				assert.Equalf(t, cycles[0], cycles[1], "%s Opcode %02X index %02X P %02X", variant, opcode, index, p)
+			}
+		}
+	}
+}
+
+// benchmarkProgram loops over a mix of loads, stores, maths and branches
+var benchmarkProgram = []byte{
+	0xA2, 0x00, // 0200 LDX #$00
+	0xB5, 0x10, // 0202 LDA $10,X
+	0x69, 0x01, // 0204 ADC #$01
+	0x9D, 0x00, 0x03, // 0206 STA $0300,X
+	0xE8,       // 0209 INX
+	0xD0, 0xF6, // 020A BNE $0202
+	0x4C, 0x00, 0x02, // 020C JMP $0200
+}
+
+func createBenchmarkCpu(accurate bool) *cpu.Cpu {
+	ram := &cpu.Ram{}
+	ram.WriteBytes(0x0200, benchmarkProgram)
+	c := cpu.CreateCpu(ram)
+	c.CycleAccurate = accurate
+	c.Tick = func() {}
+	c.Registers.PC = 0x0200
+	return c
+}
+
+func TestExcuteDoesNotAllocate(t *testing.T) {
+	for _, accurate := range []bool{false, true} {
+		c := createBenchmarkCpu(accurate)
+		assert.Zero(t, testing.AllocsPerRun(1000, func() {
+			c.Excute()
+		}))
+	}
+}
+
+func BenchmarkExcute(b *testing.B) {
+	for _, accurate := range []bool{false, true} {
+		name := "Fast"
+		if accurate {
+			name = "CycleAccurate"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			c := createBenchmarkCpu(accurate)
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				c.Excute()
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "instructions/s")
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cpu
+
+// InstructionHook sees the instruction at pc. Before hooks run ahead of the
+// opcode fetch and can change registers, PC included. After hooks run once
+// the instruction has finished.
+type InstructionHook func(c *Cpu, pc uint16, operation *Operation)
+
+// InterruptHook sees the NMI, IRQ and reset sequences once they've run. from
+// is the PC that was interrupted and vector the one the CPU jumped through,
+// BRK goes through the instruction hooks instead.
+type InterruptHook func(c *Cpu, from uint16, vector uint16)
+
+// Hook identifies a registered hook so it can be removed
+type Hook int
+
+// registeredHook is either kind of hook, they share the add and remove code
+type registeredHook struct {
+	id          Hook
+	instruction InstructionHook
+	interrupt   InterruptHook
+}
+
+// hooks are copied on change so a hook can add or remove hooks while they're
+// being run
+type hooks struct {
+	next      Hook
+	before    []registeredHook
+	after     []registeredHook
+	interrupt []registeredHook
+}
+
+func (h *hooks) add(list []registeredHook, hook registeredHook) ([]registeredHook, Hook) {
+	h.next++
+	hook.id = h.next
+	result := make([]registeredHook, len(list), len(list)+1)
+	copy(result, list)
+	return append(result, hook), h.next
+}
+
+func removeHook(list []registeredHook, id Hook) []registeredHook {
+	for i, hook := range list {
+		if hook.id != id {
+			continue
+		}
+		if len(list) == 1 {
+			return nil
+		}
+
+		result := make([]registeredHook, 0, len(list)-1)
+		result = append(result, list[:i]...)
+		return append(result, list[i+1:]...)
+	}
+
+	return list
+}
+
+func runHooks(list []registeredHook, c *Cpu, pc uint16, operation *Operation) {
+	for _, hook := range list {
+		hook.instruction(c, pc, operation)
+	}
+}
+
+func (c *Cpu) AddBeforeHook(hook InstructionHook) Hook {
+	var id Hook
+	c.hooks.before, id = c.hooks.add(c.hooks.before, registeredHook{instruction: hook})
+	return id
+}
+
+func (c *Cpu) AddAfterHook(hook InstructionHook) Hook {
+	var id Hook
+	c.hooks.after, id = c.hooks.add(c.hooks.after, registeredHook{instruction: hook})
+	return id
+}
+
+func (c *Cpu) AddInterruptHook(hook InterruptHook) Hook {
+	var id Hook
+	c.hooks.interrupt, id = c.hooks.add(c.hooks.interrupt, registeredHook{interrupt: hook})
+	return id
+}
+
+// RemoveHook does nothing if the hook was already removed
+func (c *Cpu) RemoveHook(id Hook) {
+	c.hooks.before = removeHook(c.hooks.before, id)
+	c.hooks.after = removeHook(c.hooks.after, id)
+	c.hooks.interrupt = removeHook(c.hooks.interrupt, id)
+}
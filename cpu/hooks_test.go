@@ -0,0 +1,101 @@
+package cpu_test
+
+import (
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstructionHooks(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	// LDA #$01; LDX #$02; NOP
+	ram.WriteBytes(0x0200, []byte{0xA9, 0x01, 0xA2, 0x02, 0xEA})
+
+	type call struct {
+		pc   uint16
+		name string
+		a    byte
+	}
+	var before, after []call
+
+	beforeId := c.AddBeforeHook(func(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+		before = append(before, call{pc, operation.Name, c.Registers.A})
+	})
+	afterId := c.AddAfterHook(func(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+		after = append(after, call{pc, operation.Name, c.Registers.A})
+	})
+
+	c.Excute()
+	assert.Equal(t, []call{{0x0200, "LDA #oper", 0x00}}, before)
+	assert.Equal(t, []call{{0x0200, "LDA #oper", 0x01}}, after)
+
+	c.RemoveHook(beforeId)
+	c.Excute()
+	assert.Len(t, before, 1)
+	assert.Equal(t, call{0x0202, "LDX #oper", 0x01}, after[1])
+
+	c.RemoveHook(afterId)
+	c.RemoveHook(afterId)
+	c.Excute()
+	assert.Len(t, after, 2)
+}
+
+func TestBeforeHookChangesPc(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	// LDA #$01 skipped over to LDA #$02
+	ram.WriteBytes(0x0200, []byte{0xA9, 0x01, 0xA9, 0x02})
+
+	var id cpu.Hook
+	id = c.AddBeforeHook(func(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+		c.Registers.PC = 0x0202
+		c.RemoveHook(id)
+	})
+
+	c.Excute()
+	assert.Equal(t, byte(0x02), c.Registers.A)
+	assert.Equal(t, uint16(0x0204), c.Registers.PC)
+
+	// Removed itself
+	c.Registers.PC = 0x0200
+	c.Excute()
+	assert.Equal(t, byte(0x01), c.Registers.A)
+}
+
+func TestInterruptHook(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	ram.WriteBytes(cpu.NmiVector, []byte{0x00, 0x03, 0x00, 0x04})
+
+	type call struct {
+		from   uint16
+		vector uint16
+		pc     uint16
+	}
+	var calls []call
+	id := c.AddInterruptHook(func(c *cpu.Cpu, from uint16, vector uint16) {
+		calls = append(calls, call{from, vector, c.Registers.PC})
+	})
+
+	c.SetNmi(true)
+	c.Excute()
+	c.Reset()
+	c.Excute()
+	assert.Equal(t, []call{{0x0200, cpu.NmiVector, 0x0300}, {0x0300, cpu.ResetVector, 0x0400}}, calls)
+
+	c.RemoveHook(id)
+	c.Reset()
+	c.Excute()
+	assert.Len(t, calls, 2)
+}
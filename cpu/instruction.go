@@ -2,7 +2,6 @@ package cpu
 
 import (
 	"fmt"
-	"math"
 
 	nesmath "github.com/sardap/gos/math"
 )
@@ -33,13 +32,32 @@ func (a AddressMode) String() string {
 		return "IndirectY"
 	case AddressModeAccumulator:
 		return "Accumulator"
+	case AddressModeRelative:
+		return "Relative"
 	case AddressModeImplied:
 		return "Implied"
+	case AddressModeZeroPageIndirect:
+		return "ZeroPageIndirect"
+	case AddressModeAbsoluteIndirectX:
+		return "AbsoluteIndirectX"
 	}
 
 	panic(fmt.Errorf("unkown addressMode string"))
 }
 
+// OperandLength is the number of bytes after the opcode
+func (a AddressMode) OperandLength() uint16 {
+	switch a {
+	case AddressModeAbsolute, AddressModeAbsoluteX, AddressModeAbsoluteY, AddressModeIndirect,
+		AddressModeAbsoluteIndirectX:
+		return 2
+	case AddressModeAccumulator, AddressModeImplied:
+		return 0
+	}
+
+	return 1
+}
+
 const (
 	AddressModeImmediate AddressMode = iota
 	AddressModeZeroPage
@@ -54,6 +72,9 @@ const (
 	AddressModeAccumulator
 	AddressModeRelative
 	AddressModeImplied
+	// 65C02 only
+	AddressModeZeroPageIndirect
+	AddressModeAbsoluteIndirectX
 	AddressModeLength
 )
 
@@ -67,10 +88,30 @@ type Operation struct {
 	AddressMode AddressMode
 }
 
+// unstableMagic is the value XAA and LXA OR with A, it depends on the chip
+// and temperature but 0xEE is what most tests expect
+const unstableMagic = 0xEE
+
+// opcodeTable is what the CPU dispatches through, nil where the opcode
+// isn't decoded
+type opcodeTable [0x100]*Operation
+
 var (
-	opcodes map[byte]*Operation
+	opcodes     map[byte]*Operation
+	cmosOpcodes map[byte]*Operation
+
+	nmosTable *opcodeTable
+	cmosTable *opcodeTable
 )
 
+func createOpcodeTable(operations map[byte]*Operation) *opcodeTable {
+	result := &opcodeTable{}
+	for opcode, operation := range operations {
+		result[opcode] = operation
+	}
+	return result
+}
+
 func init() {
 	opcodes = map[byte]*Operation{
 		// Adc A + M + C -> A, C
@@ -114,7 +155,7 @@ func init() {
 		// Branch on Result Plus
 		0x10: {Inst: Bpl, Length: 2, MinCycles: 2, AddressMode: AddressModeRelative, Name: "BPL oper"},
 		// interrupt; push PC+2; push SR
-		0x00: {Inst: Brk, Length: 1, MinCycles: 7, AddressMode: AddressModeImplied, Name: "BRK"},
+		0x00: {Inst: Brk, Length: 0, MinCycles: 7, AddressMode: AddressModeImplied, Name: "BRK"},
 		// Branch on Overflow Clear
 		0x50: {Inst: Bvc, Length: 2, MinCycles: 2, AddressMode: AddressModeRelative, Name: "BVC oper"},
 		// Branch on Overflow Set
@@ -290,15 +331,15 @@ func init() {
 		 http://nesdev.com/undocumented_opcodes.txt
 		*/
 		// DOP Double Nop
-		0x04: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeImplied, Name: "*NOP"},
-		0x44: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeImplied, Name: "*NOP"},
-		0x64: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeImplied, Name: "*NOP"},
-		0x34: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
-		0x54: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
-		0x74: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
-		0xD4: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
-		0xF4: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
-		0x14: {Inst: Nop, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0x04: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "*NOP"},
+		0x44: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "*NOP"},
+		0x64: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "*NOP"},
+		0x34: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0x54: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0x74: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0xD4: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0xF4: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
+		0x14: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP"},
 		0x1A: {Inst: Nop, Length: 1, MinCycles: 2, AddressMode: AddressModeImplied, Name: "*NOP"},
 		0x3A: {Inst: Nop, Length: 1, MinCycles: 2, AddressMode: AddressModeImplied, Name: "*NOP"},
 		0x5A: {Inst: Nop, Length: 1, MinCycles: 2, AddressMode: AddressModeImplied, Name: "*NOP"},
@@ -306,14 +347,18 @@ func init() {
 		0xDA: {Inst: Nop, Length: 1, MinCycles: 2, AddressMode: AddressModeImplied, Name: "*NOP"},
 		0xFA: {Inst: Nop, Length: 1, MinCycles: 2, AddressMode: AddressModeImplied, Name: "*NOP"},
 		0x80: {Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP"},
-		0x1C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsolute, Name: "*NOP"},
+		0x82: {Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP"},
+		0x89: {Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP"},
+		0xC2: {Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP"},
+		0xE2: {Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP"},
+		0x1C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		0x3C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		0x5C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		0x7C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		0xDC: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		0xFC: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "*NOP"},
 		// SKW Skip word
-		0x0C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeImplied, Name: "*NOP"},
+		0x0C: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsolute, Name: "*NOP"},
 		// LAX M -> A; M -> X
 		0xA7: {Inst: Lax, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "LAX oper"},
 		0xB7: {Inst: Lax, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageY, Name: "LAX oper,Y"},
@@ -376,25 +421,80 @@ func init() {
 		0x7B: {Inst: Rra, Length: 3, MinCycles: 7, AddressMode: AddressModeAbsoluteY, Name: "RRA oper,Y"},
 		0x63: {Inst: Rra, Length: 2, MinCycles: 8, AddressMode: AddressModeIndirectX, Name: "RRA (oper,X)"},
 		0x73: {Inst: Rra, Length: 2, MinCycles: 8, AddressMode: AddressModeIndirectY, Name: "RRA (oper),Y"},
+		// ANC A AND oper, bit(7) -> C
+		0x0B: {Inst: Anc, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "ANC #oper"},
+		0x2B: {Inst: Anc, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "ANC #oper"},
+		// ALR AND; LSR A
+		0x4B: {Inst: Alr, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "ALR #oper"},
+		// ARR AND; ROR A
+		0x6B: {Inst: Arr, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "ARR #oper"},
+		// AXS (A AND X) - oper -> X
+		0xCB: {Inst: Axs, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "AXS #oper"},
+		// LAS M AND SP -> A, X, SP
+		0xBB: {Inst: Las, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteY, Name: "LAS oper,Y"},
+		// SHA A AND X AND (H+1) -> M
+		0x9F: {Inst: Sha, Length: 3, MinCycles: 5, AddressMode: AddressModeAbsoluteY, Name: "SHA oper,Y"},
+		0x93: {Inst: Sha, Length: 2, MinCycles: 6, AddressMode: AddressModeIndirectY, Name: "SHA (oper),Y"},
+		// SHX X AND (H+1) -> M
+		0x9E: {Inst: Shx, Length: 3, MinCycles: 5, AddressMode: AddressModeAbsoluteY, Name: "SHX oper,Y"},
+		// SHY Y AND (H+1) -> M
+		0x9C: {Inst: Shy, Length: 3, MinCycles: 5, AddressMode: AddressModeAbsoluteX, Name: "SHY oper,X"},
+		// TAS A AND X -> SP, A AND X AND (H+1) -> M
+		0x9B: {Inst: Tas, Length: 3, MinCycles: 5, AddressMode: AddressModeAbsoluteY, Name: "TAS oper,Y"},
+		// XAA (A OR CONST) AND X AND oper -> A
+		0x8B: {Inst: Xaa, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "XAA #oper"},
+		// LXA (A OR CONST) AND oper -> A, X
+		0xAB: {Inst: Lxa, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "LXA #oper"},
+		// JAM freeze the CPU until reset
+		0x02: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x12: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x22: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x32: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x42: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x52: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x62: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x72: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0x92: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0xB2: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0xD2: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
+		0xF2: {Inst: Jam, Length: 0, MinCycles: 2, AddressMode: AddressModeImplied, Name: "JAM"},
 	}
+
+	cmosOpcodes = createCmosOpcodes()
+
+	nmosTable = createOpcodeTable(opcodes)
+	cmosTable = createOpcodeTable(cmosOpcodes)
 }
 
+// GetOpcodes is the 2A03 table
 func GetOpcodes() map[byte]*Operation {
 	return opcodes
 }
 
-func samePage(a, b uint16) bool {
-	return 256/math.Max(1, float64(a)) != 256/math.Max(1, float64(b))
+// GetVariantOpcodes the NMOS chips share a table, decimal mode is decided
+// when ADC and SBC run
+func GetVariantOpcodes(variant Variant) map[byte]*Operation {
+	switch variant {
+	case Variant65C02:
+		return cmosOpcodes
+	}
+
+	return opcodes
 }
 
-func overflowHappend(left, right, result byte) bool {
-	if int8(left) > 0 && int8(right) > 0 {
-		return nesmath.BitSet(result, 7)
-	} else if int8(left) < 0 && int8(right) < 0 {
-		return !nesmath.BitSet(result, 7)
+func variantOpcodeTable(variant Variant) *opcodeTable {
+	switch variant {
+	case Variant65C02:
+		return cmosTable
 	}
 
-	return false
+	return nmosTable
+}
+
+// Both inputs have the same sign and the result doesn't, zero counts as
+// positive
+func overflowHappend(left, right, result byte) bool {
+	return nesmath.BitSet((left^result)&(right^result), 7)
 }
 
 func postiveCarryHappend(result uint16) bool {
@@ -415,8 +515,19 @@ func zeroHappend(result uint16) bool {
 }
 
 func Adc(c *Cpu, mode AddressMode) {
-	oprand := c.ReadByteByMode(mode)
+	adc(c, c.ReadByteByMode(mode))
+}
+
+func adc(c *Cpu, oprand byte) {
+	if c.decimal() {
+		decimalAdc(c, oprand)
+		return
+	}
+
+	binaryAdc(c, oprand)
+}
 
+func binaryAdc(c *Cpu, oprand byte) {
 	a := c.Registers.A
 	carry := uint16(c.Registers.P.ReadFlagByte(FlagCarry))
 	result := uint16(a) + uint16(oprand) + carry
@@ -430,8 +541,10 @@ func Adc(c *Cpu, mode AddressMode) {
 }
 
 func And(c *Cpu, mode AddressMode) {
-	oprand := c.ReadByteByMode(mode)
+	and(c, c.ReadByteByMode(mode))
+}
 
+func and(c *Cpu, oprand byte) {
 	a := c.Registers.A
 	result := uint16(a & oprand)
 
@@ -442,29 +555,36 @@ func And(c *Cpu, mode AddressMode) {
 }
 
 func Asl(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, asl(c, operand))
+}
 
+func asl(c *Cpu, operand byte) byte {
 	result := uint16(operand) << 1
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
 	c.Registers.P.SetFlag(FlagZero, zeroHappend(result))
 	c.Registers.P.SetFlag(FlagCarry, postiveCarryHappend(result))
 
-	c.WriteByteByMode(mode, byte(result))
+	return byte(result)
 }
 
+// The offset is relative to the next instruction, taking the branch costs a
+// cycle and crossing into a new page costs another
 func branchOnFlag(c *Cpu, flag bool) {
-	orginalAddress := c.Registers.PC
+	offset := c.read(c.Registers.PC + 1)
 	if flag {
-		c.Registers.PC += uint16(int8(c.Memory.ReadByteAt(c.Registers.PC + 1)))
+		next := c.Registers.PC + 2
+		target := next + uint16(int8(offset))
 
-		oldPage := orginalAddress / 256
-		newPage := c.Registers.PC / 256
-		if oldPage == newPage {
+		c.dummyRead(next)
+		c.ExtraCycles++
+		if pageCrossed(next, target) {
+			c.dummyRead(next&0xFF00 | target&0x00FF)
 			c.ExtraCycles++
-		} else {
-			c.ExtraCycles += 2
 		}
+
+		c.Registers.PC = target - 2
 	}
 }
 
@@ -493,9 +613,7 @@ func Bpl(c *Cpu, mode AddressMode) {
 }
 
 func Brk(c *Cpu, mode AddressMode) {
-	c.PushUint16(c.Registers.PC + 2)
-	c.PushP()
-	c.Interupt = true
+	c.interrupt(c.Registers.PC+2, IrqVector, true)
 }
 
 func Bvc(c *Cpu, mode AddressMode) {
@@ -509,6 +627,12 @@ func Bvs(c *Cpu, mode AddressMode) {
 func Bit(c *Cpu, mode AddressMode) {
 	operand := c.ReadByteByMode(mode)
 
+	// 65C02 BIT #oper
+	if mode == AddressModeImmediate {
+		c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(c.Registers.A&operand)))
+		return
+	}
+
 	c.Registers.P.SetFlag(FlagNegative, nesmath.BitSet(operand, 7))
 	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(c.Registers.A&operand)))
 	c.Registers.P.SetFlag(FlagOverflow, nesmath.BitSet(operand, 6))
@@ -535,8 +659,10 @@ func Clv(c *Cpu, mode AddressMode) {
 }
 
 func compare(c *Cpu, mode AddressMode, reg uint8) {
-	operand := c.ReadByteByMode(mode)
+	compareValue(c, reg, c.ReadByteByMode(mode))
+}
 
+func compareValue(c *Cpu, reg, operand uint8) {
 	result := uint16(reg) - uint16(operand)
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
@@ -566,9 +692,8 @@ func decerment(c *Cpu, value uint8) uint8 {
 }
 
 func Dec(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
-	result := decerment(c, operand)
-	c.WriteByteByMode(mode, result)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, decerment(c, operand))
 }
 
 func Dex(c *Cpu, mode AddressMode) {
@@ -580,14 +705,16 @@ func Dey(c *Cpu, mode AddressMode) {
 }
 
 func Eor(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
+	eor(c, c.ReadByteByMode(mode))
+}
 
+func eor(c *Cpu, operand byte) {
 	result := c.Registers.A ^ operand
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
 	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(result)))
 
-	c.Registers.A ^= operand
+	c.Registers.A = result
 }
 
 func incerment(c *Cpu, value uint8) uint8 {
@@ -600,9 +727,8 @@ func incerment(c *Cpu, value uint8) uint8 {
 }
 
 func Inc(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
-	result := incerment(c, operand)
-	c.WriteByteByMode(mode, result)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, incerment(c, operand))
 }
 
 func Inx(c *Cpu, mode AddressMode) {
@@ -618,9 +744,12 @@ func Jmp(c *Cpu, mode AddressMode) {
 }
 
 // Jsr trick https://wiki.nesdev.com/w/index.php/RTS_Trick
+// The high byte of the target is only read after the return address is pushed
 func Jsr(c *Cpu, mode AddressMode) {
+	low := c.read(c.Registers.PC + 1)
+	c.dummyRead(c.stackAddress())
 	c.PushUint16(c.Registers.PC + 2)
-	c.Registers.PC = c.GetOprandAddress(mode)
+	c.Registers.PC = uint16(low) | uint16(c.read(c.Registers.PC+2))<<8
 }
 
 func Lda(c *Cpu, mode AddressMode) {
@@ -648,8 +777,11 @@ func Ldy(c *Cpu, mode AddressMode) {
 }
 
 func Lsr(c *Cpu, mode AddressMode) {
-	oprand := c.ReadByteByMode(mode)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, lsr(c, operand))
+}
 
+func lsr(c *Cpu, oprand byte) byte {
 	result := uint16(oprand) >> 1
 
 	c.Registers.P.SetFlag(FlagNegative, false)
@@ -657,15 +789,23 @@ func Lsr(c *Cpu, mode AddressMode) {
 	// this isn't a mistake
 	c.Registers.P.SetFlag(FlagCarry, oprand&0x01 != 0)
 
-	c.WriteByteByMode(mode, byte(result))
+	return byte(result)
 }
 
+// The unofficial NOPs with an operand still do the read
 func Nop(c *Cpu, mode AddressMode) {
+	switch mode {
+	case AddressModeImplied:
+	default:
+		c.ReadByteByMode(mode)
+	}
 }
 
 func Ora(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
+	ora(c, c.ReadByteByMode(mode))
+}
 
+func ora(c *Cpu, operand byte) {
 	result := c.Registers.A | operand
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
@@ -679,10 +819,11 @@ func Pha(c *Cpu, mode AddressMode) {
 }
 
 func Php(c *Cpu, mode AddressMode) {
-	c.PushP()
+	c.PushP(true)
 }
 
 func Pla(c *Cpu, mode AddressMode) {
+	c.dummyRead(c.stackAddress())
 	a := c.PopByte()
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(a)))
@@ -692,57 +833,67 @@ func Pla(c *Cpu, mode AddressMode) {
 }
 
 func Plp(c *Cpu, mode AddressMode) {
+	c.dummyRead(c.stackAddress())
 	c.PopP()
 }
 
 func Rol(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, rol(c, operand))
+}
 
+func rol(c *Cpu, operand byte) byte {
 	result := (uint16(operand) << 1) | uint16(c.Registers.P.ReadFlagByte(FlagCarry))
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
 	c.Registers.P.SetFlag(FlagZero, zeroHappend(result))
 	c.Registers.P.SetFlag(FlagCarry, postiveCarryHappend(result))
 
-	c.WriteByteByMode(mode, byte(result))
+	return byte(result)
 }
 
 func Ror(c *Cpu, mode AddressMode) {
-	operand := c.ReadByteByMode(mode)
+	address, operand := c.readModify(mode)
+	c.writeModified(mode, address, operand, ror(c, operand))
+}
 
+func ror(c *Cpu, operand byte) byte {
 	result := (uint16(operand) >> 1) | uint16(c.Registers.P.ReadFlagByte(FlagCarry)<<7)
 
 	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
 	c.Registers.P.SetFlag(FlagZero, zeroHappend(result))
 	c.Registers.P.SetFlag(FlagCarry, nesmath.BitSet(operand, 0))
 
-	c.WriteByteByMode(mode, byte(result))
+	return byte(result)
 }
 
+// Rti undoes interrupt
 func Rti(c *Cpu, mode AddressMode) {
+	c.dummyRead(c.stackAddress())
 	c.PopP()
 	c.Registers.PC = c.PopUint16()
 }
 
 func Rts(c *Cpu, mode AddressMode) {
-	c.Registers.PC = c.PopUint16() + 1
+	c.dummyRead(c.stackAddress())
+	c.Registers.PC = c.PopUint16()
+	c.dummyRead(c.Registers.PC)
+	c.Registers.PC++
 }
 
 func Sbc(c *Cpu, mode AddressMode) {
-	// Fucking stole this what the fuck is this shit
-	// Adding to minus too much big brains me think
-	oprand := c.ReadByteByMode(mode) ^ 0xFF
-
-	a := c.Registers.A
-	carry := uint16(c.Registers.P.ReadFlagByte(FlagCarry))
-	result := uint16(a) + uint16(oprand) + carry
+	sbc(c, c.ReadByteByMode(mode))
+}
 
-	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
-	c.Registers.P.SetFlag(FlagZero, zeroHappend(result))
-	c.Registers.P.SetFlag(FlagCarry, postiveCarryHappend(result))
-	c.Registers.P.SetFlag(FlagOverflow, overflowHappend(a, oprand, byte(result)))
+func sbc(c *Cpu, operand byte) {
+	if c.decimal() {
+		decimalSbc(c, operand)
+		return
+	}
 
-	c.Registers.A = byte(result)
+	// Fucking stole this what the fuck is this shit
+	// Adding to minus too much big brains me think
+	adc(c, operand^0xFF)
 }
 
 func Sec(c *Cpu, mode AddressMode) {
@@ -843,34 +994,171 @@ func Aax(c *Cpu, mode AddressMode) {
 }
 
 func Dcp(c *Cpu, mode AddressMode) {
-	Dec(c, mode)
-	Cmp(c, mode)
+	address, operand := c.readModify(mode)
+	result := decerment(c, operand)
+	c.writeModified(mode, address, operand, result)
+	compareValue(c, c.Registers.A, result)
 }
 
 // ISB INS
 func Isc(c *Cpu, mode AddressMode) {
-	Inc(c, mode)
-	Sbc(c, mode)
+	address, operand := c.readModify(mode)
+	result := incerment(c, operand)
+	c.writeModified(mode, address, operand, result)
+	sbc(c, result)
 }
 
 // ASD
 func Slo(c *Cpu, mode AddressMode) {
-	Asl(c, mode)
-	Ora(c, mode)
+	address, operand := c.readModify(mode)
+	result := asl(c, operand)
+	c.writeModified(mode, address, operand, result)
+	ora(c, result)
 }
 
 func Rla(c *Cpu, mode AddressMode) {
-	Rol(c, mode)
-	And(c, mode)
+	address, operand := c.readModify(mode)
+	result := rol(c, operand)
+	c.writeModified(mode, address, operand, result)
+	and(c, result)
 }
 
 // LSA
 func Sre(c *Cpu, mode AddressMode) {
-	Lsr(c, mode)
-	Eor(c, mode)
+	address, operand := c.readModify(mode)
+	result := lsr(c, operand)
+	c.writeModified(mode, address, operand, result)
+	eor(c, result)
 }
 
 func Rra(c *Cpu, mode AddressMode) {
-	Ror(c, mode)
-	Adc(c, mode)
+	address, operand := c.readModify(mode)
+	result := ror(c, operand)
+	c.writeModified(mode, address, operand, result)
+	adc(c, result)
+}
+
+func Anc(c *Cpu, mode AddressMode) {
+	And(c, mode)
+	c.Registers.P.SetFlag(FlagCarry, c.Registers.P.ReadFlag(FlagNegative))
+}
+
+// ASR
+func Alr(c *Cpu, mode AddressMode) {
+	And(c, mode)
+	c.Registers.A = lsr(c, c.Registers.A)
+}
+
+// ARR sets C and V from bits 6 and 5 of the result instead of the usual ROR
+func Arr(c *Cpu, mode AddressMode) {
+	And(c, mode)
+	c.Registers.A = ror(c, c.Registers.A)
+
+	result := c.Registers.A
+	c.Registers.P.SetFlag(FlagCarry, nesmath.BitSet(result, 6))
+	c.Registers.P.SetFlag(FlagOverflow, nesmath.BitSet(result, 6) != nesmath.BitSet(result, 5))
+}
+
+// SBX
+func Axs(c *Cpu, mode AddressMode) {
+	operand := c.ReadByteByMode(mode)
+
+	ax := c.Registers.A & c.Registers.X
+	result := ax - operand
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(result)))
+	c.Registers.P.SetFlag(FlagCarry, cmpCarryHappend(ax, operand))
+
+	c.Registers.X = result
+}
+
+// LAR
+func Las(c *Cpu, mode AddressMode) {
+	result := c.ReadByteByMode(mode) & c.Registers.SP
+
+	c.Registers.A = result
+	c.Registers.X = result
+	c.Registers.SP = result
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(result)))
+}
+
+// unstableStore is shared by SHA, SHX, SHY and TAS. The value is ANDed with
+// the high byte of the base address plus one and when the index crosses a
+// page that value also replaces the high byte of the address.
+func unstableStore(c *Cpu, mode AddressMode, value byte) {
+	var base uint16
+	var index byte
+
+	switch mode {
+	case AddressModeAbsoluteX:
+		base = c.readUint16(c.Registers.PC + 1)
+		index = c.Registers.X
+	case AddressModeAbsoluteY:
+		base = c.readUint16(c.Registers.PC + 1)
+		index = c.Registers.Y
+	case AddressModeIndirectY:
+		pointer := c.read(c.Registers.PC + 1)
+		base = uint16(c.read(uint16(pointer))) | uint16(c.read(uint16(pointer+1)))<<8
+		index = c.Registers.Y
+	default:
+		panic(fmt.Errorf("address mode not implmented"))
+	}
+
+	address := c.indexed(base, index, true)
+	value &= byte(base>>8) + 1
+	if pageCrossed(base, address) {
+		address = uint16(value)<<8 | address&0x00FF
+	}
+
+	c.write(address, value)
+}
+
+// AHX AXA
+func Sha(c *Cpu, mode AddressMode) {
+	unstableStore(c, mode, c.Registers.A&c.Registers.X)
+}
+
+// SXA XAS
+func Shx(c *Cpu, mode AddressMode) {
+	unstableStore(c, mode, c.Registers.X)
+}
+
+// SYA SAY
+func Shy(c *Cpu, mode AddressMode) {
+	unstableStore(c, mode, c.Registers.Y)
+}
+
+// SHS XAS
+func Tas(c *Cpu, mode AddressMode) {
+	c.Registers.SP = c.Registers.A & c.Registers.X
+	unstableStore(c, mode, c.Registers.SP)
+}
+
+// ANE
+func Xaa(c *Cpu, mode AddressMode) {
+	result := (c.Registers.A | unstableMagic) & c.Registers.X & c.ReadByteByMode(mode)
+
+	c.Registers.A = result
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(result)))
+}
+
+// ATX LAX immediate
+func Lxa(c *Cpu, mode AddressMode) {
+	result := (c.Registers.A | unstableMagic) & c.ReadByteByMode(mode)
+
+	c.Registers.A = result
+	c.Registers.X = result
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(result)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(result)))
+}
+
+// KIL HLT the CPU stops fetching until it is reset
+func Jam(c *Cpu, mode AddressMode) {
+	c.Halted = true
 }
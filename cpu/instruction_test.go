@@ -8,7 +8,6 @@ import (
 
 	"github.com/sardap/gos/cpu"
 	"github.com/sardap/gos/memory"
-	"github.com/sardap/gos/ppu"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,20 +23,26 @@ func (c *testCart) WriteBytesChr(value []byte) error {
 	return nil
 }
 
-func (c *testCart) WriteByteAt(address uint16, value byte) {
+func (c *testCart) WriteByteAt(address uint16, value byte) error {
 	c.data[address] = value
+	return nil
 }
 
-func (c *testCart) ReadByteAt(address uint16) byte {
-	return c.data[address]
+func (c *testCart) ReadByteAt(address uint16) (byte, error) {
+	return c.data[address], nil
 }
 
 func createCpu() *cpu.Cpu {
-	result := cpu.CreateCpu(memory.Create(), ppu.Create())
-	result.Memory.SetCart(&testCart{})
+	result := cpu.CreateCpu(memory.Create())
+	mem(result).SetCart(&testCart{})
 	return result
 }
 
+// mem is the NES memory the test CPUs are created with
+func mem(c *cpu.Cpu) *memory.Memory {
+	return c.Bus.(*memory.Memory)
+}
+
 type writeFunc func(c *cpu.Cpu, mode cpu.AddressMode, val byte)
 type readFunc func(c *cpu.Cpu, mode cpu.AddressMode) byte
 
@@ -66,61 +71,61 @@ func writeByteToAddress(c *cpu.Cpu, mode cpu.AddressMode, val byte) {
 			switch mode {
 			case cpu.AddressModeImmediate:
 				c.Registers.PC = 0
-				c.Memory.WriteByteAt(1, val)
+				mem(c).WriteByteAt(1, val)
 
 			case cpu.AddressModeZeroPage:
 				c.Registers.PC = 0
-				c.Memory.WriteByteAt(1, 30)
-				c.Memory.WriteByteAt(30, val)
+				mem(c).WriteByteAt(1, 30)
+				mem(c).WriteByteAt(30, val)
 
 			case cpu.AddressModeZeroPageX:
 				c.Registers.PC = 0
 				c.Registers.X = 5
-				c.Memory.WriteByteAt(1, 30)
-				c.Memory.WriteByteAt(35, val)
+				mem(c).WriteByteAt(1, 30)
+				mem(c).WriteByteAt(35, val)
 
 			case cpu.AddressModeZeroPageY:
 				c.Registers.PC = 0
 				c.Registers.Y = 15
-				c.Memory.WriteByteAt(1, 30)
-				c.Memory.WriteByteAt(45, val)
+				mem(c).WriteByteAt(1, 30)
+				mem(c).WriteByteAt(45, val)
 
 			case cpu.AddressModeAbsolute:
 				c.Registers.PC = 0
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteByteAt(300, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteByteAt(300, val)
 
 			case cpu.AddressModeAbsoluteX:
 				c.Registers.PC = 0
 				c.Registers.X = 5
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteByteAt(305, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteByteAt(305, val)
 
 			case cpu.AddressModeAbsoluteY:
 				c.Registers.PC = 0
 				c.Registers.Y = 10
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteByteAt(310, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteByteAt(310, val)
 
 			case cpu.AddressModeIndirect:
 				c.Registers.PC = 0
-				c.Memory.WriteUint16At(1, 2048)
-				c.Memory.WriteUint16At(2048, 2050)
-				c.Memory.WriteByteAt(2050, val)
+				mem(c).WriteUint16At(1, 2048)
+				mem(c).WriteUint16At(2048, 2050)
+				mem(c).WriteByteAt(2050, val)
 
 			case cpu.AddressModeIndirectX:
 				c.Registers.PC = 0
 				c.Registers.X = 10
-				c.Memory.WriteByteAt(1, 20)
-				c.Memory.WriteUint16At(30, 2048)
-				c.Memory.WriteByteAt(2048, val)
+				mem(c).WriteByteAt(1, 20)
+				mem(c).WriteUint16At(30, 2048)
+				mem(c).WriteByteAt(2048, val)
 
 			case cpu.AddressModeIndirectY:
 				c.Registers.PC = 0
 				c.Registers.Y = 20
-				c.Memory.WriteByteAt(1, 20)
-				c.Memory.WriteUint16At(20, 1028)
-				c.Memory.WriteByteAt(1048, val)
+				mem(c).WriteByteAt(1, 20)
+				mem(c).WriteUint16At(20, 1028)
+				mem(c).WriteByteAt(1048, val)
 			}
 		}
 	}
@@ -135,54 +140,54 @@ func writeUint16ToAddress(c *cpu.Cpu, mode cpu.AddressMode, val uint16) {
 			switch mode {
 			case cpu.AddressModeImmediate:
 				c.Registers.PC = 0
-				c.Memory.WriteUint16At(1, val)
+				mem(c).WriteUint16At(1, val)
 
 			case cpu.AddressModeZeroPage:
 				c.Registers.PC = 0
-				c.Memory.WriteByteAt(1, 30)
-				c.Memory.WriteUint16At(30, val)
+				mem(c).WriteByteAt(1, 30)
+				mem(c).WriteUint16At(30, val)
 
 			case cpu.AddressModeZeroPageX:
 				c.Registers.PC = 0
 				c.Registers.X = 5
-				c.Memory.WriteByteAt(1, 30)
-				c.Memory.WriteUint16At(35, val)
+				mem(c).WriteByteAt(1, 30)
+				mem(c).WriteUint16At(35, val)
 
 			case cpu.AddressModeAbsolute:
 				c.Registers.PC = 0
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteUint16At(300, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteUint16At(300, val)
 
 			case cpu.AddressModeAbsoluteX:
 				c.Registers.PC = 0
 				c.Registers.X = 5
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteUint16At(305, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteUint16At(305, val)
 
 			case cpu.AddressModeAbsoluteY:
 				c.Registers.PC = 0
 				c.Registers.Y = 10
-				c.Memory.WriteUint16At(1, 300)
-				c.Memory.WriteUint16At(310, val)
+				mem(c).WriteUint16At(1, 300)
+				mem(c).WriteUint16At(310, val)
 
 			case cpu.AddressModeIndirect:
 				c.Registers.PC = 0
-				c.Memory.WriteUint16At(c.Registers.PC+1, 1000)
-				c.Memory.WriteUint16At(1000, val)
+				mem(c).WriteUint16At(c.Registers.PC+1, 1000)
+				mem(c).WriteUint16At(1000, val)
 
 			case cpu.AddressModeIndirectX:
 				c.Registers.PC = 0
 				c.Registers.X = 10
-				c.Memory.WriteByteAt(1, 20)
-				c.Memory.WriteUint16At(30, 2048)
-				c.Memory.WriteUint16At(2048, val)
+				mem(c).WriteByteAt(1, 20)
+				mem(c).WriteUint16At(30, 2048)
+				mem(c).WriteUint16At(2048, val)
 
 			case cpu.AddressModeIndirectY:
 				c.Registers.PC = 0
 				c.Registers.Y = 20
-				c.Memory.WriteByteAt(1, 20)
-				c.Memory.WriteUint16At(20, 1028)
-				c.Memory.WriteUint16At(1048, val)
+				mem(c).WriteByteAt(1, 20)
+				mem(c).WriteUint16At(20, 1028)
+				mem(c).WriteUint16At(1048, val)
 			}
 		}
 	}
@@ -193,7 +198,7 @@ func readByteFromAddress(c *cpu.Cpu, mode cpu.AddressMode) byte {
 	case cpu.AddressModeAccumulator:
 		return c.Registers.A
 	default:
-		return c.Memory.ReadByteAt(c.GetOprandAddress(mode))
+		return mem(c).ReadByteAt(c.GetOprandAddress(mode))
 	}
 }
 
@@ -356,7 +361,7 @@ func TestBranchFlags(t *testing.T) {
 		//Branch postive on same page
 		c.Registers.PC = 50
 		c.ExtraCycles = 0
-		c.Memory.WriteByteAt(c.Registers.PC+1, 0b00000011)
+		mem(c).WriteByteAt(c.Registers.PC+1, 0b00000011)
 		c.Registers.P.SetFlag(test.flag, test.valid)
 
 		test.inscut(c, cpu.AddressModeRelative)
@@ -367,7 +372,7 @@ func TestBranchFlags(t *testing.T) {
 		//Branch Negtaive on same page
 		c.Registers.PC = 50
 		c.ExtraCycles = 0
-		c.Memory.WriteByteAt(c.Registers.PC+1, 0b11111101)
+		mem(c).WriteByteAt(c.Registers.PC+1, 0b11111101)
 		c.Registers.P.SetFlag(test.flag, test.valid)
 
 		test.inscut(c, cpu.AddressModeRelative)
@@ -378,7 +383,7 @@ func TestBranchFlags(t *testing.T) {
 		//Branch to a new page
 		c.Registers.PC = 129
 		c.ExtraCycles = 0
-		c.Memory.WriteByteAt(c.Registers.PC+1, 127)
+		mem(c).WriteByteAt(c.Registers.PC+1, 127)
 		c.Registers.P.SetFlag(test.flag, test.valid)
 
 		test.inscut(c, cpu.AddressModeRelative)
@@ -389,7 +394,7 @@ func TestBranchFlags(t *testing.T) {
 		//Don't branch to a new page
 		c.Registers.PC = 5
 		c.ExtraCycles = 0
-		c.Memory.WriteByteAt(c.Registers.PC+1, 5)
+		mem(c).WriteByteAt(c.Registers.PC+1, 5)
 		c.Registers.P.SetFlag(test.flag, !test.valid)
 
 		test.inscut(c, cpu.AddressModeRelative)
@@ -746,7 +751,7 @@ func TestJmp(t *testing.T) {
 	c := createCpu()
 	c.Registers.PC = 0
 
-	c.Memory.WriteUint16At(1, 0x1312)
+	mem(c).WriteUint16At(1, 0x1312)
 
 	cpu.Jmp(c, cpu.AddressModeAbsolute)
 
@@ -766,7 +771,7 @@ func TestJsr(t *testing.T) {
 	c := createCpu()
 	c.Registers.PC = 0
 
-	c.Memory.WriteUint16At(1, 0x1312)
+	mem(c).WriteUint16At(1, 0x1312)
 
 	cpu.Jsr(c, cpu.AddressModeAbsolute)
 
@@ -780,32 +785,31 @@ func TestLd(t *testing.T) {
 	c := createCpu()
 
 	testCases := []struct {
-		mode       cpu.AddressMode
-		extraCycle bool
-		inst       cpu.Instruction
-		reg        *byte
+		mode cpu.AddressMode
+		inst cpu.Instruction
+		reg  *byte
 	}{
 		// LDA
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeImmediate, extraCycle: false},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeZeroPage, extraCycle: false},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeZeroPageX, extraCycle: false},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsolute, extraCycle: false},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsoluteX, extraCycle: true},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsoluteY, extraCycle: true},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeIndirectX, extraCycle: false},
-		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeIndirectY, extraCycle: true},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeImmediate},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeZeroPage},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeZeroPageX},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsolute},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsoluteX},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeAbsoluteY},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeIndirectX},
+		{inst: cpu.Lda, reg: &c.Registers.A, mode: cpu.AddressModeIndirectY},
 		// LDX
-		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeImmediate, extraCycle: false},
-		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeZeroPage, extraCycle: false},
-		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeZeroPageY, extraCycle: false},
-		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeAbsolute, extraCycle: false},
-		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeAbsoluteY, extraCycle: true},
+		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeImmediate},
+		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeZeroPage},
+		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeZeroPageY},
+		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeAbsolute},
+		{inst: cpu.Ldx, reg: &c.Registers.X, mode: cpu.AddressModeAbsoluteY},
 		// LDY
-		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeImmediate, extraCycle: false},
-		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeZeroPage, extraCycle: false},
-		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeZeroPageX, extraCycle: false},
-		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeAbsolute, extraCycle: false},
-		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeAbsoluteX, extraCycle: true},
+		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeImmediate},
+		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeZeroPage},
+		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeZeroPageX},
+		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeAbsolute},
+		{inst: cpu.Ldy, reg: &c.Registers.Y, mode: cpu.AddressModeAbsoluteX},
 	}
 
 	for _, test := range testCases {
@@ -821,9 +825,8 @@ func TestLd(t *testing.T) {
 		assert.Equalf(t, byte(0b00100000), *test.reg, "Address Mode %s", test.mode.String())
 		assert.Equalf(t, false, c.Registers.P.ReadFlag(cpu.FlagNegative), "Address Mode %s", test.mode.String())
 		assert.Equalf(t, false, c.Registers.P.ReadFlag(cpu.FlagZero), "Address Mode %s", test.mode.String())
-		if test.extraCycle {
-			assert.Equalf(t, byte(1), c.ExtraCycles, "Address Mode %s", test.mode.String())
-		}
+		// None of the addresses cross a page
+		assert.Equalf(t, byte(0), c.ExtraCycles, "Address Mode %s", test.mode.String())
 
 		// Load zero
 		c.ExtraCycles = 0
@@ -835,9 +838,8 @@ func TestLd(t *testing.T) {
 		assert.Equalf(t, byte(0b00000000), *test.reg, "Address Mode %s", test.mode.String())
 		assert.Equalf(t, false, c.Registers.P.ReadFlag(cpu.FlagNegative), "Address Mode %s", test.mode.String())
 		assert.Equalf(t, true, c.Registers.P.ReadFlag(cpu.FlagZero), "Address Mode %s", test.mode.String())
-		if test.extraCycle {
-			assert.Equalf(t, byte(1), c.ExtraCycles, "Address Mode %s", test.mode.String())
-		}
+		// None of the addresses cross a page
+		assert.Equalf(t, byte(0), c.ExtraCycles, "Address Mode %s", test.mode.String())
 
 		// Neg load
 		c.ExtraCycles = 0
@@ -849,9 +851,8 @@ func TestLd(t *testing.T) {
 		assert.Equalf(t, byte(0b10000000), *test.reg, "Address Mode %s", test.mode.String())
 		assert.Equalf(t, true, c.Registers.P.ReadFlag(cpu.FlagNegative), "Address Mode %s", test.mode.String())
 		assert.Equalf(t, false, c.Registers.P.ReadFlag(cpu.FlagZero), "Address Mode %s", test.mode.String())
-		if test.extraCycle {
-			assert.Equalf(t, byte(1), c.ExtraCycles, "Address Mode %s", test.mode.String())
-		}
+		// None of the addresses cross a page
+		assert.Equalf(t, byte(0), c.ExtraCycles, "Address Mode %s", test.mode.String())
 	}
 }
 
@@ -1429,13 +1430,13 @@ func TestAax(t *testing.T) {
 	c.Registers.A = 0x3E
 	c.Registers.X = 0x17
 	c.Registers.PC = 0
-	c.Memory.WriteByteAt(0x01, 0x49)
-	c.Memory.WriteByteAt(0x60, 0x89)
-	c.Memory.WriteByteAt(0x61, 0x04)
+	mem(c).WriteByteAt(0x01, 0x49)
+	mem(c).WriteByteAt(0x60, 0x89)
+	mem(c).WriteByteAt(0x61, 0x04)
 
 	cpu.Aax(c, cpu.AddressModeIndirectX)
 
-	assert.Equal(t, uint8(0x3E&0x17), c.Memory.ReadByteAt(0x0489))
+	assert.Equal(t, uint8(0x3E&0x17), mem(c).ReadByteAt(0x0489))
 }
 
 func TestDcp(t *testing.T) {
@@ -1649,3 +1650,221 @@ func TestRra(t *testing.T) {
 		assert.Equalf(t, byte(0x25), c.Registers.P.Read(), "Address Mode %s", test.mode.String())
 	}
 }
+
+func TestAnc(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	c.Registers.P.Write(0)
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0xF0)
+	c.Registers.A = 0x8F
+
+	cpu.Anc(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0x80), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagNegative))
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagCarry))
+
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x70)
+
+	cpu.Anc(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0x00), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagZero))
+	assert.Equal(t, false, c.Registers.P.ReadFlag(cpu.FlagCarry))
+}
+
+func TestAlr(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	c.Registers.P.Write(0)
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x0F)
+	c.Registers.A = 0xFB
+
+	cpu.Alr(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0x05), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagCarry))
+	assert.Equal(t, false, c.Registers.P.ReadFlag(cpu.FlagNegative))
+}
+
+func TestArr(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	// C from bit 6, V from bit 6 XOR bit 5
+	c.Registers.P.Write(0)
+	c.Registers.P.SetFlag(cpu.FlagCarry, true)
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0xFF)
+	c.Registers.A = 0x80
+
+	cpu.Arr(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0xC0), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagNegative))
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagCarry))
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagOverflow))
+
+	c.Registers.P.Write(0)
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0xFF)
+	c.Registers.A = 0x01
+
+	cpu.Arr(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0x00), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagZero))
+	assert.Equal(t, false, c.Registers.P.ReadFlag(cpu.FlagCarry))
+	assert.Equal(t, false, c.Registers.P.ReadFlag(cpu.FlagOverflow))
+}
+
+func TestAxs(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	c.Registers.P.Write(0)
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x02)
+	c.Registers.A = 0x0F
+	c.Registers.X = 0x07
+
+	cpu.Axs(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0x05), c.Registers.X)
+	assert.Equal(t, byte(0x0F), c.Registers.A)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagCarry))
+
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x06)
+
+	cpu.Axs(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0xFF), c.Registers.X)
+	assert.Equal(t, false, c.Registers.P.ReadFlag(cpu.FlagCarry))
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagNegative))
+}
+
+func TestLas(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	writeByteToAddress(c, cpu.AddressModeAbsoluteY, 0xAF)
+	c.Registers.SP = 0xF3
+
+	cpu.Las(c, cpu.AddressModeAbsoluteY)
+
+	assert.Equal(t, byte(0xA3), c.Registers.A)
+	assert.Equal(t, byte(0xA3), c.Registers.X)
+	assert.Equal(t, byte(0xA3), c.Registers.SP)
+	assert.Equal(t, true, c.Registers.P.ReadFlag(cpu.FlagNegative))
+}
+
+func TestUnstableStores(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	testCases := []struct {
+		inst cpu.Instruction
+		mode cpu.AddressMode
+	}{
+		{inst: cpu.Sha, mode: cpu.AddressModeAbsoluteY},
+		{inst: cpu.Shx, mode: cpu.AddressModeAbsoluteY},
+		{inst: cpu.Shy, mode: cpu.AddressModeAbsoluteX},
+		{inst: cpu.Tas, mode: cpu.AddressModeAbsoluteY},
+	}
+
+	for _, test := range testCases {
+		name := runtime.FuncForPC(reflect.ValueOf(test.inst).Pointer()).Name()
+
+		// Same page value is ANDed with the high byte plus one
+		c.Registers.PC = 0
+		c.Registers.A = 0xFF
+		c.Registers.X = 0x05
+		c.Registers.Y = 0x05
+		mem(c).WriteUint16At(1, 0x0210)
+
+		test.inst(c, test.mode)
+
+		assert.Equalf(t, byte(0x05&0x03), mem(c).ReadByteAt(0x0215), name)
+
+		// Crossing a page corrupts the high byte of the address
+		c.Registers.PC = 0
+		c.Registers.X = 0xF3
+		c.Registers.Y = 0xF3
+		c.Registers.A = 0xFF
+		mem(c).WriteUint16At(1, 0x0620)
+
+		test.inst(c, test.mode)
+
+		assert.Equalf(t, byte(0x03), mem(c).ReadByteAt(0x0313), name)
+	}
+
+	// TAS also loads the stack pointer
+	assert.Equal(t, byte(0xF3), c.Registers.SP)
+}
+
+func TestXaaLxa(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x3C)
+	c.Registers.A = 0x00
+	c.Registers.X = 0x0F
+
+	cpu.Xaa(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0xEE&0x0F&0x3C), c.Registers.A)
+
+	writeByteToAddress(c, cpu.AddressModeImmediate, 0x3C)
+	c.Registers.A = 0x00
+
+	cpu.Lxa(c, cpu.AddressModeImmediate)
+
+	assert.Equal(t, byte(0xEE&0x3C), c.Registers.A)
+	assert.Equal(t, byte(0xEE&0x3C), c.Registers.X)
+}
+
+func TestAllOpcodesDecoded(t *testing.T) {
+	t.Parallel()
+
+	opcodes := cpu.GetOpcodes()
+
+	for i := 0; i < 0x100; i++ {
+		_, ok := opcodes[byte(i)]
+		assert.Truef(t, ok, "%02X", i)
+	}
+}
+
+func TestJam(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+
+	c.Registers.PC = 0x0200
+	mem(c).WriteByteAt(0x0200, 0x02)
+	mem(c).WriteUint16At(cpu.NmiVector, 0x9000)
+	mem(c).WriteUint16At(cpu.ResetVector, 0x8000)
+
+	c.Excute()
+
+	assert.True(t, c.Halted)
+	assert.Equal(t, uint16(0x0200), c.Registers.PC)
+
+	// Even NMI can't wake it
+	c.SetNmi(true)
+	c.Excute()
+
+	assert.True(t, c.Halted)
+	assert.Equal(t, uint16(0x0200), c.Registers.PC)
+
+	c.Reset()
+	c.Excute()
+
+	assert.False(t, c.Halted)
+	assert.Equal(t, uint16(0x8000), c.Registers.PC)
+}
@@ -3,9 +3,11 @@ package cpu
 import nesmath "github.com/sardap/gos/math"
 
 const (
-	StartingA  = 0
-	StartingX  = 0
-	StartingY  = 0
+	StartingA = 0
+	StartingX = 0
+	StartingY = 0
+	// StartingPC is where nestest's automation mode begins, real carts start
+	// at the address in the reset vector
 	StartingPC = 0xC000
 	StartingSP = 0xFD
 	StartingP  = 0x24
@@ -0,0 +1,109 @@
+package cpu_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	gostesting "github.com/sardap/gos/testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// singleStepDirs are where to find the full vector sets, nes6502, 6502 and
+// wdc65c02 from https://github.com/SingleStepTests/65x02. They're too big to
+// check in so the tests only run when the variables are set.
+var singleStepDirs = map[cpu.Variant]string{
+	cpu.Variant2A03:     "GOS_SINGLESTEP_2A03",
+	cpu.VariantNmos6502: "GOS_SINGLESTEP_6502",
+	cpu.Variant65C02:    "GOS_SINGLESTEP_65C02",
+}
+
+// singleStepSkipped are opcodes that don't line up with the vectors on purpose.
+// JAM stops instead of reading forever and the unstable opcodes depend on the
+// chip the vectors were made on.
+var singleStepSkipped = map[cpu.Variant]map[string]bool{
+	cpu.Variant2A03: {
+		"02": true, "12": true, "22": true, "32": true, "42": true, "52": true,
+		"62": true, "72": true, "92": true, "b2": true, "d2": true, "f2": true,
+		"8b": true, "ab": true, "93": true, "9b": true, "9c": true, "9e": true, "9f": true,
+	},
+}
+
+func runSingleStepDir(t *testing.T, dir string, variant cpu.Variant) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+
+	for _, path := range paths {
+		opcode := strings.TrimSuffix(filepath.Base(path), ".json")
+		if singleStepSkipped[variant][opcode] || (variant == cpu.VariantNmos6502 && singleStepSkipped[cpu.Variant2A03][opcode]) {
+			continue
+		}
+
+		tests, err := gostesting.LoadSingleStepTests(path)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		failures := 0
+		for _, test := range tests {
+			diff := test.Diff(variant)
+			if len(diff) == 0 {
+				continue
+			}
+
+			// The first few are enough to see what's wrong
+			failures++
+			if failures <= 3 {
+				t.Errorf("%s %s %s\n%s", variant, opcode, test.Name, strings.Join(diff, "\n"))
+			}
+		}
+		if failures > 3 {
+			t.Errorf("%s %s %d more failures", variant, opcode, failures-3)
+		}
+	}
+}
+
+func TestSingleStep(t *testing.T) {
+	t.Parallel()
+
+	runSingleStepDir(t, filepath.Join("testdata", "singlestep"), cpu.Variant2A03)
+}
+
+func TestSingleStepVectors(t *testing.T) {
+	t.Parallel()
+
+	for variant, name := range singleStepDirs {
+		dir := os.Getenv(name)
+		if dir == "" {
+			t.Logf("%s isn't set, skipping the %s vectors", name, variant)
+			continue
+		}
+
+		runSingleStepDir(t, dir, variant)
+	}
+}
+
+func TestSingleStepDiff(t *testing.T) {
+	t.Parallel()
+
+	tests, err := gostesting.LoadSingleStepTests(filepath.Join("testdata", "singlestep", "e6.json"))
+	assert.NoError(t, err)
+
+	test := tests[0]
+	test.Final.A = 0x01
+	test.Cycles = test.Cycles[:4]
+
+	assert.Equal(t, []string{
+		"A expected $01 got $00",
+		"bus activity differs, expected 4 cycles got 5",
+		"   0  read  $0300 = $E6  read  $0300 = $E6",
+		"   1  read  $0301 = $10  read  $0301 = $10",
+		"   2  read  $0010 = $7F  read  $0010 = $7F",
+		"   3  write $0010 = $7F  write $0010 = $7F",
+		"   4                     write $0010 = $80 <",
+		"fast mode A expected $01 got $00",
+		"fast mode took 5 cycles expected 4",
+	}, test.Diff(cpu.Variant2A03))
+}
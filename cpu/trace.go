@@ -0,0 +1,363 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer is handed the CPU before every instruction runs
+type Tracer interface {
+	Trace(c *Cpu)
+}
+
+type TraceFormat int
+
+const (
+	// TraceFormatNesTest matches the nestest.log lines from Nintendulator
+	TraceFormatNesTest TraceFormat = iota
+	// TraceFormatMesen matches Mesen's default trace logger layout
+	TraceFormatMesen
+	// TraceFormatFceux matches FCEUX's trace logger with frame and cycle counts
+	TraceFormatFceux
+)
+
+// TraceCondition is checked before every instruction
+type TraceCondition func(c *Cpu) bool
+
+// TracePcRange matches when the program counter is between start and end
+// inclusive
+func TracePcRange(start, end uint16) TraceCondition {
+	return func(c *Cpu) bool {
+		return c.Registers.PC >= start && c.Registers.PC <= end
+	}
+}
+
+// TraceFrame matches once the PPU has reached frame
+func TraceFrame(frame int) TraceCondition {
+	return func(c *Cpu) bool {
+		if c.Ppu == nil {
+			return false
+		}
+		_, _, current := c.Ppu.Position()
+		return current >= frame
+	}
+}
+
+// TraceCycle matches once the CPU has run for cycles
+func TraceCycle(cycles int64) TraceCondition {
+	return func(c *Cpu) bool {
+		return c.TotalCycles >= cycles
+	}
+}
+
+// LogTracer writes one line per instruction to Writer. Tracing starts the
+// first time Start matches and ends for good the first time Stop matches, a
+// nil Start begins straight away and a nil Stop never ends.
+type LogTracer struct {
+	Writer io.Writer
+	Format TraceFormat
+	Start  TraceCondition
+	Stop   TraceCondition
+	// Err is the first write error, nothing more is written after it
+	Err error
+
+	started bool
+	stopped bool
+}
+
+func CreateLogTracer(w io.Writer, format TraceFormat) *LogTracer {
+	return &LogTracer{
+		Writer: w,
+		Format: format,
+	}
+}
+
+func (t *LogTracer) Trace(c *Cpu) {
+	if t.stopped || t.Err != nil {
+		return
+	}
+
+	if !t.started {
+		if t.Start != nil && !t.Start(c) {
+			return
+		}
+		t.started = true
+	}
+
+	if t.Stop != nil && t.Stop(c) {
+		t.stopped = true
+		return
+	}
+
+	_, t.Err = io.WriteString(t.Writer, FormatTraceLine(c, t.Format)+"\n")
+}
+
+// traceInstruction is the decoded instruction at PC. Memory is peeked
+// without the bus, the IO registers are never read as reading them has side
+// effects.
+type traceInstruction struct {
+	pc        uint16
+	bytes     []byte
+	operation *Operation
+	// pointer is the zero page or absolute pointer indirect modes go through
+	pointer uint16
+	address uint16
+	value   byte
+	// peeked is false when value could not be read without side effects
+	peeked bool
+}
+
+// tracePeek reads without side effects, without a Peeker the NES registers
+// are skipped
+func tracePeek(c *Cpu, address uint16) (byte, bool) {
+	if peeker, ok := c.Bus.(Peeker); ok {
+		return peeker.PeekByteAt(address), true
+	}
+	if address >= 0x2000 && address < 0x4020 {
+		return 0, false
+	}
+	return c.Bus.ReadByteAt(address), true
+}
+
+func tracePeekUint16(c *Cpu, low, high uint16) uint16 {
+	l, _ := tracePeek(c, low)
+	h, _ := tracePeek(c, high)
+	return uint16(l) | uint16(h)<<8
+}
+
+func decodeTrace(c *Cpu) traceInstruction {
+	pc := c.Registers.PC
+	opcode, _ := tracePeek(c, pc)
+	result := traceInstruction{
+		pc:        pc,
+		operation: c.opcodes[opcode],
+	}
+
+	length := result.operation.AddressMode.OperandLength() + 1
+	for i := uint16(0); i < length; i++ {
+		value, _ := tracePeek(c, pc+i)
+		result.bytes = append(result.bytes, value)
+	}
+
+	var oprand uint16
+	if length > 1 {
+		oprand = uint16(result.bytes[1])
+	}
+	if length > 2 {
+		oprand |= uint16(result.bytes[2]) << 8
+	}
+
+	switch result.operation.AddressMode {
+	case AddressModeZeroPage, AddressModeAbsolute:
+		result.address = oprand
+	case AddressModeZeroPageX:
+		result.address = uint16(byte(oprand) + c.Registers.X)
+	case AddressModeZeroPageY:
+		result.address = uint16(byte(oprand) + c.Registers.Y)
+	case AddressModeAbsoluteX:
+		result.address = oprand + uint16(c.Registers.X)
+	case AddressModeAbsoluteY:
+		result.address = oprand + uint16(c.Registers.Y)
+	case AddressModeIndirect:
+		high := oprand&0xFF00 | uint16(byte(oprand)+1)
+		if c.variant == Variant65C02 {
+			high = oprand + 1
+		}
+		result.address = tracePeekUint16(c, oprand, high)
+	case AddressModeZeroPageIndirect:
+		result.pointer = oprand
+		result.address = tracePeekUint16(c, oprand, uint16(byte(oprand)+1))
+	case AddressModeAbsoluteIndirectX:
+		result.pointer = oprand + uint16(c.Registers.X)
+		result.address = tracePeekUint16(c, result.pointer, result.pointer+1)
+	case AddressModeIndirectX:
+		pointer := byte(oprand) + c.Registers.X
+		result.pointer = uint16(pointer)
+		result.address = tracePeekUint16(c, uint16(pointer), uint16(pointer+1))
+	case AddressModeIndirectY:
+		result.pointer = tracePeekUint16(c, oprand, uint16(byte(oprand)+1))
+		result.address = result.pointer + uint16(c.Registers.Y)
+	case AddressModeRelative:
+		result.address = pc + 2 + uint16(int8(oprand))
+	default:
+		return result
+	}
+
+	result.value, result.peeked = tracePeek(c, result.address)
+
+	return result
+}
+
+// mnemonic splits the * unofficial marker from the instruction name
+func (t traceInstruction) mnemonic() (string, string) {
+	name := strings.Split(t.operation.Name, " ")[0]
+	if strings.HasPrefix(name, "*") {
+		return "*", name[1:]
+	}
+	return " ", name
+}
+
+// jumps don't touch memory at their operand address
+func (t traceInstruction) jump() bool {
+	_, name := t.mnemonic()
+	return name == "JMP" || name == "JSR"
+}
+
+func (t traceInstruction) operand() string {
+	var oprand uint16
+	if len(t.bytes) > 1 {
+		oprand = uint16(t.bytes[1])
+	}
+	if len(t.bytes) > 2 {
+		oprand |= uint16(t.bytes[2]) << 8
+	}
+
+	switch t.operation.AddressMode {
+	case AddressModeImmediate:
+		return fmt.Sprintf("#$%02X", oprand)
+	case AddressModeZeroPage:
+		return fmt.Sprintf("$%02X", oprand)
+	case AddressModeZeroPageX:
+		return fmt.Sprintf("$%02X,X", oprand)
+	case AddressModeZeroPageY:
+		return fmt.Sprintf("$%02X,Y", oprand)
+	case AddressModeAbsolute:
+		return fmt.Sprintf("$%04X", oprand)
+	case AddressModeAbsoluteX:
+		return fmt.Sprintf("$%04X,X", oprand)
+	case AddressModeAbsoluteY:
+		return fmt.Sprintf("$%04X,Y", oprand)
+	case AddressModeIndirect:
+		return fmt.Sprintf("($%04X)", oprand)
+	case AddressModeIndirectX:
+		return fmt.Sprintf("($%02X,X)", oprand)
+	case AddressModeIndirectY:
+		return fmt.Sprintf("($%02X),Y", oprand)
+	case AddressModeZeroPageIndirect:
+		return fmt.Sprintf("($%02X)", oprand)
+	case AddressModeAbsoluteIndirectX:
+		return fmt.Sprintf("($%04X,X)", oprand)
+	case AddressModeAccumulator:
+		return "A"
+	case AddressModeRelative:
+		return fmt.Sprintf("$%04X", t.address)
+	}
+
+	return ""
+}
+
+func (t traceInstruction) valueString() string {
+	if !t.peeked {
+		return "??"
+	}
+	return fmt.Sprintf("%02X", t.value)
+}
+
+// nesTestOperand adds the effective address and value the way nestest.log
+// does e.g. "($80),Y = 0200 @ 0203 = 5A"
+func (t traceInstruction) nesTestOperand() string {
+	operand := t.operand()
+
+	switch t.operation.AddressMode {
+	case AddressModeZeroPage:
+		return fmt.Sprintf("%s = %s", operand, t.valueString())
+	case AddressModeAbsolute:
+		if t.jump() {
+			return operand
+		}
+		return fmt.Sprintf("%s = %s", operand, t.valueString())
+	case AddressModeZeroPageX, AddressModeZeroPageY:
+		return fmt.Sprintf("%s @ %02X = %s", operand, t.address, t.valueString())
+	case AddressModeAbsoluteX, AddressModeAbsoluteY:
+		return fmt.Sprintf("%s @ %04X = %s", operand, t.address, t.valueString())
+	case AddressModeIndirect, AddressModeAbsoluteIndirectX:
+		return fmt.Sprintf("%s = %04X", operand, t.address)
+	case AddressModeZeroPageIndirect:
+		return fmt.Sprintf("%s = %04X = %s", operand, t.address, t.valueString())
+	case AddressModeIndirectX:
+		return fmt.Sprintf("%s @ %02X = %04X = %s", operand, t.pointer, t.address, t.valueString())
+	case AddressModeIndirectY:
+		return fmt.Sprintf("%s = %04X @ %04X = %s", operand, t.pointer, t.address, t.valueString())
+	}
+
+	return operand
+}
+
+// effectiveOperand adds the effective address and value, used by both the
+// Mesen and FCEUX layouts e.g. "$10,X @ $0012 = #$00"
+func (t traceInstruction) effectiveOperand(address, value string) string {
+	operand := t.operand()
+
+	switch t.operation.AddressMode {
+	case AddressModeZeroPage, AddressModeAbsolute:
+		if t.jump() {
+			return operand
+		}
+		return fmt.Sprintf("%s = "+value, operand, t.valueString())
+	case AddressModeZeroPageX, AddressModeZeroPageY, AddressModeAbsoluteX, AddressModeAbsoluteY,
+		AddressModeIndirectX, AddressModeIndirectY, AddressModeZeroPageIndirect:
+		return fmt.Sprintf("%s "+address+" = "+value, operand, t.address, t.valueString())
+	}
+
+	return operand
+}
+
+func (t traceInstruction) hexBytes(prefix string) string {
+	parts := make([]string, len(t.bytes))
+	for i, b := range t.bytes {
+		parts[i] = fmt.Sprintf("%s%02X", prefix, b)
+	}
+	return strings.Join(parts, " ")
+}
+
+// flagString is P as letters, upper case when set e.g. "nvUbdIzc"
+func flagString(p byte) string {
+	const flags = "NVUBDIZC"
+	var builder strings.Builder
+	for i := 0; i < 8; i++ {
+		letter := flags[i : i+1]
+		if p&(0x80>>i) == 0 {
+			letter = strings.ToLower(letter)
+		}
+		builder.WriteString(letter)
+	}
+	return builder.String()
+}
+
+// FormatTraceLine formats the instruction at PC and the current state
+func FormatTraceLine(c *Cpu, format TraceFormat) string {
+	inst := decodeTrace(c)
+	unofficial, name := inst.mnemonic()
+	r := c.Registers
+
+	var dot, scanline, frame int
+	if c.Ppu != nil {
+		dot, scanline, frame = c.Ppu.Position()
+	}
+
+	switch format {
+	case TraceFormatMesen:
+		return fmt.Sprintf(
+			"%04X  %-11s %-32s A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%-3d SL:%-3d FC:%d CPU Cycle:%d",
+			inst.pc, inst.hexBytes("$"),
+			strings.TrimSpace(name+" "+inst.effectiveOperand("[$%04X]", "$%s")),
+			r.A, r.X, r.Y, r.P.Read(), r.SP, dot, scanline, frame, c.TotalCycles,
+		)
+
+	case TraceFormatFceux:
+		return fmt.Sprintf(
+			"f%-6d c%-11d A:%02X X:%02X Y:%02X S:%02X P:%s  $%04X:%-9s %s",
+			frame, c.TotalCycles, r.A, r.X, r.Y, r.SP, flagString(r.P.Read()),
+			inst.pc, inst.hexBytes(""),
+			strings.TrimSpace(name+" "+inst.effectiveOperand("@ $%04X", "#$%s")),
+		)
+	}
+
+	return fmt.Sprintf(
+		"%04X  %-8s %s%-32sA:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		inst.pc, inst.hexBytes(""), unofficial,
+		strings.TrimSpace(name+" "+inst.nesTestOperand()),
+		r.A, r.X, r.Y, r.P.Read(), r.SP, scanline, dot, c.TotalCycles,
+	)
+}
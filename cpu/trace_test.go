@@ -0,0 +1,104 @@
+package cpu_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPpu struct {
+	dot, scanline, frame int
+}
+
+func (p *testPpu) Position() (int, int, int) {
+	return p.dot, p.scanline, p.frame
+}
+
+func TestFormatTraceLine(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+	c.Registers.PC = 0xC000
+	c.Registers.SP = 0xFD
+	c.Registers.P.Write(0x24)
+	c.TotalCycles = 7
+	c.Ppu = &testPpu{dot: 21}
+	// JMP $C5F5
+	mem(c).WriteByteAt(0xC000, 0x4C)
+	mem(c).WriteByteAt(0xC001, 0xF5)
+	mem(c).WriteByteAt(0xC002, 0xC5)
+
+	assert.Equal(t,
+		"C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+		cpu.FormatTraceLine(c, cpu.TraceFormatNesTest),
+	)
+	assert.Equal(t,
+		"C000  $4C $F5 $C5 JMP $C5F5                        A:00 X:00 Y:00 P:24 SP:FD CYC:21  SL:0   FC:0 CPU Cycle:7",
+		cpu.FormatTraceLine(c, cpu.TraceFormatMesen),
+	)
+	assert.Equal(t,
+		"f0      c7           A:00 X:00 Y:00 S:FD P:nvUbdIzc  $C000:4C F5 C5  JMP $C5F5",
+		cpu.FormatTraceLine(c, cpu.TraceFormatFceux),
+	)
+
+	// LDA ($89),Y
+	c.Registers.Y = 0x03
+	mem(c).WriteByteAt(0xC000, 0xB1)
+	mem(c).WriteByteAt(0xC001, 0x89)
+	mem(c).WriteByteAt(0x0089, 0x00)
+	mem(c).WriteByteAt(0x008A, 0x03)
+	mem(c).WriteByteAt(0x0303, 0x5A)
+
+	assert.Equal(t,
+		"C000  B1 89     LDA ($89),Y = 0300 @ 0303 = 5A  A:00 X:00 Y:03 P:24 SP:FD PPU:  0, 21 CYC:7",
+		cpu.FormatTraceLine(c, cpu.TraceFormatNesTest),
+	)
+	assert.Contains(t, cpu.FormatTraceLine(c, cpu.TraceFormatMesen), "LDA ($89),Y [$0303] = $5A")
+	assert.Contains(t, cpu.FormatTraceLine(c, cpu.TraceFormatFceux), "LDA ($89),Y @ $0303 = #$5A")
+
+	// IO registers are peeked so the vblank flag survives
+	mem(c).WriteByteAt(0xC000, 0x0C)
+	mem(c).WriteByteAt(0xC001, 0x02)
+	mem(c).WriteByteAt(0xC002, 0x20)
+	mem(c).PpuRegisters.Status.Write(0x80)
+
+	assert.Equal(t,
+		"C000  0C 02 20 *NOP $2002 = 80                  A:00 X:00 Y:03 P:24 SP:FD PPU:  0, 21 CYC:7",
+		cpu.FormatTraceLine(c, cpu.TraceFormatNesTest),
+	)
+	assert.Equal(t, byte(0x80), mem(c).PpuRegisters.Status.Read())
+
+	// Without a Peeker they aren't read at all
+	c.Bus = struct{ cpu.Bus }{mem(c)}
+	assert.Contains(t, cpu.FormatTraceLine(c, cpu.TraceFormatNesTest), "*NOP $2002 = ??")
+}
+
+func TestLogTracer(t *testing.T) {
+	t.Parallel()
+
+	c := createCpu()
+	c.Registers.PC = 0x8000
+	// INX * 8
+	for i := uint16(0); i < 8; i++ {
+		mem(c).WriteByteAt(0x8000+i, 0xE8)
+	}
+
+	var buffer bytes.Buffer
+	tracer := cpu.CreateLogTracer(&buffer, cpu.TraceFormatNesTest)
+	tracer.Start = cpu.TracePcRange(0x8002, 0x8002)
+	tracer.Stop = cpu.TracePcRange(0x8005, 0x8005)
+	c.Tracer = tracer
+
+	for i := 0; i < 8; i++ {
+		c.Excute()
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "8002  E8        INX "))
+	assert.True(t, strings.HasPrefix(lines[2], "8004  E8        INX "))
+	assert.NoError(t, tracer.Err)
+}
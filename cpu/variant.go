@@ -0,0 +1,217 @@
+package cpu
+
+// http://www.6502.org/tutorials/decimal_mode.html
+// N and V come from the half adjusted result on the NMOS chips, the 65C02
+// sets N and Z from the final result and spends a cycle doing it
+func decimalAdc(c *Cpu, oprand byte) {
+	a := c.Registers.A
+	carry := uint16(c.Registers.P.ReadFlagByte(FlagCarry))
+
+	low := uint16(a&0x0F) + uint16(oprand&0x0F) + carry
+	if low > 0x09 {
+		low += 0x06
+	}
+
+	result := uint16(a&0xF0) + uint16(oprand&0xF0) + low&0x0F
+	if low > 0x0F {
+		result += 0x10
+	}
+
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(a)+uint16(oprand)+carry))
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
+	c.Registers.P.SetFlag(FlagOverflow, (uint16(a)^result)&0x80 != 0 && (a^oprand)&0x80 == 0)
+
+	if result&0x1F0 > 0x90 {
+		result += 0x60
+	}
+
+	c.Registers.P.SetFlag(FlagCarry, result&0xFF0 > 0xF0)
+	c.Registers.A = byte(result)
+
+	if c.variant == Variant65C02 {
+		c.Registers.P.SetFlag(FlagNegative, negativeHappend(result))
+		c.Registers.P.SetFlag(FlagZero, zeroHappend(result))
+		cmosDecimalCycle(c)
+	}
+}
+
+// The NMOS chips set every flag the same as binary mode
+func decimalSbc(c *Cpu, operand byte) {
+	a := c.Registers.A
+	borrow := 1 - int(c.Registers.P.ReadFlagByte(FlagCarry))
+
+	binaryAdc(c, operand^0xFF)
+
+	low := int(a&0x0F) - int(operand&0x0F) - borrow
+	var result int
+	if c.variant == Variant65C02 {
+		result = int(a) - int(operand) - borrow
+		if result < 0 {
+			result -= 0x60
+		}
+		if low < 0 {
+			result -= 0x06
+		}
+	} else {
+		if low < 0 {
+			low = ((low - 0x06) & 0x0F) - 0x10
+		}
+		result = int(a&0xF0) - int(operand&0xF0) + low
+		if result < 0 {
+			result -= 0x60
+		}
+	}
+
+	c.Registers.A = byte(result)
+
+	if c.variant == Variant65C02 {
+		c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(c.Registers.A)))
+		c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(c.Registers.A)))
+		cmosDecimalCycle(c)
+	}
+}
+
+func cmosDecimalCycle(c *Cpu) {
+	c.dummyRead(c.Registers.PC + 1)
+	c.ExtraCycles++
+}
+
+// createCmosOpcodes starts from the NMOS table, turns everything that wasn't
+// documented into a NOP and adds the 65C02 instructions. The Rockwell and WDC
+// bit instructions aren't included. The undocumented NOPs are marked
+// with a * like the NMOS ones.
+func createCmosOpcodes() map[byte]*Operation {
+	result := make(map[byte]*Operation, len(opcodes))
+	for opcode, operation := range opcodes {
+		result[opcode] = operation
+	}
+
+	for i := 0; i < 0x100; i++ {
+		opcode := byte(i)
+		switch {
+		case opcode&0x03 == 0x03:
+			result[opcode] = &Operation{Inst: Nop, Length: 1, MinCycles: 1, AddressMode: AddressModeImplied, Name: "*NOP"}
+		case opcode&0x1F == 0x02 && opcode != 0xA2:
+			result[opcode] = &Operation{Inst: Nop, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "*NOP #oper"}
+		}
+	}
+
+	for opcode, operation := range map[byte]*Operation{
+		// NOPs with operands
+		0x44: {Inst: Nop, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "*NOP oper"},
+		0x54: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP oper,X"},
+		0xD4: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP oper,X"},
+		0xF4: {Inst: Nop, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "*NOP oper,X"},
+		0x5C: {Inst: NopLong, Length: 3, MinCycles: 8, AddressMode: AddressModeAbsolute, Name: "*NOP oper"},
+		0xDC: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsolute, Name: "*NOP oper"},
+		0xFC: {Inst: Nop, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsolute, Name: "*NOP oper"},
+		// (zp) versions of the ALU instructions
+		0x12: {Inst: Ora, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "ORA (oper)"},
+		0x32: {Inst: And, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "AND (oper)"},
+		0x52: {Inst: Eor, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "EOR (oper)"},
+		0x72: {Inst: Adc, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "ADC (oper)"},
+		0x92: {Inst: Sta, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "STA (oper)"},
+		0xB2: {Inst: Lda, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "LDA (oper)"},
+		0xD2: {Inst: Cmp, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "CMP (oper)"},
+		0xF2: {Inst: Sbc, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPageIndirect, Name: "SBC (oper)"},
+		// A AND M -> Z, only the immediate version leaves N and V alone
+		0x89: {Inst: Bit, Length: 2, MinCycles: 2, AddressMode: AddressModeImmediate, Name: "BIT #oper"},
+		0x34: {Inst: Bit, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "BIT oper,X"},
+		0x3C: {Inst: Bit, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsoluteX, Name: "BIT oper,X"}, // Extra Cycles
+		// A + 1 -> A, A - 1 -> A
+		0x1A: {Inst: Inc, Length: 1, MinCycles: 2, AddressMode: AddressModeAccumulator, Name: "INC A"},
+		0x3A: {Inst: Dec, Length: 1, MinCycles: 2, AddressMode: AddressModeAccumulator, Name: "DEC A"},
+		// No page wrap bug
+		0x6C: {Inst: Jmp, Length: 0, MinCycles: 6, AddressMode: AddressModeIndirect, Name: "JMP (oper)"},
+		0x7C: {Inst: Jmp, Length: 0, MinCycles: 6, AddressMode: AddressModeAbsoluteIndirectX, Name: "JMP (oper,X)"},
+		// Branch always
+		0x80: {Inst: Bra, Length: 2, MinCycles: 2, AddressMode: AddressModeRelative, Name: "BRA oper"},
+		// push X, push Y, pull X, pull Y
+		0xDA: {Inst: Phx, Length: 1, MinCycles: 3, AddressMode: AddressModeImplied, Name: "PHX"},
+		0x5A: {Inst: Phy, Length: 1, MinCycles: 3, AddressMode: AddressModeImplied, Name: "PHY"},
+		0xFA: {Inst: Plx, Length: 1, MinCycles: 4, AddressMode: AddressModeImplied, Name: "PLX"},
+		0x7A: {Inst: Ply, Length: 1, MinCycles: 4, AddressMode: AddressModeImplied, Name: "PLY"},
+		// 0 -> M
+		0x64: {Inst: Stz, Length: 2, MinCycles: 3, AddressMode: AddressModeZeroPage, Name: "STZ oper"},
+		0x74: {Inst: Stz, Length: 2, MinCycles: 4, AddressMode: AddressModeZeroPageX, Name: "STZ oper,X"},
+		0x9C: {Inst: Stz, Length: 3, MinCycles: 4, AddressMode: AddressModeAbsolute, Name: "STZ oper"},
+		0x9E: {Inst: Stz, Length: 3, MinCycles: 5, AddressMode: AddressModeAbsoluteX, Name: "STZ oper,X"},
+		// A AND M -> Z, M AND NOT A -> M
+		0x14: {Inst: Trb, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPage, Name: "TRB oper"},
+		0x1C: {Inst: Trb, Length: 3, MinCycles: 6, AddressMode: AddressModeAbsolute, Name: "TRB oper"},
+		// A AND M -> Z, M OR A -> M
+		0x04: {Inst: Tsb, Length: 2, MinCycles: 5, AddressMode: AddressModeZeroPage, Name: "TSB oper"},
+		0x0C: {Inst: Tsb, Length: 3, MinCycles: 6, AddressMode: AddressModeAbsolute, Name: "TSB oper"},
+		// Shifts and rotates only spend the indexing cycle on a page cross
+		0x1E: {Inst: cmosShift(asl), Length: 3, MinCycles: 6, AddressMode: AddressModeAbsoluteX, Name: "ASL oper,X"}, // Extra Cycles
+		0x5E: {Inst: cmosShift(lsr), Length: 3, MinCycles: 6, AddressMode: AddressModeAbsoluteX, Name: "LSR oper,X"}, // Extra Cycles
+		0x3E: {Inst: cmosShift(rol), Length: 3, MinCycles: 6, AddressMode: AddressModeAbsoluteX, Name: "ROL oper,X"}, // Extra Cycles
+		0x7E: {Inst: cmosShift(ror), Length: 3, MinCycles: 6, AddressMode: AddressModeAbsoluteX, Name: "ROR oper,X"}, // Extra Cycles
+	} {
+		result[opcode] = operation
+	}
+
+	return result
+}
+
+// cmosShift is a 65C02 abs,X shift or rotate, the address is worked out like
+// a load's so crossing a page is what costs the extra cycle
+func cmosShift(shift func(c *Cpu, operand byte) byte) Instruction {
+	return func(c *Cpu, mode AddressMode) {
+		address := c.GetOprandAddress(mode)
+		operand := c.read(address)
+		c.writeModified(mode, address, operand, shift(c, operand))
+	}
+}
+
+// NopLong is the 65C02's 8 cycle 0x5C
+func NopLong(c *Cpu, mode AddressMode) {
+	Nop(c, mode)
+	for i := 0; i < 4; i++ {
+		c.dummyRead(0xFFFF)
+	}
+}
+
+func Bra(c *Cpu, mode AddressMode) {
+	branchOnFlag(c, true)
+}
+
+func Phx(c *Cpu, mode AddressMode) {
+	c.PushByte(c.Registers.X)
+}
+
+func Phy(c *Cpu, mode AddressMode) {
+	c.PushByte(c.Registers.Y)
+}
+
+func Plx(c *Cpu, mode AddressMode) {
+	c.dummyRead(c.stackAddress())
+	c.Registers.X = c.PopByte()
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(c.Registers.X)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(c.Registers.X)))
+}
+
+func Ply(c *Cpu, mode AddressMode) {
+	c.dummyRead(c.stackAddress())
+	c.Registers.Y = c.PopByte()
+
+	c.Registers.P.SetFlag(FlagNegative, negativeHappend(uint16(c.Registers.Y)))
+	c.Registers.P.SetFlag(FlagZero, zeroHappend(uint16(c.Registers.Y)))
+}
+
+func Stz(c *Cpu, mode AddressMode) {
+	c.WriteByteByMode(mode, 0)
+}
+
+func Trb(c *Cpu, mode AddressMode) {
+	address, operand := c.readModify(mode)
+	c.Registers.P.SetFlag(FlagZero, c.Registers.A&operand == 0)
+	c.writeModified(mode, address, operand, operand&^c.Registers.A)
+}
+
+func Tsb(c *Cpu, mode AddressMode) {
+	address, operand := c.readModify(mode)
+	c.Registers.P.SetFlag(FlagZero, c.Registers.A&operand == 0)
+	c.writeModified(mode, address, operand, operand|c.Registers.A)
+}
@@ -0,0 +1,273 @@
+package cpu_test
+
+import (
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func createVariantCpu(variant cpu.Variant) *cpu.Cpu {
+	result := cpu.CreateCpuVariant(memory.Create(), variant)
+	mem(result).SetCart(&testCart{})
+	result.Registers.PC = 0x8000
+	return result
+}
+
+func runProgram(c *cpu.Cpu, program ...byte) {
+	for i, value := range program {
+		mem(c).WriteByteAt(c.Registers.PC+uint16(i), value)
+	}
+	c.Excute()
+}
+
+func TestDecimalMode(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		variant  cpu.Variant
+		opcode   byte
+		a        byte
+		operand  byte
+		carry    bool
+		expected byte
+		carryOut bool
+		zero     bool
+	}{
+		// The 2A03 ignores the flag
+		{variant: cpu.Variant2A03, opcode: 0x69, a: 0x58, operand: 0x46, expected: 0x9E},
+		{variant: cpu.Variant2A03, opcode: 0xE9, a: 0x40, operand: 0x13, carry: true, expected: 0x2D, carryOut: true},
+		// ADC
+		{variant: cpu.VariantNmos6502, opcode: 0x69, a: 0x58, operand: 0x46, expected: 0x04, carryOut: true},
+		{variant: cpu.VariantNmos6502, opcode: 0x69, a: 0x09, operand: 0x01, expected: 0x10},
+		{variant: cpu.VariantNmos6502, opcode: 0x69, a: 0x99, operand: 0x00, carry: true, expected: 0x00, carryOut: true},
+		{variant: cpu.Variant65C02, opcode: 0x69, a: 0x58, operand: 0x46, expected: 0x04, carryOut: true},
+		// Only the 65C02 sets Z from the decimal result
+		{variant: cpu.Variant65C02, opcode: 0x69, a: 0x99, operand: 0x00, carry: true, expected: 0x00, carryOut: true, zero: true},
+		// SBC
+		{variant: cpu.VariantNmos6502, opcode: 0xE9, a: 0x46, operand: 0x12, carry: true, expected: 0x34, carryOut: true},
+		{variant: cpu.VariantNmos6502, opcode: 0xE9, a: 0x40, operand: 0x13, carry: true, expected: 0x27, carryOut: true},
+		{variant: cpu.VariantNmos6502, opcode: 0xE9, a: 0x00, operand: 0x01, carry: true, expected: 0x99},
+		{variant: cpu.Variant65C02, opcode: 0xE9, a: 0x40, operand: 0x13, carry: true, expected: 0x27, carryOut: true},
+		{variant: cpu.Variant65C02, opcode: 0xE9, a: 0x00, operand: 0x01, carry: true, expected: 0x99},
+	}
+
+	for _, test := range testCases {
+		c := createVariantCpu(test.variant)
+		c.Registers.A = test.a
+		c.Registers.P.SetFlag(cpu.FlagDecimal, true)
+		c.Registers.P.SetFlag(cpu.FlagCarry, test.carry)
+
+		runProgram(c, test.opcode, test.operand)
+
+		assert.Equalf(t, test.expected, c.Registers.A, "%s %02X %02X %02X", test.variant, test.opcode, test.a, test.operand)
+		assert.Equalf(t, test.carryOut, c.Registers.P.ReadFlag(cpu.FlagCarry), "%s %02X %02X %02X", test.variant, test.opcode, test.a, test.operand)
+		assert.Equalf(t, test.zero, c.Registers.P.ReadFlag(cpu.FlagZero), "%s %02X %02X %02X", test.variant, test.opcode, test.a, test.operand)
+	}
+
+	// The 65C02 takes an extra cycle
+	c := createVariantCpu(cpu.Variant65C02)
+	c.Registers.P.SetFlag(cpu.FlagDecimal, true)
+	runProgram(c, 0x69, 0x01)
+	assert.Equal(t, 3, c.Cycles)
+}
+
+func TestCmosJmpIndirect(t *testing.T) {
+	t.Parallel()
+
+	for _, variant := range []cpu.Variant{cpu.VariantNmos6502, cpu.Variant65C02} {
+		c := createVariantCpu(variant)
+		mem(c).WriteByteAt(0x10FF, 0x34)
+		mem(c).WriteByteAt(0x1000, 0x12)
+		mem(c).WriteByteAt(0x1100, 0x56)
+
+		runProgram(c, 0x6C, 0xFF, 0x10)
+
+		if variant == cpu.Variant65C02 {
+			assert.Equal(t, uint16(0x5634), c.Registers.PC)
+			assert.Equal(t, 6, c.Cycles)
+		} else {
+			assert.Equal(t, uint16(0x1234), c.Registers.PC)
+			assert.Equal(t, 5, c.Cycles)
+		}
+	}
+
+	// JMP (oper,X)
+	c := createVariantCpu(cpu.Variant65C02)
+	c.Registers.X = 0x02
+	mem(c).WriteByteAt(0x1002, 0x00)
+	mem(c).WriteByteAt(0x1003, 0x90)
+	runProgram(c, 0x7C, 0x00, 0x10)
+	assert.Equal(t, uint16(0x9000), c.Registers.PC)
+	assert.Equal(t, 6, c.Cycles)
+}
+
+func TestCmosInstructions(t *testing.T) {
+	t.Parallel()
+
+	// STZ oper
+	c := createVariantCpu(cpu.Variant65C02)
+	mem(c).WriteByteAt(0x0010, 0xFF)
+	runProgram(c, 0x64, 0x10)
+	assert.Equal(t, byte(0x00), mem(c).ReadByteAt(0x0010))
+
+	// LDA (oper)
+	c = createVariantCpu(cpu.Variant65C02)
+	mem(c).WriteByteAt(0x0010, 0x00)
+	mem(c).WriteByteAt(0x0011, 0x02)
+	mem(c).WriteByteAt(0x0200, 0x42)
+	runProgram(c, 0xB2, 0x10)
+	assert.Equal(t, byte(0x42), c.Registers.A)
+	assert.Equal(t, 5, c.Cycles)
+
+	// BRA
+	c = createVariantCpu(cpu.Variant65C02)
+	runProgram(c, 0x80, 0x10)
+	assert.Equal(t, uint16(0x8012), c.Registers.PC)
+	assert.Equal(t, 3, c.Cycles)
+
+	// PHX PLY
+	c = createVariantCpu(cpu.Variant65C02)
+	c.Registers.X = 0x80
+	runProgram(c, 0xDA)
+	runProgram(c, 0x7A)
+	assert.Equal(t, byte(0x80), c.Registers.Y)
+	assert.True(t, c.Registers.P.ReadFlag(cpu.FlagNegative))
+
+	// TSB TRB
+	c = createVariantCpu(cpu.Variant65C02)
+	c.Registers.A = 0x0F
+	mem(c).WriteByteAt(0x0010, 0xF0)
+	runProgram(c, 0x04, 0x10)
+	assert.Equal(t, byte(0xFF), mem(c).ReadByteAt(0x0010))
+	assert.True(t, c.Registers.P.ReadFlag(cpu.FlagZero))
+	runProgram(c, 0x14, 0x10)
+	assert.Equal(t, byte(0xF0), mem(c).ReadByteAt(0x0010))
+	assert.False(t, c.Registers.P.ReadFlag(cpu.FlagZero))
+
+	// BIT #oper leaves N and V alone
+	c = createVariantCpu(cpu.Variant65C02)
+	c.Registers.A = 0x01
+	runProgram(c, 0x89, 0xC0)
+	assert.True(t, c.Registers.P.ReadFlag(cpu.FlagZero))
+	assert.False(t, c.Registers.P.ReadFlag(cpu.FlagNegative))
+	assert.False(t, c.Registers.P.ReadFlag(cpu.FlagOverflow))
+
+	// INC A
+	c = createVariantCpu(cpu.Variant65C02)
+	runProgram(c, 0x1A)
+	assert.Equal(t, byte(0x01), c.Registers.A)
+
+	// Undocumented NMOS opcodes are NOPs
+	c = createVariantCpu(cpu.Variant65C02)
+	runProgram(c, 0xA7, 0x10)
+	assert.Equal(t, byte(0x00), c.Registers.A)
+	assert.Equal(t, uint16(0x8001), c.Registers.PC)
+	assert.Equal(t, 1, c.Cycles)
+	runProgram(c, 0x02)
+	assert.False(t, c.Halted)
+	assert.Equal(t, uint16(0x8003), c.Registers.PC)
+
+	// Interrupts clear decimal
+	c = createVariantCpu(cpu.Variant65C02)
+	c.Registers.P.SetFlag(cpu.FlagDecimal, true)
+	runProgram(c, 0x00)
+	assert.False(t, c.Registers.P.ReadFlag(cpu.FlagDecimal))
+}
+
+func TestVariantOpcodesDecoded(t *testing.T) {
+	t.Parallel()
+
+	opcodes := cpu.GetVariantOpcodes(cpu.Variant65C02)
+	for i := 0; i < 0x100; i++ {
+		_, ok := opcodes[byte(i)]
+		assert.Truef(t, ok, "%02X", i)
+	}
+}
+
+func TestCmosReadModifyWrite(t *testing.T) {
+	t.Parallel()
+
+	// The 65C02 reads the operand again where the NMOS chips write it back
+	testCases := []struct {
+		name     string
+		program  []byte
+		a        byte
+		x        byte
+		expected []busAccess
+	}{
+		{
+			name:    "ASL oper,X",
+			program: []byte{0x1E, 0x00, 0x90},
+			expected: []busAccess{
+				{0x8000, 0x1E, false},
+				{0x8001, 0x00, false},
+				{0x8002, 0x90, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x82, true},
+			},
+		},
+		{
+			name:    "ASL oper,X page cross",
+			program: []byte{0x1E, 0xFF, 0x8F},
+			x:       0x01,
+			expected: []busAccess{
+				{0x8000, 0x1E, false},
+				{0x8001, 0xFF, false},
+				{0x8002, 0x8F, false},
+				{0x8F00, 0x00, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x82, true},
+			},
+		},
+		{
+			name:    "TSB oper",
+			program: []byte{0x0C, 0x00, 0x90},
+			a:       0x02,
+			expected: []busAccess{
+				{0x8000, 0x0C, false},
+				{0x8001, 0x00, false},
+				{0x8002, 0x90, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x41, false},
+				{0x9000, 0x43, true},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		c, cart := createAccurateCpu(cpu.Variant65C02)
+		c.Registers.PC = 0x8000
+		c.Registers.A = test.a
+		c.Registers.X = test.x
+		copy(cart.data[0x8000:], test.program)
+		cart.data[0x9000] = 0x41
+
+		assert.NoError(t, c.Excute(), test.name)
+		assert.Equal(t, test.expected, cart.accesses, test.name)
+		assert.Equal(t, len(test.expected), c.Cycles, test.name)
+	}
+
+	// Shifts and rotates abs,X take 6 cycles and 7 on a page cross
+	for _, accurate := range []bool{false, true} {
+		for _, opcode := range []byte{0x1E, 0x5E, 0x3E, 0x7E} {
+			for _, x := range []byte{0x01, 0x20} {
+				c, cart := createAccurateCpu(cpu.Variant65C02)
+				c.CycleAccurate = accurate
+				c.Registers.PC = 0x8000
+				c.Registers.X = x
+				copy(cart.data[0x8000:], []byte{opcode, 0xF0, 0x90})
+
+				assert.NoError(t, c.Excute())
+				expected := 6
+				if x == 0x20 {
+					expected = 7
+				}
+				assert.Equalf(t, expected, c.Cycles, "%02X X %02X accurate %v", opcode, x, accurate)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package disassembler
+
+import (
+	"strings"
+
+	"github.com/sardap/gos/cpu"
+)
+
+// Reader is anywhere bytes can be read by address, memory.Memory is one.
+// Readers that are also a cpu.Peeker are peeked so reading has no side
+// effects.
+type Reader interface {
+	ReadByteAt(address uint16) byte
+}
+
+type Instruction struct {
+	Address  uint16
+	Bytes    []byte
+	Opcode   byte
+	Mnemonic string
+	Mode     cpu.AddressMode
+	// Operand is the raw value after the opcode
+	Operand uint16
+	// Target is where a branch, JMP or JSR goes, HasTarget is false for
+	// everything else including indirect jumps
+	Target    uint16
+	HasTarget bool
+	// Unofficial instructions are ones an assembler wouldn't produce these
+	// bytes for
+	Unofficial bool
+	// Data is set when the bytes ran out before the instruction ended
+	Data bool
+}
+
+func (i Instruction) Length() int {
+	return len(i.Bytes)
+}
+
+// Next is the address following the instruction
+func (i Instruction) Next() uint16 {
+	return i.Address + uint16(len(i.Bytes))
+}
+
+var officialMnemonics = map[string]bool{
+	"ADC": true, "AND": true, "ASL": true, "BCC": true, "BCS": true, "BEQ": true, "BIT": true, "BMI": true,
+	"BNE": true, "BPL": true, "BRK": true, "BVC": true, "BVS": true, "CLC": true, "CLD": true, "CLI": true,
+	"CLV": true, "CMP": true, "CPX": true, "CPY": true, "DEC": true, "DEX": true, "DEY": true, "EOR": true,
+	"INC": true, "INX": true, "INY": true, "JMP": true, "JSR": true, "LDA": true, "LDX": true, "LDY": true,
+	"LSR": true, "NOP": true, "ORA": true, "PHA": true, "PHP": true, "PLA": true, "PLP": true, "ROL": true,
+	"ROR": true, "RTI": true, "RTS": true, "SBC": true, "SEC": true, "SED": true, "SEI": true, "STA": true,
+	"STX": true, "STY": true, "TAX": true, "TAY": true, "TSX": true, "TXA": true, "TXS": true, "TYA": true,
+}
+
+// unofficialDuplicates are undocumented opcodes sharing a name and mode with
+// a documented one
+var unofficialDuplicates = map[byte]bool{
+	0xEB: true,
+}
+
+// Mnemonic is the instruction name without the unofficial * marker
+func Mnemonic(operation *cpu.Operation) string {
+	return strings.TrimPrefix(strings.Split(operation.Name, " ")[0], "*")
+}
+
+type Disassembler struct {
+	variant cpu.Variant
+	opcodes map[byte]*cpu.Operation
+}
+
+func Create(variant cpu.Variant) *Disassembler {
+	return &Disassembler{
+		variant: variant,
+		opcodes: cpu.GetVariantOpcodes(variant),
+	}
+}
+
+func (d *Disassembler) Variant() cpu.Variant {
+	return d.variant
+}
+
+// Decode reads a single instruction at address
+func (d *Disassembler) Decode(r Reader, address uint16) Instruction {
+	if peeker, ok := r.(cpu.Peeker); ok {
+		return d.decode(func(a uint16) (byte, bool) {
+			return peeker.PeekByteAt(a), true
+		}, address)
+	}
+
+	return d.decode(func(a uint16) (byte, bool) {
+		return r.ReadByteAt(a), true
+	}, address)
+}
+
+func (d *Disassembler) decode(read func(uint16) (byte, bool), address uint16) Instruction {
+	opcode, _ := read(address)
+	result := Instruction{
+		Address: address,
+		Bytes:   []byte{opcode},
+		Opcode:  opcode,
+	}
+
+	operation, ok := d.opcodes[opcode]
+	if !ok {
+		result.Data = true
+		return result
+	}
+
+	result.Mnemonic = Mnemonic(operation)
+	result.Mode = operation.AddressMode
+	// The 65C02 marks its undocumented NOPs and its new mnemonics are all
+	// documented
+	result.Unofficial = strings.HasPrefix(operation.Name, "*") || d.variant != cpu.Variant65C02 &&
+		(!officialMnemonics[result.Mnemonic] || unofficialDuplicates[opcode])
+
+	for i := 0; i < int(operation.AddressMode.OperandLength()); i++ {
+		value, ok := read(address + 1 + uint16(i))
+		if !ok {
+			result.Data = true
+			return result
+		}
+		result.Bytes = append(result.Bytes, value)
+		result.Operand |= uint16(value) << (8 * i)
+	}
+
+	switch {
+	case operation.AddressMode == cpu.AddressModeRelative:
+		result.Target = address + 2 + uint16(int8(result.Operand))
+		result.HasTarget = true
+	case operation.AddressMode == cpu.AddressModeAbsolute && (result.Mnemonic == "JMP" || result.Mnemonic == "JSR"):
+		result.Target = result.Operand
+		result.HasTarget = true
+	}
+
+	return result
+}
+
+// DisassembleReader decodes count instructions one after another from start
+func (d *Disassembler) DisassembleReader(r Reader, start uint16, count int) []Instruction {
+	result := make([]Instruction, 0, count)
+	address := start
+	for i := 0; i < count; i++ {
+		inst := d.Decode(r, address)
+		result = append(result, inst)
+		address = inst.Next()
+	}
+
+	return result
+}
+
+// DisassembleBytes decodes data as if it was loaded at start, an instruction
+// cut off by the end of data comes back as Data
+func (d *Disassembler) DisassembleBytes(data []byte, start uint16) []Instruction {
+	read := func(address uint16) (byte, bool) {
+		offset := int(address - start)
+		if offset >= len(data) {
+			return 0, false
+		}
+		return data[offset], true
+	}
+
+	result := make([]Instruction, 0, len(data)/2)
+	for offset := 0; offset < len(data); {
+		inst := d.decode(read, start+uint16(offset))
+		result = append(result, inst)
+		offset += inst.Length()
+	}
+
+	return result
+}
+
+// Disassemble decodes 2A03 code in data as if it was loaded at start
+func Disassemble(data []byte, start uint16) []Instruction {
+	return Create(cpu.Variant2A03).DisassembleBytes(data, start)
+}
+
+// DisassembleReader decodes count 2A03 instructions from start
+func DisassembleReader(r Reader, start uint16, count int) []Instruction {
+	return Create(cpu.Variant2A03).DisassembleReader(r, start, count)
+}
@@ -0,0 +1,108 @@
+package disassembler_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/disassembler"
+	"github.com/stretchr/testify/assert"
+)
+
+type testReader struct {
+	data [0x10000]byte
+}
+
+func (r *testReader) ReadByteAt(address uint16) byte {
+	return r.data[address]
+}
+
+func TestDisassemble(t *testing.T) {
+	t.Parallel()
+
+	program := []byte{
+		0xA9, 0x10, // LDA #$10
+		0x9D, 0x00, 0x02, // STA $0200,X
+		0xD0, 0xF9, // BNE $8000
+		0x20, 0x34, 0x12, // JSR $1234
+		0x0A,       // ASL A
+		0xA7, 0x10, // LAX $10
+		0xEB, 0x01, // SBC #$01
+		0x4C, // JMP cut off
+	}
+
+	insts := disassembler.Disassemble(program, 0x8000)
+
+	assert.Len(t, insts, 8)
+
+	assert.Equal(t, uint16(0x8000), insts[0].Address)
+	assert.Equal(t, "LDA", insts[0].Mnemonic)
+	assert.Equal(t, cpu.AddressModeImmediate, insts[0].Mode)
+	assert.Equal(t, uint16(0x10), insts[0].Operand)
+	assert.False(t, insts[0].HasTarget)
+
+	assert.Equal(t, uint16(0x8002), insts[1].Address)
+	assert.Equal(t, []byte{0x9D, 0x00, 0x02}, insts[1].Bytes)
+	assert.Equal(t, uint16(0x0200), insts[1].Operand)
+	assert.Equal(t, cpu.AddressModeAbsoluteX, insts[1].Mode)
+
+	assert.Equal(t, "BNE", insts[2].Mnemonic)
+	assert.True(t, insts[2].HasTarget)
+	assert.Equal(t, uint16(0x8000), insts[2].Target)
+
+	assert.Equal(t, "JSR", insts[3].Mnemonic)
+	assert.True(t, insts[3].HasTarget)
+	assert.Equal(t, uint16(0x1234), insts[3].Target)
+
+	assert.Equal(t, cpu.AddressModeAccumulator, insts[4].Mode)
+	assert.Equal(t, 1, insts[4].Length())
+
+	assert.Equal(t, "LAX", insts[5].Mnemonic)
+	assert.True(t, insts[5].Unofficial)
+	assert.True(t, insts[6].Unofficial)
+	assert.False(t, insts[0].Unofficial)
+
+	assert.True(t, insts[7].Data)
+	assert.Equal(t, []byte{0x4C}, insts[7].Bytes)
+}
+
+func TestDisassembleReader(t *testing.T) {
+	t.Parallel()
+
+	r := &testReader{}
+	copy(r.data[0xFFFE:], []byte{0xEA, 0xEA})
+	copy(r.data[0x0000:], []byte{0xA9, 0x01})
+
+	insts := disassembler.DisassembleReader(r, 0xFFFE, 3)
+	assert.Equal(t, uint16(0xFFFE), insts[0].Address)
+	assert.Equal(t, uint16(0xFFFF), insts[1].Address)
+	// Wraps around the address space
+	assert.Equal(t, uint16(0x0000), insts[2].Address)
+	assert.Equal(t, "LDA", insts[2].Mnemonic)
+}
+
+func TestDisassembleVariant(t *testing.T) {
+	t.Parallel()
+
+	d := disassembler.Create(cpu.Variant65C02)
+	insts := d.DisassembleBytes([]byte{0x80, 0x02, 0xB2, 0x10, 0x7C, 0x00, 0x90}, 0x8000)
+
+	assert.Equal(t, "BRA", insts[0].Mnemonic)
+	assert.Equal(t, uint16(0x8004), insts[0].Target)
+	assert.Equal(t, cpu.AddressModeZeroPageIndirect, insts[1].Mode)
+	assert.Equal(t, cpu.AddressModeAbsoluteIndirectX, insts[2].Mode)
+	assert.False(t, insts[2].HasTarget)
+	assert.Equal(t, "Relative", fmt.Sprint(insts[0].Mode))
+	for _, inst := range insts {
+		assert.False(t, inst.Unofficial)
+	}
+
+	// Undocumented NOPs don't assemble back to the same bytes
+	insts = d.DisassembleBytes([]byte{0x03, 0x02, 0x11, 0xEA}, 0x8000)
+	assert.True(t, insts[0].Unofficial)
+	assert.True(t, insts[1].Unofficial)
+	assert.False(t, insts[2].Unofficial)
+	f := &disassembler.Formatter{Syntax: disassembler.SyntaxCa65}
+	assert.Equal(t, ".byte $02, $11", f.Instruction(insts[1]))
+	assert.Equal(t, "nop", f.Instruction(insts[2]))
+}
@@ -0,0 +1,186 @@
+package disassembler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sardap/gos/cpu"
+)
+
+type Syntax int
+
+const (
+	// SyntaxListing is address, bytes and instruction on every line
+	SyntaxListing Syntax = iota
+	// SyntaxCa65 can be fed back into ca65 to get the same bytes
+	SyntaxCa65
+)
+
+// Symbols names addresses, they replace the address in operands and become
+// labels in ca65 output
+type Symbols map[uint16]string
+
+type Formatter struct {
+	Syntax  Syntax
+	Symbols Symbols
+}
+
+func (f *Formatter) address(address uint16, zeroPage bool) string {
+	if name, ok := f.Symbols[address]; ok {
+		// ca65 picks zero page addressing for anything that fits
+		if f.Syntax == SyntaxCa65 && !zeroPage && address < 0x100 {
+			return "a:" + name
+		}
+		return name
+	}
+
+	if zeroPage {
+		return fmt.Sprintf("$%02X", address)
+	}
+	if f.Syntax == SyntaxCa65 && address < 0x100 {
+		return fmt.Sprintf("a:$%04X", address)
+	}
+	return fmt.Sprintf("$%04X", address)
+}
+
+// register is lower case for ca65 to match the mnemonics
+func (f *Formatter) register(name string) string {
+	if f.Syntax == SyntaxCa65 {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func (f *Formatter) Operand(inst Instruction) string {
+	switch inst.Mode {
+	case cpu.AddressModeImmediate:
+		return fmt.Sprintf("#$%02X", inst.Operand)
+	case cpu.AddressModeZeroPage:
+		return f.address(inst.Operand, true)
+	case cpu.AddressModeZeroPageX:
+		return f.address(inst.Operand, true) + f.register(",X")
+	case cpu.AddressModeZeroPageY:
+		return f.address(inst.Operand, true) + f.register(",Y")
+	case cpu.AddressModeAbsolute:
+		return f.address(inst.Operand, false)
+	case cpu.AddressModeAbsoluteX:
+		return f.address(inst.Operand, false) + f.register(",X")
+	case cpu.AddressModeAbsoluteY:
+		return f.address(inst.Operand, false) + f.register(",Y")
+	case cpu.AddressModeIndirect:
+		return "(" + f.address(inst.Operand, false) + ")"
+	case cpu.AddressModeIndirectX:
+		return "(" + f.address(inst.Operand, true) + f.register(",X)")
+	case cpu.AddressModeIndirectY:
+		return "(" + f.address(inst.Operand, true) + f.register("),Y")
+	case cpu.AddressModeZeroPageIndirect:
+		return "(" + f.address(inst.Operand, true) + ")"
+	case cpu.AddressModeAbsoluteIndirectX:
+		return "(" + f.address(inst.Operand, false) + f.register(",X)")
+	case cpu.AddressModeAccumulator:
+		return f.register("A")
+	case cpu.AddressModeRelative:
+		if name, ok := f.Symbols[inst.Target]; ok {
+			return name
+		}
+		return fmt.Sprintf("$%04X", inst.Target)
+	}
+
+	return ""
+}
+
+func hexBytes(data []byte, separator string) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("$%02X", b)
+	}
+	return strings.Join(parts, separator)
+}
+
+// Instruction formats the mnemonic and operand, or a .byte line in ca65 when
+// assembling it wouldn't give back the same bytes
+func (f *Formatter) Instruction(inst Instruction) string {
+	if f.Syntax == SyntaxCa65 && (inst.Data || inst.Unofficial) {
+		return ".byte " + hexBytes(inst.Bytes, ", ")
+	}
+	if inst.Data {
+		return ".byte " + hexBytes(inst.Bytes, " ")
+	}
+
+	mnemonic := inst.Mnemonic
+	if f.Syntax == SyntaxCa65 {
+		mnemonic = strings.ToLower(mnemonic)
+	}
+
+	operand := f.Operand(inst)
+	if operand == "" {
+		return mnemonic
+	}
+	return mnemonic + " " + operand
+}
+
+// Format is a single line without labels
+func (f *Formatter) Format(inst Instruction) string {
+	if f.Syntax == SyntaxCa65 {
+		return "\t" + f.Instruction(inst)
+	}
+
+	raw := make([]string, len(inst.Bytes))
+	for i, b := range inst.Bytes {
+		raw[i] = fmt.Sprintf("%02X", b)
+	}
+
+	unofficial := " "
+	if inst.Unofficial {
+		unofficial = "*"
+	}
+
+	return fmt.Sprintf("%04X  %-8s %s%s", inst.Address, strings.Join(raw, " "), unofficial, f.Instruction(inst))
+}
+
+// Write writes every instruction with a line before each one that has a
+// symbol. ca65 output starts with the CPU, the origin and the symbols that
+// don't land on an instruction.
+func (f *Formatter) Write(w io.Writer, variant cpu.Variant, insts []Instruction) error {
+	var builder strings.Builder
+
+	if f.Syntax == SyntaxCa65 && len(insts) > 0 {
+		switch variant {
+		case cpu.Variant65C02:
+			builder.WriteString(".setcpu \"65C02\"\n")
+		default:
+			builder.WriteString(".setcpu \"6502\"\n")
+		}
+
+		starts := make(map[uint16]bool, len(insts))
+		for _, inst := range insts {
+			starts[inst.Address] = true
+		}
+
+		addresses := make([]int, 0, len(f.Symbols))
+		for address := range f.Symbols {
+			if !starts[address] {
+				addresses = append(addresses, int(address))
+			}
+		}
+		sort.Ints(addresses)
+		for _, address := range addresses {
+			builder.WriteString(fmt.Sprintf("%s = $%04X\n", f.Symbols[uint16(address)], address))
+		}
+
+		builder.WriteString(fmt.Sprintf(".org $%04X\n", insts[0].Address))
+	}
+
+	for _, inst := range insts {
+		if name, ok := f.Symbols[inst.Address]; ok {
+			builder.WriteString(name + ":\n")
+		}
+		builder.WriteString(f.Format(inst))
+		builder.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
@@ -0,0 +1,77 @@
+package disassembler_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/disassembler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	insts := disassembler.Disassemble([]byte{
+		0xB1, 0x10, // LDA ($10),Y
+		0xAD, 0x20, 0x00, // LDA $0020
+		0x04, 0x10, // *NOP $10
+		0x4A, // LSR A
+	}, 0xC000)
+
+	f := &disassembler.Formatter{}
+	assert.Equal(t, "C000  B1 10     LDA ($10),Y", f.Format(insts[0]))
+	assert.Equal(t, "C002  AD 20 00  LDA $0020", f.Format(insts[1]))
+	assert.Equal(t, "C005  04 10    *NOP $10", f.Format(insts[2]))
+	assert.Equal(t, "C007  4A        LSR A", f.Format(insts[3]))
+
+	f.Syntax = disassembler.SyntaxCa65
+	assert.Equal(t, "\tlda ($10),y", f.Format(insts[0]))
+	// Forced absolute so ca65 doesn't pick zero page
+	assert.Equal(t, "\tlda a:$0020", f.Format(insts[1]))
+	assert.Equal(t, "\t.byte $04, $10", f.Format(insts[2]))
+	assert.Equal(t, "\tlsr a", f.Format(insts[3]))
+}
+
+func TestWriteCa65(t *testing.T) {
+	t.Parallel()
+
+	insts := disassembler.Disassemble([]byte{
+		0xAD, 0x02, 0x20, // LDA $2002
+		0x10, 0xFB, // BPL $8000
+		0x85, 0x10, // STA $10
+		0x4C, 0x00, 0x80, // JMP $8000
+	}, 0x8000)
+
+	f := &disassembler.Formatter{
+		Syntax: disassembler.SyntaxCa65,
+		Symbols: disassembler.Symbols{
+			0x8000: "wait",
+			0x2002: "PPUSTATUS",
+			0x0010: "temp",
+		},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(t, f.Write(&buffer, cpu.Variant2A03, insts))
+	assert.Equal(t, `.setcpu "6502"
+temp = $0010
+PPUSTATUS = $2002
+.org $8000
+wait:
+	lda PPUSTATUS
+	bpl wait
+	sta temp
+	jmp wait
+`, buffer.String())
+
+	f.Syntax = disassembler.SyntaxListing
+	buffer.Reset()
+	assert.NoError(t, f.Write(&buffer, cpu.Variant2A03, insts))
+	assert.Equal(t, `wait:
+8000  AD 02 20  LDA PPUSTATUS
+8003  10 FB     BPL wait
+8005  85 10     STA temp
+8007  4C 00 80  JMP wait
+`, buffer.String())
+}
@@ -1,37 +1,175 @@
 package emulator
 
 import (
+	"fmt"
 	"io"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/input"
 	"github.com/sardap/gos/memory"
 	"github.com/sardap/gos/ppu"
 )
 
+var (
+	ErrNotController = fmt.Errorf("port doesn't have a standard controller")
+)
+
 type Emulator struct {
 	Memory *memory.Memory
 	Ppu    *ppu.Ppu
 	Cpu    *cpu.Cpu
+
+	// SavePath is where battery backed RAM is kept, LoadRomFile sets it
+	SavePath string
+	// FlushInterval is how often RunFrame flushes the save, zero only
+	// flushes on Close
+	FlushInterval time.Duration
+	// saved is what's in the save file
+	saved     []byte
+	lastFlush time.Time
+
+	// stall is kept so running DMA doesn't allocate a method value
+	stall func()
 }
 
 func Create() *Emulator {
 	result := &Emulator{}
 	result.Memory = memory.Create()
 	result.Ppu = ppu.Create()
-	result.Cpu = cpu.CreateCpu(result.Memory, result.Ppu)
+	result.Cpu = cpu.CreateCpu(result.Memory)
+	result.Cpu.Ppu = result.Ppu
+	result.Ppu.Registers = result.Memory.PpuRegisters
+	result.Ppu.Watch = result.Memory.PpuAddress
+	result.Ppu.Fetch = result.Memory.FetchChr
+	result.Ppu.ReadChr = result.Memory.ReadChr
+	result.Ppu.WriteChr = result.Memory.WriteChr
+	result.Ppu.Nametable = result.Memory.Nametable
+	result.Cpu.Tick = result.tick
+	result.stall = func() {
+		result.Cpu.Stall(1)
+	}
 
 	return result
 }
 
+// tick runs once per CPU cycle
+func (e *Emulator) tick() {
+	e.Memory.Tick()
+	for i := 0; i < 3; i++ {
+		e.Ppu.Tick()
+	}
+	e.Cpu.SetIrq(cpu.IrqSourceMapper, e.Memory.CartIrq())
+}
+
+// LoadRom inserts the cart and powers the console on, without a SavePath
+// nothing is saved
 func (e *Emulator) LoadRom(r io.Reader) error {
-	return e.Memory.LoadRom(r)
+	if err := e.Memory.LoadRom(r); err != nil {
+		return err
+	}
+	e.SavePath = ""
+	e.saved = nil
+
+	return e.PowerOn()
 }
 
-func (e *Emulator) Step() {
+// PowerOn applies the power up state and starts from the reset vector
+func (e *Emulator) PowerOn() error {
+	e.Memory.PowerOn()
+	e.Cpu.PowerOn()
+
+	return e.busError(cpu.ResetVector)
+}
+
+// PowerOnAt powers on but forces the program counter, used to start nestest
+// in automation mode at cpu.StartingPC
+func (e *Emulator) PowerOnAt(pc uint16) error {
+	err := e.PowerOn()
+	e.Cpu.Registers.PC = pc
+
+	return err
+}
+
+// Reset presses the reset button, ram and most registers survive
+func (e *Emulator) Reset() error {
+	e.Memory.Reset()
+	e.Cpu.Reset()
+
+	return e.Step()
+}
+
+// Connect plugs a device into controller port 1 or 2, nil unplugs it
+func (e *Emulator) Connect(port int, device input.Device) error {
+	return e.Memory.Input.Connect(port, device)
+}
+
+// SetButtons holds down buttons on the standard controller in port 1 or 2
+// until they're set again, an empty port gets a controller plugged in
+func (e *Emulator) SetButtons(port int, buttons input.Button) error {
+	var device input.Device
+	switch port {
+	case 1:
+		device = e.Memory.Input.Port1
+	case 2:
+		device = e.Memory.Input.Port2
+	default:
+		return input.ErrInvalidPort
+	}
+
+	if device == nil {
+		device = &input.Controller{}
+		e.Connect(port, device)
+	}
+
+	controller, ok := device.(*input.Controller)
+	if !ok {
+		return errors.Wrapf(ErrNotController, "port %d", port)
+	}
+	controller.Buttons = buttons
+
+	return nil
+}
+
+// Halted reports the CPU hit a JAM opcode, only Reset or PowerOn recovers
+func (e *Emulator) Halted() bool {
+	return e.Cpu.Halted
+}
+
+// Step runs one instruction and any DMA it started. Failed bus accesses don't
+// stop the instruction but it returns the first one as an *Error.
+func (e *Emulator) Step() error {
+	pc := e.Cpu.Registers.PC
 	e.Cpu.Cycles = 0
-	e.Cpu.Excute()
+	err := e.Cpu.Excute()
+	e.Memory.RunDma(e.Cpu.TotalCycles, e.stall)
+	if err == nil {
+		err = e.Memory.Err()
+	}
+	e.Memory.ClearErr()
 
 	ppuWrites := e.Memory.PpuRegisters.GetPendingWrites()
-	e.Ppu.Step(ppuWrites)
+	if ppuErr := e.Ppu.Step(ppuWrites); err == nil {
+		err = ppuErr
+	}
 	e.Memory.PpuRegisters.ClearPendingWrites()
+
+	if err != nil {
+		return e.error(pc, err)
+	}
+	return nil
+}
+
+// RunFrame steps until the PPU starts the next frame or something fails,
+// then flushes the save if FlushInterval is up
+func (e *Emulator) RunFrame() error {
+	frame := e.Ppu.Frame
+	for e.Ppu.Frame == frame {
+		if err := e.Step(); err != nil {
+			return err
+		}
+	}
+
+	return e.autoFlush()
 }
@@ -14,9 +14,13 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sardap/gos/cpu"
 	"github.com/sardap/gos/emulator"
+	"github.com/sardap/gos/input"
+	"github.com/sardap/gos/memory"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -194,7 +198,7 @@ func parseNesTestLine(line string) nesTestLine {
 func emulatorToTestLine(e *emulator.Emulator, cycles int64) nesTestLine {
 	return nesTestLine{
 		PC:     e.Cpu.Registers.PC,
-		Opcode: e.Memory.ReadByteAt(e.Cpu.Registers.PC),
+		Opcode: e.Memory.PeekByteAt(e.Cpu.Registers.PC),
 		A:      e.Cpu.Registers.A,
 		X:      e.Cpu.Registers.X,
 		Y:      e.Cpu.Registers.Y,
@@ -228,6 +232,7 @@ func TestNesTestRom(t *testing.T) {
 		// Test loading rom
 		romBytes, _ := os.ReadFile(nesTestRomPath)
 		e.LoadRom(bytes.NewBuffer(romBytes))
+		e.PowerOnAt(cpu.StartingPC)
 
 		// Run
 		testRomLog, _ := os.ReadFile(nesTestValidLogPath)
@@ -275,12 +280,13 @@ func (c *testCart) WriteBytesChr(value []byte) error {
 	return nil
 }
 
-func (c *testCart) WriteByteAt(address uint16, value byte) {
+func (c *testCart) WriteByteAt(address uint16, value byte) error {
 	c.data[address] = value
+	return nil
 }
 
-func (c *testCart) ReadByteAt(address uint16) byte {
-	return c.data[address]
+func (c *testCart) ReadByteAt(address uint16) (byte, error) {
+	return c.data[address], nil
 }
 
 func TestRtsTrick(t *testing.T) {
@@ -323,3 +329,323 @@ func TestRtsTrick(t *testing.T) {
 	e.Step()
 	assert.Equal(t, uint16(0xC0E3), e.Cpu.Registers.PC)
 }
+
+func TestPowerOnAndReset(t *testing.T) {
+	t.Parallel()
+
+	e := emulator.Create()
+	cart := &testCart{}
+	e.Memory.SetCart(cart)
+	cart.data[cpu.ResetVector] = 0x34
+	cart.data[cpu.ResetVector+1] = 0x82
+	e.Memory.WriteByteAt(0x0010, 0xAB)
+
+	e.PowerOn()
+
+	assert.Equal(t, uint16(0x8234), e.Cpu.Registers.PC)
+	assert.Equal(t, byte(0xFD), e.Cpu.Registers.SP)
+	assert.Equal(t, byte(0x24), e.Cpu.Registers.P.Read())
+	assert.Equal(t, byte(0x00), e.Memory.ReadByteAt(0x0010))
+
+	e.Memory.WriteByteAt(0x0010, 0xAB)
+	e.Cpu.Registers.A = 0x12
+	e.Cpu.Registers.P.SetFlag(cpu.FlagInteruprtDisable, false)
+	e.Memory.Apu.ChannelEnable = 0x0F
+	e.Cpu.Registers.PC = 0x9000
+
+	e.Reset()
+
+	assert.Equal(t, uint16(0x8234), e.Cpu.Registers.PC)
+	assert.Equal(t, byte(0xFA), e.Cpu.Registers.SP)
+	assert.Equal(t, byte(0x12), e.Cpu.Registers.A)
+	assert.True(t, e.Cpu.Registers.P.ReadFlag(cpu.FlagInteruprtDisable))
+	assert.Equal(t, byte(0xAB), e.Memory.ReadByteAt(0x0010))
+	assert.Equal(t, byte(0x00), e.Memory.Apu.ChannelEnable)
+
+	// nestest automation mode
+	e.PowerOnAt(cpu.StartingPC)
+
+	assert.Equal(t, uint16(cpu.StartingPC), e.Cpu.Registers.PC)
+	assert.Equal(t, byte(cpu.StartingSP), e.Cpu.Registers.SP)
+	assert.Equal(t, byte(cpu.StartingP), e.Cpu.Registers.P.Read())
+}
+
+func TestPpuTicksWithCpu(t *testing.T) {
+	t.Parallel()
+
+	for _, accurate := range []bool{false, true} {
+		e := emulator.Create()
+		cart := &testCart{}
+		e.Memory.SetCart(cart)
+		cart.data[cpu.ResetVector+1] = 0x80
+		// INC $9000
+		copy(cart.data[0x8000:], []byte{0xEE, 0x00, 0x90})
+		e.PowerOn()
+		e.Cpu.CycleAccurate = accurate
+
+		dot := e.Ppu.Dot
+		e.Step()
+
+		assert.Equal(t, 6, e.Cpu.Cycles)
+		assert.Equal(t, dot+6*3, e.Ppu.Dot)
+	}
+}
+
+func BenchmarkFrame(b *testing.B) {
+	e := emulator.Create()
+	cart := &testCart{}
+	e.Memory.SetCart(cart)
+	cart.data[cpu.ResetVector+1] = 0x80
+	copy(cart.data[0x8000:], []byte{
+		0xA2, 0x00, // 8000 LDX #$00
+		0xB5, 0x10, // 8002 LDA $10,X
+		0x69, 0x01, // 8004 ADC #$01
+		0x9D, 0x00, 0x03, // 8006 STA $0300,X
+		0x8D, 0x07, 0x20, // 8009 STA $2007
+		0xE8,       // 800C INX
+		0xD0, 0xF3, // 800D BNE $8002
+		0x4C, 0x00, 0x80, // 800F JMP $8000
+	})
+	e.PowerOn()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if err := e.RunFrame(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "frames/s")
+}
+
+func TestStepErrors(t *testing.T) {
+	t.Parallel()
+
+	e := emulator.Create()
+	e.Memory.Policy = memory.PolicyStrict
+	cart := &testCart{}
+	e.Memory.SetCart(cart)
+	cart.data[cpu.ResetVector+1] = 0x80
+	copy(cart.data[0x8000:], []byte{
+		0xA2, 0x12, // 8000 LDX #$12
+		0xAD, 0x18, 0x40, // 8002 LDA $4018
+		0x4C, 0x02, 0x80, // 8005 JMP $8002
+	})
+	assert.NoError(t, e.PowerOn())
+	assert.NoError(t, e.Step())
+
+	err := e.Step()
+	var emulatorErr *emulator.Error
+	assert.True(t, errors.As(err, &emulatorErr))
+	assert.Equal(t, memory.SubsystemIo, emulatorErr.Subsystem)
+	assert.Equal(t, uint16(0x4018), emulatorErr.Address)
+	assert.Equal(t, uint16(0x8002), emulatorErr.Pc)
+	assert.Equal(t, byte(0x12), emulatorErr.X)
+	assert.True(t, errors.Is(err, memory.ErrInvalidAddress))
+	// A got the open bus value, the high byte of the operand
+	assert.Equal(t,
+		"io read $4018: invalid address at $8002 A:40 X:12 Y:00 P:24 SP:FD CYC:13",
+		err.Error(),
+	)
+
+	// The error doesn't stick around
+	assert.NoError(t, e.Step())
+
+	e.Memory.Policy = memory.PolicyLenient
+	assert.NoError(t, e.RunFrame())
+	assert.NoError(t, e.RunFrame())
+	assert.Equal(t, 2, e.Ppu.Frame)
+}
+
+func TestOamDma(t *testing.T) {
+	t.Parallel()
+
+	e := emulator.Create()
+	cart := &testCart{}
+	e.Memory.SetCart(cart)
+	cart.data[cpu.ResetVector+1] = 0x80
+	copy(cart.data[0x8000:], []byte{
+		0xA9, 0x02, // 8000 LDA #$02
+		0x8D, 0x14, 0x40, // 8002 STA $4014
+		0x24, 0x00, // 8005 BIT $00
+		0x8D, 0x14, 0x40, // 8007 STA $4014
+	})
+	assert.NoError(t, e.PowerOn())
+	for i := 0; i < 0x100; i++ {
+		e.Memory.WriteByteAt(0x0200+uint16(i), byte(i))
+	}
+
+	assert.NoError(t, e.Step())
+	// Power on is 7 cycles and LDA 2 so the STA ends on an odd cycle
+	assert.NoError(t, e.Step())
+	assert.Equal(t, 4+514, e.Cpu.Cycles)
+	assert.Equal(t, int64(527), e.Cpu.TotalCycles)
+	assert.Equal(t, byte(0xFF), e.Memory.PpuRegisters.Oam[0xFF])
+
+	assert.NoError(t, e.Step())
+	assert.NoError(t, e.Step())
+	assert.Equal(t, 4+513, e.Cpu.Cycles)
+}
+
+func TestSetButtons(t *testing.T) {
+	t.Parallel()
+
+	e := emulator.Create()
+	cart := &testCart{}
+	e.Memory.SetCart(cart)
+	cart.data[cpu.ResetVector+1] = 0x80
+	copy(cart.data[0x8000:], []byte{
+		0xA9, 0x01, // 8000 LDA #$01
+		0x8D, 0x16, 0x40, // 8002 STA $4016
+		0x4A,             // 8005 LSR A
+		0x8D, 0x16, 0x40, // 8006 STA $4016
+		0xAD, 0x16, 0x40, // 8009 LDA $4016
+		0xAE, 0x16, 0x40, // 800C LDX $4016
+		0xAC, 0x17, 0x40, // 800F LDY $4017
+	})
+	assert.NoError(t, e.PowerOn())
+
+	assert.NoError(t, e.SetButtons(1, input.ButtonB))
+	assert.Equal(t, input.ErrInvalidPort, e.SetButtons(3, input.ButtonB))
+	assert.NoError(t, e.Connect(2, struct{ input.Device }{}))
+	assert.True(t, errors.Is(e.SetButtons(2, input.ButtonA), emulator.ErrNotController))
+	assert.NoError(t, e.Connect(2, nil))
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, e.Step())
+	}
+	// Open bus $40 from the high byte of the address
+	assert.Equal(t, byte(0x40), e.Cpu.Registers.A)
+	assert.Equal(t, byte(0x41), e.Cpu.Registers.X)
+	assert.Equal(t, byte(0x40), e.Cpu.Registers.Y)
+}
+
+func TestMapperIrq(t *testing.T) {
+	t.Parallel()
+
+	// MMC3 with the program in the fixed bank at $E000
+	prg := make([]byte, 2*memory.PrgBankSize)
+	copy(prg[0x6000:], []byte{
+		0xA9, 0x10, // E000 LDA #$10
+		0x8D, 0x00, 0xC0, // E002 STA $C000
+		0x8D, 0x01, 0xC0, // E005 STA $C001
+		0x8D, 0x01, 0xE0, // E008 STA $E001
+		0xA9, 0x08, // E00B LDA #$08
+		0x8D, 0x00, 0x20, // E00D STA $2000
+		0xA9, 0x18, // E010 LDA #$18
+		0x8D, 0x01, 0x20, // E012 STA $2001
+		0x58,             // E015 CLI
+		0x4C, 0x16, 0xE0, // E016 JMP $E016
+		0x8D, 0x00, 0xE0, // E019 STA $E000
+		0x8D, 0x01, 0xE0, // E01C STA $E001
+		0xE6, 0x00, // E01F INC $00
+		0x40, // E021 RTI
+	})
+	prg[0x7FFC], prg[0x7FFD] = 0x00, 0xE0
+	prg[0x7FFE], prg[0x7FFF] = 0x19, 0xE0
+	rom := []byte{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x40, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, prg...)
+	rom = append(rom, make([]byte, memory.ChrBankSize)...)
+
+	e := emulator.Create()
+	assert.NoError(t, e.LoadRom(bytes.NewReader(rom)))
+
+	// Reloaded with 16 on the first line then 16 more
+	for e.Memory.PeekByteAt(0x0000) == 0 && e.Ppu.Frame == 0 {
+		assert.NoError(t, e.Step())
+	}
+	assert.Equal(t, byte(1), e.Memory.PeekByteAt(0x0000))
+	assert.Equal(t, 16, e.Ppu.Scanline)
+
+	// Every 17 lines after that until rendering stops at 240
+	assert.NoError(t, e.RunFrame())
+	assert.Equal(t, byte(14), e.Memory.PeekByteAt(0x0000))
+}
+
+func TestChrRam(t *testing.T) {
+	t.Parallel()
+
+	// NROM with CHR RAM
+	prg := make([]byte, memory.PrgBankSize)
+	copy(prg, []byte{
+		0xA9, 0x01, // C000 LDA #$01
+		0x8D, 0x06, 0x20, // C002 STA $2006
+		0xA9, 0x23, // C005 LDA #$23
+		0x8D, 0x06, 0x20, // C007 STA $2006
+		0xA9, 0xAB, // C00A LDA #$AB
+		0x8D, 0x07, 0x20, // C00C STA $2007
+		0xA9, 0xCD, // C00F LDA #$CD
+		0x8D, 0x07, 0x20, // C011 STA $2007
+		0x4C, 0x14, 0xC0, // C014 JMP $C014
+	})
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0
+	rom := []byte{0x4E, 0x45, 0x53, 0x1A, 0x01, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, prg...)
+
+	e := emulator.Create()
+	assert.NoError(t, e.LoadRom(bytes.NewReader(rom)))
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, e.Step())
+	}
+
+	// Rendering sees what was written and $2007 went up by one
+	assert.Equal(t, byte(0xAB), e.Memory.FetchChr(0x0123))
+	assert.Equal(t, byte(0xCD), e.Memory.FetchChr(0x0124))
+	value, err := e.Ppu.ReadByteAt(0x0124)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0xCD), value)
+}
+
+func TestMmc1ReadModifyWrite(t *testing.T) {
+	t.Parallel()
+
+	// 128KB MMC1 with the program in the last bank and each bank's number at
+	// its start
+	prg := make([]byte, 8*memory.PrgBankSize)
+	for i := 0; i < 8; i++ {
+		prg[i*memory.PrgBankSize] = byte(i)
+	}
+	copy(prg[7*memory.PrgBankSize+0x100:], []byte{
+		0xA9, 0x01, // C100 LDA #$01
+		0x8D, 0x00, 0xE0, // C102 STA $E000
+		0xEE, 0x50, 0xE0, // C105 INC $E050
+		0xA9, 0x00, // C108 LDA #$00
+		0x8D, 0x00, 0xE0, // C10A STA $E000
+		0x8D, 0x00, 0xE0, // C10D STA $E000
+		0x8D, 0x00, 0xE0, // C110 STA $E000
+		0x4C, 0x13, 0xC1, // C113 JMP $C113
+	})
+	prg[len(prg)-4], prg[len(prg)-3] = 0x00, 0xC1
+	rom := []byte{0x4E, 0x45, 0x53, 0x1A, 0x08, 0x00, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, prg...)
+
+	for _, accurate := range []bool{false, true} {
+		e := emulator.Create()
+		assert.NoError(t, e.LoadRom(bytes.NewReader(rom)))
+		e.Cpu.CycleAccurate = accurate
+		for i := 0; i < 7; i++ {
+			assert.NoError(t, e.Step())
+		}
+
+		// The INC's unmodified $00 is shifted in and its $01 is ignored
+		assert.Equal(t, byte(1), e.Memory.ReadByteAt(0x8000), "accurate %v", accurate)
+	}
+}
+
+func TestSingleScreenMirroring(t *testing.T) {
+	t.Parallel()
+
+	// AxROM shows the lower nametable everywhere after power on
+	rom := []byte{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x00, 0x70, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, make([]byte, 2*memory.PrgBankSize)...)
+
+	e := emulator.Create()
+	assert.NoError(t, e.LoadRom(bytes.NewReader(rom)))
+	assert.NoError(t, e.Ppu.WriteByteAt(0x2400, 0xAB))
+	for _, address := range []uint16{0x2000, 0x2400, 0x2800, 0x2C00} {
+		value, err := e.Ppu.ReadByteAt(address)
+		assert.NoError(t, err)
+		assert.Equalf(t, byte(0xAB), value, "%04X", address)
+	}
+}
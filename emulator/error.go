@@ -0,0 +1,73 @@
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/memory"
+)
+
+// Error is anything that went wrong running the console with the CPU state
+// at the time
+type Error struct {
+	Subsystem memory.Subsystem
+	// Address is where the failed access went, for CPU errors it's the
+	// instruction
+	Address uint16
+	// Pc is the instruction that was running, the registers are from after
+	// it stopped
+	Pc    uint16
+	A     byte
+	X     byte
+	Y     byte
+	P     byte
+	SP    byte
+	Cycle int64
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(
+		"%v at $%04X A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d",
+		e.Err, e.Pc, e.A, e.X, e.Y, e.P, e.SP, e.Cycle,
+	)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Emulator) error(pc uint16, err error) error {
+	r := e.Cpu.Registers
+	result := &Error{
+		Subsystem: memory.SubsystemCpu,
+		Address:   pc,
+		Pc:        pc,
+		A:         r.A,
+		X:         r.X,
+		Y:         r.Y,
+		P:         r.P.Read(),
+		SP:        r.SP,
+		Cycle:     e.Cpu.TotalCycles,
+		Err:       err,
+	}
+
+	var busErr *memory.BusError
+	if errors.As(err, &busErr) {
+		result.Subsystem = busErr.Subsystem
+		result.Address = busErr.Address
+	}
+
+	return result
+}
+
+// busError takes the access that failed since the last call off the bus
+func (e *Emulator) busError(pc uint16) error {
+	err := e.Memory.Err()
+	if err == nil {
+		return nil
+	}
+
+	e.Memory.ClearErr()
+	return e.error(pc, err)
+}
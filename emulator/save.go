@@ -0,0 +1,107 @@
+package emulator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSaveSize = fmt.Errorf("save file is the wrong size")
+)
+
+// LoadRomFile loads a .nes file and the .sav next to it if there is one,
+// battery backed RAM is then flushed back to the .sav
+func (e *Emulator) LoadRomFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := e.LoadRom(f); err != nil {
+		return err
+	}
+
+	e.SavePath = strings.TrimSuffix(path, filepath.Ext(path)) + ".sav"
+	return e.LoadSave()
+}
+
+// LoadSave reads SavePath into the cart's battery backed RAM, a missing file
+// is a new game
+func (e *Emulator) LoadSave() error {
+	e.lastFlush = time.Now()
+	ram := e.Memory.SaveRam()
+	if ram == nil || e.SavePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(e.SavePath)
+	switch {
+	case os.IsNotExist(err):
+		e.saved = nil
+		return nil
+	case err != nil:
+		return err
+	case len(data) != len(ram):
+		return errors.Wrapf(ErrSaveSize, "%s is %d bytes expected %d", e.SavePath, len(data), len(ram))
+	}
+
+	copy(ram, data)
+	e.saved = data
+	return nil
+}
+
+// FlushSave writes the battery backed RAM to SavePath if it's changed since
+// the last flush. It goes to a temp file that's renamed over the old save so
+// a crash part way through leaves the old one.
+func (e *Emulator) FlushSave() error {
+	e.lastFlush = time.Now()
+	ram := e.Memory.SaveRam()
+	if ram == nil || e.SavePath == "" || bytes.Equal(ram, e.saved) {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(e.SavePath), filepath.Base(e.SavePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(ram); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), e.SavePath); err != nil {
+		return err
+	}
+
+	e.saved = append(e.saved[:0], ram...)
+	return nil
+}
+
+// autoFlush flushes once FlushInterval has passed since the last one
+func (e *Emulator) autoFlush() error {
+	if e.FlushInterval <= 0 || time.Since(e.lastFlush) < e.FlushInterval {
+		return nil
+	}
+	return e.FlushSave()
+}
+
+// Close flushes the save, call it on shutdown
+func (e *Emulator) Close() error {
+	return e.FlushSave()
+}
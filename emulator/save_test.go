@@ -0,0 +1,99 @@
+package emulator_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/emulator"
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSaveRom writes an NROM game with battery backed RAM that stores $42
+// at $6000 then loops
+func writeSaveRom(t *testing.T, dir string) string {
+	prg := make([]byte, memory.PrgBankSize)
+	copy(prg, []byte{
+		0xA9, 0x42, // LDA #$42
+		0x8D, 0x00, 0x60, // STA $6000
+		0x4C, 0x05, 0x80, // JMP $8005
+	})
+	prg[0x3FFC] = 0x00
+	prg[0x3FFD] = 0x80
+
+	rom := []byte{0x4E, 0x45, 0x53, 0x1A, 0x01, 0x01, 0x02, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, prg...)
+	rom = append(rom, make([]byte, memory.ChrBankSize)...)
+
+	path := filepath.Join(dir, "game.nes")
+	assert.NoError(t, ioutil.WriteFile(path, rom, 0644))
+	return path
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := writeSaveRom(t, dir)
+	savePath := filepath.Join(dir, "game.sav")
+
+	e := emulator.Create()
+	assert.NoError(t, e.LoadRomFile(path))
+	assert.Equal(t, savePath, e.SavePath)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, e.Step())
+	}
+	assert.NoError(t, e.Close())
+
+	data, err := ioutil.ReadFile(savePath)
+	assert.NoError(t, err)
+	assert.Len(t, data, 0x2000)
+	assert.Equal(t, byte(0x42), data[0])
+	// Only the save is left behind
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 2)
+
+	// Nothing's changed so nothing's written
+	assert.NoError(t, os.Remove(savePath))
+	assert.NoError(t, e.FlushSave())
+	_, err = os.Stat(savePath)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, e.Memory.PokeByteAt(0x6001, 0x99))
+	assert.NoError(t, e.FlushSave())
+	data, err = ioutil.ReadFile(savePath)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x42, 0x99}, data[:2])
+
+	e = emulator.Create()
+	assert.NoError(t, e.LoadRomFile(path))
+	assert.Equal(t, byte(0x99), e.Memory.PeekByteAt(0x6001))
+
+	assert.NoError(t, ioutil.WriteFile(savePath, []byte{0x01}, 0644))
+	err = e.LoadRomFile(path)
+	assert.True(t, errors.Is(err, emulator.ErrSaveSize))
+}
+
+func TestFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := writeSaveRom(t, dir)
+	savePath := filepath.Join(dir, "game.sav")
+
+	e := emulator.Create()
+	assert.NoError(t, e.LoadRomFile(path))
+	assert.NoError(t, e.RunFrame())
+	_, err := os.Stat(savePath)
+	assert.True(t, os.IsNotExist(err))
+
+	e.FlushInterval = time.Nanosecond
+	assert.NoError(t, e.RunFrame())
+	data, err := ioutil.ReadFile(savePath)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x42), data[0])
+}
@@ -0,0 +1,102 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownButton = fmt.Errorf("unknown button")
+)
+
+// Button is a set of buttons in the order the controller sends them
+type Button byte
+
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+var buttonNames = []string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+// String is the pressed buttons joined with + like A+Start
+func (b Button) String() string {
+	result := []string{}
+	for i, name := range buttonNames {
+		if b&(1<<i) != 0 {
+			result = append(result, name)
+		}
+	}
+	return strings.Join(result, "+")
+}
+
+// ParseButtons reads the String form back, case doesn't matter and an empty
+// string is nothing pressed
+func ParseButtons(text string) (Button, error) {
+	var result Button
+	if text == "" {
+		return result, nil
+	}
+
+	for _, part := range strings.Split(text, "+") {
+		found := false
+		for i, name := range buttonNames {
+			if strings.EqualFold(strings.TrimSpace(part), name) {
+				result |= 1 << i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.Wrapf(ErrUnknownButton, "%q", part)
+		}
+	}
+
+	return result, nil
+}
+
+// Controller is the standard NES controller, a shift register loaded with the
+// buttons while strobe is high
+// https://wiki.nesdev.com/w/index.php/Standard_controller
+type Controller struct {
+	// Buttons being held down, set it before each frame
+	Buttons Button
+
+	strobe bool
+	shift  byte
+}
+
+// Strobe loads the shift register while it's high, the buttons when strobe
+// goes low are the ones shifted out
+func (c *Controller) Strobe(value byte) {
+	was := c.strobe
+	c.strobe = value&0x01 != 0
+	if c.strobe || was {
+		c.shift = byte(c.Buttons)
+	}
+}
+
+func (c *Controller) Read() byte {
+	result := c.Peek()
+	if !c.strobe {
+		// Official controllers read 1 once all 8 buttons are out
+		c.shift = c.shift>>1 | 0x80
+	}
+	return result
+}
+
+func (c *Controller) Peek() byte {
+	// While strobe is high it keeps reloading so only A comes out
+	if c.strobe {
+		return byte(c.Buttons) & 0x01
+	}
+	return c.shift & 0x01
+}
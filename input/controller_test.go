@@ -0,0 +1,69 @@
+package input_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(d input.Device, count int) []byte {
+	result := []byte{}
+	for i := 0; i < count; i++ {
+		result = append(result, d.Read())
+	}
+	return result
+}
+
+func TestController(t *testing.T) {
+	t.Parallel()
+
+	c := &input.Controller{Buttons: input.ButtonA | input.ButtonStart | input.ButtonRight}
+
+	// Nothing latched yet
+	assert.Equal(t, []byte{0, 0}, readAll(c, 2))
+
+	c.Strobe(0x01)
+	// Strobe held high keeps returning A
+	assert.Equal(t, []byte{1, 1}, readAll(c, 2))
+	c.Buttons = input.ButtonB
+	assert.Equal(t, byte(0), c.Peek())
+
+	c.Buttons = input.ButtonA | input.ButtonStart | input.ButtonRight
+	c.Strobe(0x00)
+	c.Buttons = 0
+	assert.Equal(t, byte(1), c.Peek())
+	assert.Equal(t, byte(1), c.Peek())
+	// A B Select Start Up Down Left Right then 1s
+	assert.Equal(t, []byte{1, 0, 0, 1, 0, 0, 0, 1, 1, 1}, readAll(c, 10))
+
+	// Buttons changed while strobe is high are loaded when it goes low
+	c.Buttons = input.ButtonB
+	c.Strobe(0x01)
+	c.Buttons = input.ButtonA | input.ButtonSelect
+	c.Strobe(0x00)
+	assert.Equal(t, []byte{1, 0, 1, 0, 0, 0, 0, 0}, readAll(c, 8))
+
+	// Writing 0 again doesn't reload
+	c.Strobe(0x00)
+	assert.Equal(t, byte(1), c.Read())
+}
+
+func TestButtonString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "A+Start+Left", (input.ButtonA | input.ButtonLeft | input.ButtonStart).String())
+	assert.Equal(t, "", input.Button(0).String())
+
+	buttons, err := input.ParseButtons("start+a + LEFT")
+	assert.NoError(t, err)
+	assert.Equal(t, input.ButtonA|input.ButtonLeft|input.ButtonStart, buttons)
+
+	buttons, err = input.ParseButtons("")
+	assert.NoError(t, err)
+	assert.Equal(t, input.Button(0), buttons)
+
+	_, err = input.ParseButtons("A+Turbo")
+	assert.True(t, errors.Is(err, input.ErrUnknownButton))
+}
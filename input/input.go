@@ -0,0 +1,81 @@
+package input
+
+import "fmt"
+
+var (
+	ErrInvalidPort = fmt.Errorf("invalid controller port")
+)
+
+// DataMask is the bits of $4016 and $4017 the ports drive, the rest are open
+// bus
+const DataMask = 0x1F
+
+// Device is anything plugged into a controller port
+// https://wiki.nesdev.com/w/index.php/Input_devices
+type Device interface {
+	// Strobe gets bits 0 to 2 of every $4016 write, bit 0 latches a
+	// controller's buttons
+	Strobe(value byte)
+	// Read returns the next serial bits on D0 to D4 and moves on
+	Read() byte
+	// Peek is Read without moving on
+	Peek() byte
+}
+
+// Ports are the two controller ports, nil is an empty port
+type Ports struct {
+	Port1 Device
+	Port2 Device
+}
+
+func (p *Ports) device(port int) (Device, error) {
+	switch port {
+	case 1:
+		return p.Port1, nil
+	case 2:
+		return p.Port2, nil
+	}
+
+	return nil, ErrInvalidPort
+}
+
+// Connect plugs device into port 1 or 2, nil unplugs it
+func (p *Ports) Connect(port int, device Device) error {
+	switch port {
+	case 1:
+		p.Port1 = device
+	case 2:
+		p.Port2 = device
+	default:
+		return ErrInvalidPort
+	}
+
+	return nil
+}
+
+// Strobe is a $4016 write, both ports see it
+func (p *Ports) Strobe(value byte) {
+	if p.Port1 != nil {
+		p.Port1.Strobe(value)
+	}
+	if p.Port2 != nil {
+		p.Port2.Strobe(value)
+	}
+}
+
+// Read is a $4016 read for port 1 or $4017 for port 2, empty ports read 0
+func (p *Ports) Read(port int) byte {
+	device, _ := p.device(port)
+	if device == nil {
+		return 0
+	}
+	return device.Read() & DataMask
+}
+
+func (p *Ports) Peek(port int) byte {
+	device, _ := p.device(port)
+	if device == nil {
+		return 0
+	}
+	return device.Peek() & DataMask
+}
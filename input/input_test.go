@@ -0,0 +1,50 @@
+package input_test
+
+import (
+	"testing"
+
+	"github.com/sardap/gos/input"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDevice drives every data line
+type recordingDevice struct {
+	strobes []byte
+}
+
+func (d *recordingDevice) Strobe(value byte) {
+	d.strobes = append(d.strobes, value)
+}
+
+func (d *recordingDevice) Read() byte {
+	return 0xFF
+}
+
+func (d *recordingDevice) Peek() byte {
+	return 0xFF
+}
+
+func TestPorts(t *testing.T) {
+	t.Parallel()
+
+	p := &input.Ports{}
+	assert.Equal(t, byte(0), p.Read(1))
+	p.Strobe(0x01)
+
+	device := &recordingDevice{}
+	controller := &input.Controller{Buttons: input.ButtonA}
+	assert.NoError(t, p.Connect(1, controller))
+	assert.NoError(t, p.Connect(2, device))
+	assert.Equal(t, input.ErrInvalidPort, p.Connect(3, device))
+
+	p.Strobe(0x05)
+	assert.Equal(t, []byte{0x05}, device.strobes)
+	assert.Equal(t, byte(0x01), p.Read(1))
+	// Only D0 to D4 are connected
+	assert.Equal(t, byte(0x1F), p.Read(2))
+	assert.Equal(t, byte(0x1F), p.Peek(2))
+	assert.Equal(t, byte(0), p.Read(0))
+
+	assert.NoError(t, p.Connect(2, nil))
+	assert.Equal(t, byte(0), p.Read(2))
+}
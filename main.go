@@ -1,26 +1,33 @@
 package main
 
 import (
+	"log"
 	"os"
 
+	"github.com/sardap/gos/cpu"
 	"github.com/sardap/gos/emulator"
 )
 
 func main() {
 	e := emulator.Create()
 
-	func() {
-		f, err := os.Open("assets\\nestest\\nestest.nes")
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-		if err := e.LoadRom(f); err != nil {
-			panic(err)
+	if err := e.LoadRomFile("assets\\nestest\\nestest.nes"); err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := e.Close(); err != nil {
+			log.Printf("saving: %v", err)
 		}
 	}()
 
-	for {
-		e.Step()
+	e.Cpu.Tracer = cpu.CreateLogTracer(os.Stdout, cpu.TraceFormatNesTest)
+
+	for !e.Halted() {
+		if err := e.Step(); err != nil {
+			log.Print(err)
+			return
+		}
 	}
+
+	log.Printf("cpu jammed at %04X", e.Cpu.Registers.PC)
 }
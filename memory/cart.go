@@ -1,145 +1,93 @@
 package memory
 
-import (
-	nesmath "github.com/sardap/gos/math"
-)
-
 type MirrorType int
 
 const (
 	MirrorTypeVertical MirrorType = iota
 	MirrorTypeHorizontal
+	// MirrorTypeSingleLower and MirrorTypeSingleUpper show one nametable in
+	// all four places
+	MirrorTypeSingleLower
+	MirrorTypeSingleUpper
 )
 
-type ControlByte1 struct {
-	MapperLowerBits      byte
-	FourScreenVramLayout bool
-	Trainer512Byte       bool // 0x7000 - 0x71FF
-	BatteryRam           bool // 0x6000 - 0x7FFF
-	MirrorType           MirrorType
-}
-
-func createControlByte1(data byte) *ControlByte1 {
-	result := &ControlByte1{}
-
-	mapperLower := byte(0)
-	mapperLower = nesmath.SetBit(mapperLower, 0, nesmath.BitSet(data, 4))
-	mapperLower = nesmath.SetBit(mapperLower, 1, nesmath.BitSet(data, 5))
-	mapperLower = nesmath.SetBit(mapperLower, 2, nesmath.BitSet(data, 6))
-	mapperLower = nesmath.SetBit(mapperLower, 3, nesmath.BitSet(data, 7))
-	result.MapperLowerBits = mapperLower
-
-	result.FourScreenVramLayout = nesmath.BitSet(3, data)
-	result.Trainer512Byte = nesmath.BitSet(2, data)
-	result.BatteryRam = nesmath.BitSet(1, data)
-
-	if nesmath.BitSet(0, data) {
-		result.MirrorType = MirrorTypeVertical
-	} else {
-		result.MirrorType = MirrorTypeHorizontal
-	}
-
-	return result
-}
-
-type INesFormatType int
-
-const (
-	INesFormatType1 INesFormatType = iota
-	INesFormatType2
-)
-
-type ControlByte2 struct {
-	MapperHigherBits byte
-	INesFormat       INesFormatType
-}
-
-func createControlByte2(data byte) (*ControlByte2, error) {
-	result := &ControlByte2{}
-
-	mapperHigher := byte(0)
-	mapperHigher = nesmath.SetBit(mapperHigher, 4, nesmath.BitSet(data, 4))
-	mapperHigher = nesmath.SetBit(mapperHigher, 5, nesmath.BitSet(data, 5))
-	mapperHigher = nesmath.SetBit(mapperHigher, 6, nesmath.BitSet(data, 6))
-	mapperHigher = nesmath.SetBit(mapperHigher, 7, nesmath.BitSet(data, 7))
-	result.MapperHigherBits = mapperHigher
-
-	if nesmath.BitSet(data, 3) && !nesmath.BitSet(data, 2) {
-		result.INesFormat = INesFormatType2
-	} else if !nesmath.BitSet(data, 3) && !nesmath.BitSet(data, 2) {
-		result.INesFormat = INesFormatType1
-	} else {
-		return nil, ErrInvalidRom
+// Nametable is which 1KB page of CIRAM nametable index, 0 to 3 from $2000,
+// is shown from
+func (t MirrorType) Nametable(index int) int {
+	switch t {
+	case MirrorTypeVertical:
+		return index & 0x01
+	case MirrorTypeHorizontal:
+		return index >> 1 & 0x01
+	case MirrorTypeSingleUpper:
+		return 1
 	}
-
-	return result, nil
-}
-
-type CartInfo struct {
-	PrgRomBanks  byte
-	ChrRomBanks  byte
-	ControlByte1 *ControlByte1
-	ControlByte2 *ControlByte2
-	PrgRamLength byte
+	return 0
 }
 
 type Cart interface {
 	WriteBytesPrg(value []byte) error
 	WriteBytesChr(value []byte) error
-	WriteByteAt(address uint16, value byte)
-	ReadByteAt(address uint16) byte
+	// WriteByteAt and ReadByteAt get everything from 0x4020 up, they return
+	// ErrInvalidAddress for anything the cart doesn't map
+	WriteByteAt(address uint16, value byte) error
+	ReadByteAt(address uint16) (byte, error)
 }
 
-type NRom struct {
-	Prg       []byte
-	Chr       []byte
-	mapper    byte
-	mirroring MirrorType
+// CartPeeker is a cart with side effects on reads or mapper registers where
+// its ROM is, PeekByteAt and PokeByteAt reach the bytes underneath. Carts
+// without it are peeked with ReadByteAt and can't be poked.
+type CartPeeker interface {
+	PeekByteAt(address uint16) (byte, error)
+	PokeByteAt(address uint16, value byte) error
 }
 
-func createCart(info CartInfo) *NRom {
-	result := &NRom{}
+// ChrCart is the cart as the PPU sees it, the pattern tables at $0000-$1FFF
+type ChrCart interface {
+	ReadChr(address uint16) byte
+	// WriteChr is ignored unless it's CHR RAM
+	WriteChr(address uint16, value byte)
+	// Mirroring is how the nametables are currently arranged
+	Mirroring() MirrorType
+}
 
-	result.mirroring = info.ControlByte1.MirrorType
-	result.mapper = info.ControlByte2.MapperHigherBits | info.ControlByte1.MapperLowerBits
+// NametableMapper is a cart that drives CIRAM A10 itself in ways a MirrorType
+// can't describe, like TxSROM
+type NametableMapper interface {
+	// Nametable is the same as MirrorType.Nametable, four screen carts
+	// return 2 and 3 for their own RAM
+	Nametable(index int) int
+}
 
-	return result
+// PpuWatcher is a cart that watches the PPU's address bus, MMC3 counts
+// scanlines by A12 rising and MMC2 switches CHR banks on tiles $FD and $FE
+type PpuWatcher interface {
+	// PpuAddress is called after every access the PPU makes, rendering
+	// fetches from the pattern tables included
+	PpuAddress(address uint16)
 }
 
-func (c *NRom) WriteBytesPrg(value []byte) error {
-	c.Prg = append(c.Prg, value...)
-	return nil
+// IrqCart is a cart that can pull the CPU's IRQ line
+type IrqCart interface {
+	Irq() bool
 }
 
-func (c *NRom) WriteBytesChr(value []byte) error {
-	c.Chr = append(c.Chr, value...)
-	return nil
+// ClockedCart is a cart that counts CPU cycles with M2
+type ClockedCart interface {
+	// Clock is called once per CPU cycle before its bus access
+	Clock()
 }
 
-func (c *NRom) WriteByteAt(address uint16, value byte) {
-	switch {
-	// PRG ram
-	case address >= 0x6000 && address <= 0x7FFF:
-		c.Prg[address-0x6000] = value
-	case address >= 0x8000 && address <= 0xBFFF:
-		c.Prg[address-0x8000] = value
-	case address >= 0xC000 && address <= 0xFFFF:
-		c.Prg[address-0xC000] = value
-	default:
-		panic("fuck")
-	}
+// SaveRam is a cart that might have battery backed RAM
+type SaveRam interface {
+	// SaveRam is the battery backed RAM itself, nil without a battery
+	SaveRam() []byte
 }
 
-func (c *NRom) ReadByteAt(address uint16) byte {
-	switch {
-	// PRG ram
-	case address >= 0x6000 && address <= 0x7FFF:
-		return c.Prg[address-0x6000]
-	case address >= 0x8000 && address <= 0xBFFF:
-		return c.Prg[address-0x8000]
-	case address >= 0xC000 && address <= 0xFFFF:
-		return c.Prg[address-0xC000]
-	default:
-		panic("fuck")
-	}
+// RomMapper is a cart that can say where an address ends up in its ROM, -1
+// when it's not ROM or not mapped. Bank switching carts answer for the banks
+// currently selected.
+type RomMapper interface {
+	PrgOffset(address uint16) int
+	ChrOffset(address uint16) int
 }
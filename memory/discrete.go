@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+type discreteBoard int
+
+const (
+	// discreteUxrom is mapper 2, 16KB at $8000 and the last bank fixed at
+	// $C000
+	discreteUxrom discreteBoard = iota
+	// discreteCnrom is mapper 3, 8KB CHR banks
+	discreteCnrom
+	// discreteAxrom is mapper 7, 32KB PRG banks and single screen mirroring
+	discreteAxrom
+	// discreteGxrom is mapper 66, 32KB PRG and 8KB CHR banks
+	discreteGxrom
+	// discreteColorDreams is mapper 11, GxROM with the nibbles swapped
+	discreteColorDreams
+	// discreteBnrom is mapper 34 submapper 2, 32KB PRG banks
+	discreteBnrom
+	// discreteNina001 is mapper 34 submapper 1, registers at $7FFD-$7FFF
+	// and 4KB CHR banks
+	discreteNina001
+)
+
+const (
+	discretePrgBankSize = 0x4000
+	discreteChrBankSize = 0x1000
+)
+
+// Discrete is the boards without a mapper chip, the bank numbers are latched
+// from writes to ROM. Where the ROM isn't disabled for the write both drive
+// the data bus, the latch gets the two ANDed together.
+// https://wiki.nesdev.com/w/index.php/Bus_conflict
+type Discrete struct {
+	Prg    []byte
+	Chr    []byte
+	PrgRam []byte
+
+	board        discreteBoard
+	busConflicts bool
+	battery      bool
+	chrRam       bool
+	mirroring    MirrorType
+
+	// prgBank is 16KB for UxROM and 32KB for the rest
+	prgBank int
+	// chrBanks are 4KB at $0000 and $1000
+	chrBanks [2]int
+}
+
+func createDiscrete(header *Header, board discreteBoard, busConflicts bool) (Cart, error) {
+	if header.PrgRomSize == 0 || header.PrgRomSize%discretePrgBankSize != 0 {
+		return nil, errors.Wrapf(ErrInvalidRom, "can't have %d bytes of PRG", header.PrgRomSize)
+	}
+
+	result := &Discrete{
+		PrgRam:       make([]byte, header.PrgRamSize+header.PrgNvramSize),
+		board:        board,
+		busConflicts: busConflicts,
+		battery:      header.PrgNvramSize > 0,
+		mirroring:    header.Mirroring,
+		chrBanks:     [2]int{0, 1},
+	}
+	if board == discreteAxrom {
+		result.mirroring = MirrorTypeSingleLower
+	}
+	if header.ChrRomSize == 0 {
+		size := header.ChrRamSize + header.ChrNvramSize
+		if size == 0 {
+			size = ChrBankSize
+		}
+		result.Chr = make([]byte, size)
+		result.chrRam = true
+	}
+
+	return result, nil
+}
+
+// submapperConflicts is the NES 2.0 bus conflict submappers of UxROM, CNROM
+// and AxROM, 1 has none and 2 ANDs. 0 doesn't say so they're left off.
+func submapperConflicts(header *Header) bool {
+	return header.Submapper == 2
+}
+
+func createUxrom(header *Header) (Cart, error) {
+	return createDiscrete(header, discreteUxrom, submapperConflicts(header))
+}
+
+func createCnrom(header *Header) (Cart, error) {
+	return createDiscrete(header, discreteCnrom, submapperConflicts(header))
+}
+
+func createAxrom(header *Header) (Cart, error) {
+	return createDiscrete(header, discreteAxrom, submapperConflicts(header))
+}
+
+func createGxrom(header *Header) (Cart, error) {
+	return createDiscrete(header, discreteGxrom, true)
+}
+
+func createColorDreams(header *Header) (Cart, error) {
+	return createDiscrete(header, discreteColorDreams, false)
+}
+
+// createMapper34 is BNROM or NINA-001, without a submapper only NINA-001 has
+// more than 8KB of CHR
+func createMapper34(header *Header) (Cart, error) {
+	nina := header.Submapper == 1 || header.Submapper == 0 && header.ChrRomSize > ChrBankSize
+	if !nina {
+		return createDiscrete(header, discreteBnrom, true)
+	}
+
+	// NINA-001 always has RAM for its registers to sit on
+	if header.PrgRamSize+header.PrgNvramSize == 0 {
+		withRam := *header
+		withRam.PrgRamSize = 0x2000
+		header = &withRam
+	}
+	return createDiscrete(header, discreteNina001, false)
+}
+
+func (c *Discrete) SaveRam() []byte {
+	if !c.battery {
+		return nil
+	}
+	return c.PrgRam
+}
+
+func (c *Discrete) WriteBytesPrg(value []byte) error {
+	c.Prg = append(c.Prg, value...)
+	return nil
+}
+
+func (c *Discrete) WriteBytesChr(value []byte) error {
+	if c.chrRam {
+		return nil
+	}
+	c.Chr = append(c.Chr, value...)
+	return nil
+}
+
+// chr8k selects an 8KB CHR bank
+func (c *Discrete) chr8k(bank int) {
+	c.chrBanks = [2]int{bank * 2, bank*2 + 1}
+}
+
+// latch is a write to $8000-$FFFF
+func (c *Discrete) latch(value byte) {
+	switch c.board {
+	case discreteUxrom, discreteBnrom:
+		c.prgBank = int(value)
+	case discreteCnrom:
+		c.chr8k(int(value))
+	case discreteAxrom:
+		c.prgBank = int(value & 0x07)
+		if value&0x10 != 0 {
+			c.mirroring = MirrorTypeSingleUpper
+		} else {
+			c.mirroring = MirrorTypeSingleLower
+		}
+	case discreteGxrom:
+		c.prgBank = int(value>>4) & 0x03
+		c.chr8k(int(value & 0x03))
+	case discreteColorDreams:
+		c.prgBank = int(value & 0x03)
+		c.chr8k(int(value >> 4))
+	}
+}
+
+func (c *Discrete) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+
+	offset := int(address - 0x8000)
+	switch c.board {
+	case discreteUxrom:
+		bank := c.prgBank
+		if address >= 0xC000 {
+			bank = len(c.Prg)/discretePrgBankSize - 1
+		}
+		offset = bank*discretePrgBankSize + int(address&0x3FFF)
+	default:
+		offset += c.prgBank * 2 * discretePrgBankSize
+	}
+
+	return offset % len(c.Prg)
+}
+
+func (c *Discrete) chrIndex(address uint16) int {
+	bank := c.chrBanks[address>>12&0x01]
+	return (bank*discreteChrBankSize + int(address&0x0FFF)) % len(c.Chr)
+}
+
+// ChrOffset is -1 for CHR RAM, it's not in the ROM
+func (c *Discrete) ChrOffset(address uint16) int {
+	if address >= 0x2000 || c.chrRam || len(c.Chr) == 0 {
+		return -1
+	}
+	return c.chrIndex(address)
+}
+
+func (c *Discrete) ReadChr(address uint16) byte {
+	return c.Chr[c.chrIndex(address)]
+}
+
+func (c *Discrete) WriteChr(address uint16, value byte) {
+	if c.chrRam {
+		c.Chr[c.chrIndex(address)] = value
+	}
+}
+
+func (c *Discrete) Mirroring() MirrorType {
+	return c.mirroring
+}
+
+func (c *Discrete) WriteByteAt(address uint16, value byte) error {
+	switch {
+	case address >= 0x8000:
+		if c.busConflicts {
+			value &= c.Prg[c.PrgOffset(address)]
+		}
+		if c.board != discreteNina001 {
+			c.latch(value)
+		}
+	case address >= 0x6000 && len(c.PrgRam) > 0:
+		c.PrgRam[int(address-0x6000)%len(c.PrgRam)] = value
+		if c.board != discreteNina001 {
+			break
+		}
+		// The registers are written along with the RAM underneath
+		switch address {
+		case 0x7FFD:
+			c.prgBank = int(value & 0x01)
+		case 0x7FFE:
+			c.chrBanks[0] = int(value & 0x0F)
+		case 0x7FFF:
+			c.chrBanks[1] = int(value & 0x0F)
+		}
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (c *Discrete) ReadByteAt(address uint16) (byte, error) {
+	switch {
+	case address >= 0x8000:
+		return c.Prg[c.PrgOffset(address)], nil
+	case address >= 0x6000 && len(c.PrgRam) > 0:
+		return c.PrgRam[int(address-0x6000)%len(c.PrgRam)], nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+}
+
+func (c *Discrete) PeekByteAt(address uint16) (byte, error) {
+	return c.ReadByteAt(address)
+}
+
+// PokeByteAt patches the ROM instead of writing the latch
+func (c *Discrete) PokeByteAt(address uint16, value byte) error {
+	if address >= 0x8000 {
+		c.Prg[c.PrgOffset(address)] = value
+		return nil
+	}
+	return c.WriteByteAt(address, value)
+}
@@ -0,0 +1,141 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func createDiscrete(t *testing.T, prgBank, chrBank int, headerBytes ...byte) *memory.Memory {
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom(headerBytes, prgBank, chrBank))))
+	assert.IsType(t, &memory.Discrete{}, m.Cart())
+	return m
+}
+
+func TestUxrom(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x4000, 0x2000, 0x08, 0x00, 0x21)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+
+	m.WriteByteAt(0x8000, 0x05)
+	assert.Equal(t, byte(5), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+	assert.Equal(t, 5*0x4000+1, m.Cart().(memory.RomMapper).PrgOffset(0x8001))
+
+	cart := m.Cart().(memory.ChrCart)
+	cart.WriteChr(0x1FFF, 0x99)
+	assert.Equal(t, byte(0x99), cart.ReadChr(0x1FFF))
+	assert.Equal(t, memory.MirrorTypeVertical, cart.Mirroring())
+	assert.NoError(t, m.Err())
+}
+
+func TestBusConflicts(t *testing.T) {
+	t.Parallel()
+
+	// Submapper 2 ANDs with the ROM, bank 3 has a 3 at its start
+	m := createDiscrete(t, 0x4000, 0x2000, 0x08, 0x00, 0x20, 0x08, 0x20)
+	m.WriteByteAt(0xC000, 0x05)
+	assert.Equal(t, byte(5&7), m.ReadByteAt(0x8000))
+	m.WriteByteAt(0x8000, 0x06)
+	assert.Equal(t, byte(6&5), m.ReadByteAt(0x8000))
+
+	// Submapper 1 doesn't
+	m = createDiscrete(t, 0x4000, 0x2000, 0x08, 0x00, 0x20, 0x08, 0x10)
+	m.WriteByteAt(0xC000, 0x05)
+	m.WriteByteAt(0x8000, 0x06)
+	assert.Equal(t, byte(6), m.ReadByteAt(0x8000))
+}
+
+func TestCnrom(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x4000, 0x2000, 0x02, 0x04, 0x30)
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0x8000, 0x02)
+	assert.Equal(t, byte(2), cart.ReadChr(0x0000))
+	assert.Equal(t, 2*0x2000+0x1010, m.Cart().(memory.RomMapper).ChrOffset(0x1010))
+	cart.WriteChr(0x0000, 0xFF)
+	assert.Equal(t, byte(2), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(1), m.ReadByteAt(0xC000))
+}
+
+func TestAxrom(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x8000, 0x2000, 0x08, 0x00, 0x71)
+	cart := m.Cart().(memory.ChrCart)
+	assert.Equal(t, memory.MirrorTypeSingleLower, cart.Mirroring())
+
+	m.WriteByteAt(0x8000, 0x12)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, memory.MirrorTypeSingleUpper, cart.Mirroring())
+	assert.Equal(t, 1, cart.Mirroring().Nametable(0))
+
+	m.WriteByteAt(0xFFFF, 0x03)
+	assert.Equal(t, byte(3), m.ReadByteAt(0x8000))
+	assert.Equal(t, memory.MirrorTypeSingleLower, cart.Mirroring())
+}
+
+func TestGxrom(t *testing.T) {
+	t.Parallel()
+
+	// GxROM always has bus conflicts
+	m := createDiscrete(t, 0x8000, 0x2000, 0x08, 0x04, 0x20, 0x40)
+	cart := m.Cart().(memory.ChrCart)
+	assert.NoError(t, m.PokeByteAt(0x8001, 0xFF))
+
+	m.WriteByteAt(0x8001, 0x21)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(1), cart.ReadChr(0x0000))
+	assert.Equal(t, 0x10002, m.Cart().(memory.RomMapper).PrgOffset(0x8002))
+
+	// The ROM has $02 there
+	m.WriteByteAt(0x8000, 0x13)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(2), cart.ReadChr(0x0000))
+}
+
+func TestColorDreams(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x8000, 0x2000, 0x08, 0x04, 0xB0)
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0x8000, 0x32)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(3), cart.ReadChr(0x0000))
+}
+
+func TestBnrom(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x8000, 0x2000, 0x08, 0x00, 0x20, 0x20)
+	m.WriteByteAt(0x8000, 0x02)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.NoError(t, m.PokeByteAt(0x8000, 0xFF))
+	m.WriteByteAt(0x8000, 0x02)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+}
+
+func TestNina001(t *testing.T) {
+	t.Parallel()
+
+	m := createDiscrete(t, 0x8000, 0x1000, 0x04, 0x08, 0x20, 0x20)
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0x7FFD, 0x01)
+	m.WriteByteAt(0x7FFE, 0x05)
+	m.WriteByteAt(0x7FFF, 0x0E)
+	assert.Equal(t, byte(1), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(5), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(14), cart.ReadChr(0x1000))
+	assert.Equal(t, byte(0x0E), m.ReadByteAt(0x7FFF))
+
+	// Writes to ROM do nothing
+	m.WriteByteAt(0x8000, 0x00)
+	assert.Equal(t, byte(1), m.ReadByteAt(0x8000))
+	assert.NoError(t, m.Err())
+}
@@ -0,0 +1,102 @@
+package memory
+
+// Dma is the 2A03's DMA unit, it halts the CPU to copy a page into OAM when
+// $4014 is written and to fetch DMC samples
+// https://wiki.nesdev.com/w/index.php/DMA
+type Dma struct {
+	oamPending bool
+	oamPage    byte
+	dmcPending bool
+	dmcAddress uint16
+	dmcDone    func(value byte)
+}
+
+// StartOam copies page $XX00-$XXFF to OAM once the current instruction is done
+func (d *Dma) StartOam(page byte) {
+	d.oamPending = true
+	d.oamPage = page
+}
+
+// RequestDmc fetches a DMC sample byte, done gets it once it's been read
+func (d *Dma) RequestDmc(address uint16, done func(value byte)) {
+	d.dmcPending = true
+	d.dmcAddress = address
+	d.dmcDone = done
+}
+
+func (d *Dma) Pending() bool {
+	return d.oamPending || d.dmcPending
+}
+
+func (m *Memory) dmcFetch() {
+	value := m.ReadByteAt(m.Dma.dmcAddress)
+	m.Dma.dmcPending = false
+	if m.Dma.dmcDone != nil {
+		m.Dma.dmcDone(value)
+	}
+}
+
+// RunDma does whatever DMA is pending while the CPU is halted. cycles is the
+// CPU's TotalCycles and cycle clocks it once, reads only happen on odd cycles
+// and writes on even ones. It returns how many cycles the CPU was halted for,
+// 513 or 514 for OAM plus 2 when a DMC fetch lands in the middle of it.
+func (m *Memory) RunDma(cycles int64, cycle func()) int {
+	d := m.Dma
+	if !d.Pending() {
+		return 0
+	}
+
+	start := cycles
+	clock := func() {
+		cycle()
+		cycles++
+	}
+	// get is true when the next cycle can read
+	get := func() bool {
+		return cycles%2 == 1
+	}
+
+	// The CPU halts on what would have been its next read
+	clock()
+
+	if d.oamPending {
+		d.oamPending = false
+		address := uint16(d.oamPage) << 8
+
+		var value byte
+		holding := false
+		for i := 0; i < 0x100; {
+			read := get()
+			clock()
+
+			switch {
+			// DMC takes priority for the read, the OAM byte waits another two
+			// cycles
+			case read && d.dmcPending:
+				m.dmcFetch()
+			case read:
+				value = m.ReadByteAt(address + uint16(i))
+				holding = true
+			// An alignment cycle when there's nothing to write yet
+			case holding:
+				m.openBus = value
+				m.fault(SubsystemPpu, 0x2004, true, m.PpuRegisters.WriteByteAt(0x2004, value))
+				holding = false
+				i++
+			}
+		}
+	} else if d.dmcPending {
+		// Dummy cycle
+		clock()
+	}
+
+	if d.dmcPending {
+		for !get() {
+			clock()
+		}
+		clock()
+		m.dmcFetch()
+	}
+
+	return int(cycles - start)
+}
@@ -0,0 +1,93 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOamDma(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		cycles   int64
+		expected int
+	}{
+		{0, 513},
+		{1, 514},
+	} {
+		m := createMemory()
+		for i := 0; i < 0x100; i++ {
+			m.WriteByteAt(0x0300+uint16(i), byte(i))
+		}
+		// Starts from OAMADDR and wraps
+		m.WriteByteAt(0x2003, 0x10)
+		m.WriteByteAt(0x4014, 0x03)
+		assert.True(t, m.Dma.Pending())
+
+		clocked := 0
+		assert.Equal(t, test.expected, m.RunDma(test.cycles, func() { clocked++ }))
+		assert.Equal(t, test.expected, clocked)
+		assert.False(t, m.Dma.Pending())
+		assert.NoError(t, m.Err())
+
+		assert.Equal(t, byte(0x00), m.PpuRegisters.Oam[0x10])
+		assert.Equal(t, byte(0xEF), m.PpuRegisters.Oam[0xFF])
+		assert.Equal(t, byte(0xFF), m.PpuRegisters.Oam[0x0F])
+		assert.Equal(t, byte(0x10), m.PpuRegisters.OamAddress.Read())
+		assert.Equal(t, byte(0x00), m.ReadByteAt(0x2004))
+	}
+
+	assert.Equal(t, 0, createMemory().RunDma(0, func() {}))
+}
+
+func TestDmcDma(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		oam      bool
+		cycles   int64
+		expected int
+	}{
+		{false, 0, 4},
+		{false, 1, 3},
+		{true, 0, 515},
+		{true, 1, 516},
+	} {
+		m := createMemory()
+		m.WriteByteAt(0x0123, 0x5A)
+		m.WriteByteAt(0x0200, 0x77)
+		if test.oam {
+			m.WriteByteAt(0x4014, 0x02)
+		}
+
+		var sample []byte
+		m.Dma.RequestDmc(0x0123, func(value byte) {
+			sample = append(sample, value)
+		})
+
+		assert.Equal(t, test.expected, m.RunDma(test.cycles, func() {}), "oam %v cycles %d", test.oam, test.cycles)
+		assert.Equal(t, []byte{0x5A}, sample)
+		if test.oam {
+			assert.Equal(t, byte(0x77), m.PpuRegisters.Oam[0x00])
+		}
+	}
+}
+
+func TestOamData(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	m.WriteByteAt(0x2003, 0xFF)
+	m.WriteByteAt(0x2004, 0x12)
+	m.WriteByteAt(0x2004, 0x34)
+
+	assert.Equal(t, byte(0x12), m.PpuRegisters.Oam[0xFF])
+	assert.Equal(t, byte(0x34), m.PpuRegisters.Oam[0x00])
+	assert.Equal(t, byte(0x01), m.PpuRegisters.OamAddress.Read())
+
+	// Reads don't move OAMADDR
+	m.WriteByteAt(0x2003, 0x00)
+	assert.Equal(t, byte(0x34), m.ReadByteAt(0x2004))
+	assert.Equal(t, byte(0x34), m.ReadByteAt(0x2004))
+}
@@ -0,0 +1,47 @@
+package memory
+
+import "fmt"
+
+// Subsystem is the part of the console an error came from
+type Subsystem string
+
+const (
+	SubsystemCpu  Subsystem = "cpu"
+	SubsystemPpu  Subsystem = "ppu"
+	SubsystemApu  Subsystem = "apu"
+	SubsystemIo   Subsystem = "io"
+	SubsystemCart Subsystem = "cart"
+)
+
+// BusError is an access that nothing on the bus answered
+type BusError struct {
+	Subsystem Subsystem
+	Address   uint16
+	Write     bool
+	Err       error
+}
+
+func (e *BusError) Error() string {
+	access := "read"
+	if e.Write {
+		access = "write"
+	}
+	return fmt.Sprintf("%s %s $%04X: %v", e.Subsystem, access, e.Address, e.Err)
+}
+
+func (e *BusError) Unwrap() error {
+	return e.Err
+}
+
+// Policy is what happens on accesses nothing is mapped to, either way reads
+// get the open bus value
+type Policy int
+
+const (
+	// PolicyLenient ignores them like the hardware does, some games poke at
+	// registers that aren't there
+	PolicyLenient Policy = iota
+	// PolicyStrict records the first unmapped access as an error, it's
+	// meant for tests and debugging
+	PolicyStrict
+)
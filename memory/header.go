@@ -0,0 +1,193 @@
+package memory
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HeaderSize  = 16
+	TrainerSize = 512
+	PrgBankSize = 0x4000
+	ChrBankSize = 0x2000
+	// MaxRomSize is far bigger than any real cart, the NES 2.0 exponent form
+	// can claim exabytes
+	MaxRomSize = 64 * 1024 * 1024
+)
+
+var headerMagic = []byte{0x4E, 0x45, 0x53, 0x1A}
+
+type INesFormatType int
+
+const (
+	INesFormatType1 INesFormatType = iota
+	INesFormatType2
+	// INesFormatArchaic is an old header with junk like "DiskDude!" after
+	// byte 7, only the low mapper nibble can be trusted
+	INesFormatArchaic
+)
+
+// Timing is the CPU and PPU the game was made for
+type Timing int
+
+const (
+	TimingNtsc Timing = iota
+	TimingPal
+	TimingMultiRegion
+	TimingDendy
+)
+
+type ConsoleType int
+
+const (
+	ConsoleTypeNes ConsoleType = iota
+	ConsoleTypeVsSystem
+	ConsoleTypePlayChoice10
+	// ConsoleTypeExtended has the actual type in ExtendedConsoleType
+	ConsoleTypeExtended
+)
+
+// Header is an iNES or NES 2.0 header, sizes are in bytes and everything
+// iNES can't say is left at zero
+// https://wiki.nesdev.com/w/index.php/NES_2.0
+type Header struct {
+	Format INesFormatType
+	// Mapper is 12 bits in NES 2.0 and 8 in iNES
+	Mapper    uint16
+	Submapper byte
+
+	PrgRomSize int
+	ChrRomSize int
+	// PrgRamSize and ChrRamSize are volatile, the Nvram sizes are battery
+	// backed
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+	ChrNvramSize int
+
+	Mirroring MirrorType
+	// FourScreen is the cart providing its own nametables
+	FourScreen bool
+	Battery    bool
+	Trainer    bool
+
+	Timing      Timing
+	ConsoleType ConsoleType
+	// VsPpuType and VsHardwareType are only set for ConsoleTypeVsSystem
+	VsPpuType           byte
+	VsHardwareType      byte
+	ExtendedConsoleType byte
+	MiscRoms            byte
+	// ExpansionDevice is what should be plugged in by default
+	// https://wiki.nesdev.com/w/index.php/NES_2.0#Default_Expansion_Device
+	ExpansionDevice byte
+}
+
+// romSize decodes a NES 2.0 ROM size, when the MSB nibble is $F the LSB is
+// an exponent and multiplier
+func romSize(lsb, msb byte, unit int) int {
+	if msb == 0x0F {
+		exponent := uint(lsb >> 2)
+		multiplier := int(lsb&0x03)*2 + 1
+		return (1 << exponent) * multiplier
+	}
+
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+// shiftSize decodes the NES 2.0 RAM sizes, 64 << shift and zero for none
+func shiftSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+// ParseHeader reads the 16 byte header at the start of a .nes file
+// https://wiki.nesdev.com/w/index.php/INES
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < HeaderSize || !bytes.Equal(data[:4], headerMagic) {
+		return nil, ErrInvalidRom
+	}
+
+	flags6 := data[6]
+	flags7 := data[7]
+	result := &Header{
+		Mapper:      uint16(flags6 >> 4),
+		Battery:     flags6&0x02 != 0,
+		Trainer:     flags6&0x04 != 0,
+		FourScreen:  flags6&0x08 != 0,
+		ConsoleType: ConsoleType(flags7 & 0x03),
+	}
+	if flags6&0x01 != 0 {
+		result.Mirroring = MirrorTypeVertical
+	} else {
+		result.Mirroring = MirrorTypeHorizontal
+	}
+
+	switch {
+	case flags7&0x0C == 0x08:
+		result.Format = INesFormatType2
+	case flags7&0x0C == 0x00 && bytes.Equal(data[12:16], []byte{0, 0, 0, 0}):
+		result.Format = INesFormatType1
+	default:
+		result.Format = INesFormatArchaic
+	}
+
+	switch result.Format {
+	case INesFormatType2:
+		result.Mapper |= uint16(flags7&0xF0) | uint16(data[8]&0x0F)<<8
+		result.Submapper = data[8] >> 4
+		result.PrgRomSize = romSize(data[4], data[9]&0x0F, PrgBankSize)
+		result.ChrRomSize = romSize(data[5], data[9]>>4, ChrBankSize)
+		for _, size := range []int{result.PrgRomSize, result.ChrRomSize} {
+			if size < 0 || size > MaxRomSize {
+				return nil, errors.Wrapf(ErrInvalidRom, "ROM size %d is too big", size)
+			}
+		}
+		result.PrgRamSize = shiftSize(data[10] & 0x0F)
+		result.PrgNvramSize = shiftSize(data[10] >> 4)
+		result.ChrRamSize = shiftSize(data[11] & 0x0F)
+		result.ChrNvramSize = shiftSize(data[11] >> 4)
+		result.Timing = Timing(data[12] & 0x03)
+		switch result.ConsoleType {
+		case ConsoleTypeVsSystem:
+			result.VsPpuType = data[13] & 0x0F
+			result.VsHardwareType = data[13] >> 4
+		case ConsoleTypeExtended:
+			result.ExtendedConsoleType = data[13] & 0x0F
+		}
+		result.MiscRoms = data[14] & 0x03
+		result.ExpansionDevice = data[15] & 0x3F
+
+		return result, nil
+
+	case INesFormatType1:
+		result.Mapper |= uint16(flags7 & 0xF0)
+		if data[9]&0x01 != 0 {
+			result.Timing = TimingPal
+		}
+	case INesFormatArchaic:
+		result.ConsoleType = ConsoleTypeNes
+	}
+
+	result.PrgRomSize = int(data[4]) * PrgBankSize
+	result.ChrRomSize = int(data[5]) * ChrBankSize
+	if result.ChrRomSize == 0 {
+		result.ChrRamSize = ChrBankSize
+	}
+
+	// Zero is 8KB for compatibility
+	prgRam := int(data[8]) * 0x2000
+	if result.Format == INesFormatArchaic || prgRam == 0 {
+		prgRam = 0x2000
+	}
+	if result.Battery {
+		result.PrgNvramSize = prgRam
+	} else {
+		result.PrgRamSize = prgRam
+	}
+
+	return result, nil
+}
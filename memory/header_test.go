@@ -0,0 +1,146 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func header(bytes ...byte) []byte {
+	return append([]byte{0x4E, 0x45, 0x53, 0x1A}, append(bytes, make([]byte, 12-len(bytes))...)...)
+}
+
+func TestParseINesHeader(t *testing.T) {
+	t.Parallel()
+
+	h, err := memory.ParseHeader(header(0x02, 0x01, 0x13, 0x40, 0x00, 0x01))
+	assert.NoError(t, err)
+	assert.Equal(t, &memory.Header{
+		Format:       memory.INesFormatType1,
+		Mapper:       0x41,
+		PrgRomSize:   0x8000,
+		ChrRomSize:   0x2000,
+		PrgNvramSize: 0x2000,
+		Mirroring:    memory.MirrorTypeVertical,
+		Battery:      true,
+		Timing:       memory.TimingPal,
+	}, h)
+
+	// No CHR ROM is 8KB of CHR RAM
+	h, err = memory.ParseHeader(header(0x01, 0x00, 0x00, 0x00, 0x02))
+	assert.NoError(t, err)
+	assert.Equal(t, 0x2000, h.ChrRamSize)
+	assert.Equal(t, 0x4000, h.PrgRamSize)
+	assert.Equal(t, memory.MirrorTypeHorizontal, h.Mirroring)
+
+	_, err = memory.ParseHeader([]byte("NES\x1B"))
+	assert.Equal(t, memory.ErrInvalidRom, err)
+}
+
+func TestParseNes2Header(t *testing.T) {
+	t.Parallel()
+
+	h, err := memory.ParseHeader(header(
+		0x02, // PRG LSB
+		0x07, // CHR exponent 1 multiplier 7
+		0x5E, // Mapper 5, four screen, trainer, battery
+		0x19, // Mapper 1, NES 2.0, Vs System
+		0x3A, // Submapper 3, mapper $A00
+		0xF1, // PRG MSB $1, CHR exponent form
+		0x97, // PRG NVRAM 32KB, PRG RAM 8KB
+		0x07, // CHR RAM 8KB
+		0x03, // Dendy
+		0x25, // Vs hardware 2, PPU 5
+		0x01, // Misc ROMs
+		0x2A, // Expansion device
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, &memory.Header{
+		Format:          memory.INesFormatType2,
+		Mapper:          0xA15,
+		Submapper:       3,
+		PrgRomSize:      0x102 * 0x4000,
+		ChrRomSize:      2 * 7,
+		PrgRamSize:      0x2000,
+		PrgNvramSize:    0x8000,
+		ChrRamSize:      0x2000,
+		Mirroring:       memory.MirrorTypeHorizontal,
+		FourScreen:      true,
+		Battery:         true,
+		Trainer:         true,
+		Timing:          memory.TimingDendy,
+		ConsoleType:     memory.ConsoleTypeVsSystem,
+		VsPpuType:       5,
+		VsHardwareType:  2,
+		MiscRoms:        1,
+		ExpansionDevice: 0x2A,
+	}, h)
+
+	h, err = memory.ParseHeader(header(0x01, 0x00, 0x00, 0x0B, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0C))
+	assert.NoError(t, err)
+	assert.Equal(t, memory.ConsoleTypeExtended, h.ConsoleType)
+	assert.Equal(t, byte(0x0C), h.ExtendedConsoleType)
+	assert.Equal(t, 0, h.ChrRamSize)
+}
+
+func TestParseHugeNes2Header(t *testing.T) {
+	t.Parallel()
+
+	// 2^63 bytes of PRG and 1GB of CHR
+	for _, data := range [][]byte{
+		header(0xFC, 0x00, 0x00, 0x08, 0x00, 0x0F),
+		header(0x01, 0x78, 0x00, 0x08, 0x00, 0xF0),
+	} {
+		_, err := memory.ParseHeader(data)
+		assert.True(t, errors.Is(err, memory.ErrInvalidRom))
+
+		err = createMemory().LoadRom(bytes.NewReader(data))
+		assert.True(t, errors.Is(err, memory.ErrInvalidRom))
+	}
+}
+
+func TestParseArchaicHeader(t *testing.T) {
+	t.Parallel()
+
+	data := append([]byte{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x11}, []byte("DiskDude!")...)
+	h, err := memory.ParseHeader(data)
+	assert.NoError(t, err)
+	assert.Equal(t, memory.INesFormatArchaic, h.Format)
+	assert.Equal(t, uint16(1), h.Mapper)
+	assert.Equal(t, memory.ConsoleTypeNes, h.ConsoleType)
+	assert.Equal(t, 0x8000, h.PrgRomSize)
+	assert.Equal(t, 0x2000, h.PrgRamSize)
+
+	// Junk in the padding without the byte 7 marker
+	h, err = memory.ParseHeader(header(0x01, 0x01, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x41))
+	assert.NoError(t, err)
+	assert.Equal(t, memory.INesFormatArchaic, h.Format)
+	assert.Equal(t, uint16(0), h.Mapper)
+}
+
+func TestLoadRom(t *testing.T) {
+	t.Parallel()
+
+	rom := header(0x01, 0x01, 0x04)
+	rom = append(rom, make([]byte, memory.TrainerSize)...)
+	prg := make([]byte, memory.PrgBankSize)
+	prg[0] = 0xA9
+	rom = append(rom, prg...)
+	chr := make([]byte, memory.ChrBankSize)
+	chr[0] = 0x3C
+	rom = append(rom, chr...)
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+	assert.Equal(t, byte(0xA9), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(0xA9), m.ReadByteAt(0xC000))
+	assert.Equal(t, chr, m.Cart().(*memory.NRom).Chr)
+	assert.True(t, m.Header().Trainer)
+
+	err := m.LoadRom(bytes.NewReader(rom[:len(rom)-1]))
+	assert.True(t, errors.Is(err, memory.ErrInvalidRom))
+	assert.Equal(t, "CHR is 8191 bytes expected 8192: invalid rom header", err.Error())
+}
@@ -0,0 +1,117 @@
+package memory
+
+// ReadHook sees every CPU read in its range and returns the value the CPU
+// gets, cheats return something else
+type ReadHook func(address uint16, value byte) byte
+
+// WriteHook sees every CPU write in its range before it happens. It returns
+// the value to write and false to drop the write.
+type WriteHook func(address uint16, value byte) (byte, bool)
+
+// ChrHook sees every pattern table fetch the PPU makes while rendering
+type ChrHook func(address uint16, value byte)
+
+// Hook identifies a registered hook so it can be removed
+type Hook int
+
+// registeredHook is any of the kinds of hook, they share the add and remove
+// code. start and end are only used by reads and writes.
+type registeredHook struct {
+	id    Hook
+	start uint16
+	end   uint16
+	read  ReadHook
+	write WriteHook
+	chr   ChrHook
+}
+
+// hooks are copied on change so a hook can add or remove hooks while they're
+// being run
+type hooks struct {
+	next   Hook
+	reads  []registeredHook
+	writes []registeredHook
+	chrs   []registeredHook
+}
+
+func (h *hooks) add(list []registeredHook, hook registeredHook) ([]registeredHook, Hook) {
+	h.next++
+	hook.id = h.next
+	result := make([]registeredHook, len(list), len(list)+1)
+	copy(result, list)
+	return append(result, hook), h.next
+}
+
+func removeHook(list []registeredHook, id Hook) []registeredHook {
+	for i, hook := range list {
+		if hook.id != id {
+			continue
+		}
+		if len(list) == 1 {
+			return nil
+		}
+
+		result := make([]registeredHook, 0, len(list)-1)
+		result = append(result, list[:i]...)
+		return append(result, list[i+1:]...)
+	}
+
+	return list
+}
+
+// AddReadHook calls hook for reads from start to end inclusive
+func (m *Memory) AddReadHook(start, end uint16, hook ReadHook) Hook {
+	var id Hook
+	m.hooks.reads, id = m.hooks.add(m.hooks.reads, registeredHook{start: start, end: end, read: hook})
+	return id
+}
+
+// AddWriteHook calls hook for writes to start to end inclusive
+func (m *Memory) AddWriteHook(start, end uint16, hook WriteHook) Hook {
+	var id Hook
+	m.hooks.writes, id = m.hooks.add(m.hooks.writes, registeredHook{start: start, end: end, write: hook})
+	return id
+}
+
+// AddChrHook calls hook for every rendering fetch from the pattern tables
+func (m *Memory) AddChrHook(hook ChrHook) Hook {
+	var id Hook
+	m.hooks.chrs, id = m.hooks.add(m.hooks.chrs, registeredHook{chr: hook})
+	return id
+}
+
+// RemoveHook does nothing if the hook was already removed
+func (m *Memory) RemoveHook(id Hook) {
+	m.hooks.reads = removeHook(m.hooks.reads, id)
+	m.hooks.writes = removeHook(m.hooks.writes, id)
+	m.hooks.chrs = removeHook(m.hooks.chrs, id)
+}
+
+func (h *hooks) read(address uint16, value byte) byte {
+	for _, hook := range h.reads {
+		if address >= hook.start && address <= hook.end {
+			value = hook.read(address, value)
+		}
+	}
+	return value
+}
+
+func (h *hooks) chr(address uint16, value byte) {
+	for _, hook := range h.chrs {
+		hook.chr(address, value)
+	}
+}
+
+func (h *hooks) write(address uint16, value byte) (byte, bool) {
+	for _, hook := range h.writes {
+		if address < hook.start || address > hook.end {
+			continue
+		}
+
+		var ok bool
+		if value, ok = hook.write(address, value); !ok {
+			return value, false
+		}
+	}
+	return value, true
+}
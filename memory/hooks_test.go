@@ -0,0 +1,59 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadHooks(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	m.WriteByteAt(0x0010, 0x05)
+	m.WriteByteAt(0x0020, 0x05)
+
+	var reads []uint16
+	id := m.AddReadHook(0x0010, 0x001F, func(address uint16, value byte) byte {
+		reads = append(reads, address)
+		return value + 1
+	})
+	// Hooks run in the order they were added
+	double := m.AddReadHook(0x0000, 0x07FF, func(address uint16, value byte) byte {
+		return value * 2
+	})
+
+	assert.Equal(t, byte(0x0C), m.ReadByteAt(0x0010))
+	assert.Equal(t, byte(0x0A), m.ReadByteAt(0x0020))
+	// Mirrors are their own addresses
+	assert.Equal(t, byte(0x05), m.ReadByteAt(0x0810))
+	assert.Equal(t, []uint16{0x0010}, reads)
+
+	m.RemoveHook(id)
+	assert.Equal(t, byte(0x0A), m.ReadByteAt(0x0010))
+	m.RemoveHook(double)
+	assert.Equal(t, byte(0x05), m.ReadByteAt(0x0010))
+}
+
+func TestWriteHooks(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+
+	id := m.AddWriteHook(0x0010, 0x0010, func(address uint16, value byte) (byte, bool) {
+		return value, value != 0x00
+	})
+	m.AddWriteHook(0x0000, 0x00FF, func(address uint16, value byte) (byte, bool) {
+		return value | 0x80, true
+	})
+
+	m.WriteByteAt(0x0010, 0x01)
+	assert.Equal(t, byte(0x81), m.ReadByteAt(0x0010))
+
+	m.WriteByteAt(0x0010, 0x00)
+	assert.Equal(t, byte(0x81), m.ReadByteAt(0x0010))
+
+	m.RemoveHook(id)
+	m.WriteByteAt(0x0010, 0x00)
+	assert.Equal(t, byte(0x80), m.ReadByteAt(0x0010))
+}
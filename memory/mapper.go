@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+// MapperFactory makes an empty cart for the header, LoadRom then writes the
+// ROMs into it
+type MapperFactory func(header *Header) (Cart, error)
+
+type mapperKey struct {
+	mapper    uint16
+	submapper byte
+}
+
+// mappers are keyed by mapper and submapper, submapper 0 is the fallback for
+// submappers without their own entry
+var mappers = map[mapperKey]MapperFactory{
+	{0, 0}:   createNRom,
+	{1, 0}:   createMmc1,
+	{2, 0}:   createUxrom,
+	{3, 0}:   createCnrom,
+	{4, 0}:   createMmc3Standard,
+	{4, 1}:   createMmc6,
+	{7, 0}:   createAxrom,
+	{9, 0}:   createPxrom,
+	{10, 0}:  createFxrom,
+	{11, 0}:  createColorDreams,
+	{34, 0}:  createMapper34,
+	{66, 0}:  createGxrom,
+	{118, 0}: createTxsrom,
+	{119, 0}: createTqrom,
+}
+
+// RegisterMapper adds or replaces the cart made for a mapper and submapper
+func RegisterMapper(mapper uint16, submapper byte, factory MapperFactory) {
+	mappers[mapperKey{mapper, submapper}] = factory
+}
+
+// SupportedMapper is there being a cart for the mapper and submapper
+func SupportedMapper(mapper uint16, submapper byte) bool {
+	_, ok := lookupMapper(mapper, submapper)
+	return ok
+}
+
+func lookupMapper(mapper uint16, submapper byte) (MapperFactory, bool) {
+	if factory, ok := mappers[mapperKey{mapper, submapper}]; ok {
+		return factory, true
+	}
+	factory, ok := mappers[mapperKey{mapper, 0}]
+	return factory, ok
+}
+
+func createCart(header *Header) (Cart, error) {
+	factory, ok := lookupMapper(header.Mapper, header.Submapper)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedMapper, "mapper %d submapper %d", header.Mapper, header.Submapper)
+	}
+
+	return factory(header)
+}
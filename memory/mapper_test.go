@@ -0,0 +1,40 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsupportedMapper(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	// Mapper $FF0 submapper 2
+	err := m.LoadRom(bytes.NewReader(nromFile(0x01, 0x01, 0x00, 0xF8, 0x2F)))
+	assert.True(t, errors.Is(err, memory.ErrUnsupportedMapper))
+	assert.Equal(t, "mapper 4080 submapper 2: unsupported mapper", err.Error())
+	assert.Nil(t, m.Cart())
+	assert.False(t, memory.SupportedMapper(0xFF0, 2))
+}
+
+// Not parallel, it changes the registry
+func TestRegisterMapper(t *testing.T) {
+	memory.RegisterMapper(0xFFF, 1, func(header *memory.Header) (memory.Cart, error) {
+		return &memory.NRom{Chr: make([]byte, memory.ChrBankSize)}, nil
+	})
+
+	assert.True(t, memory.SupportedMapper(0xFFF, 1))
+	assert.False(t, memory.SupportedMapper(0xFFF, 0))
+	assert.True(t, memory.SupportedMapper(0, 0))
+	// Unknown submappers fall back to 0
+	assert.True(t, memory.SupportedMapper(0, 5))
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(nromFile(0x01, 0x00, 0xF0, 0xF8, 0x1F))))
+	assert.Equal(t, uint16(0xFFF), m.Header().Mapper)
+	assert.IsType(t, &memory.NRom{}, m.Cart())
+}
@@ -1,12 +1,12 @@
 package memory
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"io"
 
+	"github.com/pkg/errors"
 	"github.com/sardap/gos/apu"
+	"github.com/sardap/gos/input"
 )
 
 const (
@@ -14,29 +14,196 @@ const (
 )
 
 var (
-	ErrInvalidRom     = fmt.Errorf("invalid rom header")
-	ErrInvalidAddress = fmt.Errorf("invalid address")
+	ErrInvalidRom        = fmt.Errorf("invalid rom header")
+	ErrInvalidAddress    = fmt.Errorf("invalid address")
+	ErrNoCart            = fmt.Errorf("no cart inserted")
+	ErrUnsupportedMapper = fmt.Errorf("unsupported mapper")
+	ErrCantPoke          = fmt.Errorf("cart can't be poked")
 )
 
 type Memory struct {
 	iRam         [0x0800]byte
 	cart         Cart
+	chr          ChrCart
+	clocked      ClockedCart
+	watcher      PpuWatcher
+	nametable    NametableMapper
+	irq          IrqCart
+	header       *Header
 	PpuRegisters *PpuRegisters
 	Apu          *apu.Apu
+	Dma          *Dma
+	Input        *input.Ports
+	// Policy decides if unmapped accesses are errors, they aren't by default
+	Policy Policy
+
+	// openBus is the last value on the CPU data bus, reads nothing answers
+	// get it https://wiki.nesdev.com/w/index.php/Open_bus_behavior
+	openBus byte
+	err     error
+	hooks   hooks
 }
 
 func Create() *Memory {
 	return &Memory{
 		PpuRegisters: CreatePpuRegisters(),
 		Apu:          apu.Create(),
+		Dma:          &Dma{},
+		Input:        &input.Ports{},
 	}
 }
 
+// PowerOn clears internal ram and the memory mapped registers
+// https://wiki.nesdev.com/w/index.php/CPU_power_up_state
+func (m *Memory) PowerOn() {
+	m.iRam = [0x0800]byte{}
+	m.openBus = 0
+	m.err = nil
+	m.PpuRegisters.PowerOn()
+	m.Apu.PowerOn()
+	*m.Dma = Dma{}
+}
+
+// Reset leaves ram alone but silences the APU and clears the PPU registers
+// the reset line is wired to
+func (m *Memory) Reset() {
+	m.PpuRegisters.Reset()
+	m.Apu.Reset()
+	*m.Dma = Dma{}
+}
+
 func (m *Memory) SetCart(cart Cart) {
 	m.cart = cart
+	m.chr, _ = cart.(ChrCart)
+	m.clocked, _ = cart.(ClockedCart)
+	m.watcher, _ = cart.(PpuWatcher)
+	m.nametable, _ = cart.(NametableMapper)
+	m.irq, _ = cart.(IrqCart)
+	m.header = nil
+}
+
+// Tick is a CPU cycle, carts that count them get clocked
+func (m *Memory) Tick() {
+	if m.clocked != nil {
+		m.clocked.Clock()
+	}
+}
+
+// PpuAddress is an address the PPU put on its bus, for carts watching it
+func (m *Memory) PpuAddress(address uint16) {
+	if m.watcher != nil {
+		m.watcher.PpuAddress(address)
+	}
+}
+
+// ReadChr is the PPU reading the cart's pattern tables through $2007, 0
+// without a cart
+func (m *Memory) ReadChr(address uint16) byte {
+	if m.chr == nil {
+		return 0
+	}
+	return m.chr.ReadChr(address)
+}
+
+// WriteChr is the PPU writing the cart's pattern tables through $2007, only
+// CHR RAM keeps it
+func (m *Memory) WriteChr(address uint16, value byte) {
+	if m.chr != nil {
+		m.chr.WriteChr(address, value)
+	}
+}
+
+// Nametable is which 1KB page nametable index is shown from, the cart wires
+// it up and without one it's vertical mirroring
+func (m *Memory) Nametable(index int) int {
+	switch {
+	case m.nametable != nil:
+		return m.nametable.Nametable(index)
+	case m.chr != nil:
+		return m.chr.Mirroring().Nametable(index)
+	}
+	return MirrorTypeVertical.Nametable(index)
+}
+
+// FetchChr is the PPU reading the pattern tables to render, carts watching
+// the PPU's bus see it after the read so they can switch banks on it
+func (m *Memory) FetchChr(address uint16) byte {
+	var value byte
+	if m.chr != nil {
+		value = m.chr.ReadChr(address)
+	}
+	if m.watcher != nil {
+		m.watcher.PpuAddress(address)
+	}
+	m.hooks.chr(address, value)
+
+	return value
+}
+
+// CartIrq is the cart pulling the IRQ line
+func (m *Memory) CartIrq() bool {
+	return m.irq != nil && m.irq.Irq()
+}
+
+// Cart is nil until one is inserted
+func (m *Memory) Cart() Cart {
+	return m.cart
+}
+
+// Header is from the last LoadRom, nil for carts inserted with SetCart
+func (m *Memory) Header() *Header {
+	return m.header
+}
+
+// SaveRam is the cart's battery backed RAM, nil when it doesn't have any
+func (m *Memory) SaveRam() []byte {
+	if cart, ok := m.cart.(SaveRam); ok {
+		return cart.SaveRam()
+	}
+	return nil
+}
+
+// Err is the first access that failed since the last ClearErr, the bus
+// can't return errors so they're kept until someone asks
+func (m *Memory) Err() error {
+	return m.err
+}
+
+func (m *Memory) ClearErr() {
+	m.err = nil
+}
+
+// OpenBus is the last value read or written by the CPU
+func (m *Memory) OpenBus() byte {
+	return m.openBus
+}
+
+func (m *Memory) fault(subsystem Subsystem, address uint16, write bool, err error) {
+	if err == nil || m.err != nil || m.Policy == PolicyLenient {
+		return
+	}
+
+	m.err = &BusError{
+		Subsystem: subsystem,
+		Address:   address,
+		Write:     write,
+		Err:       err,
+	}
 }
 
 func (m *Memory) WriteByteAt(address uint16, value byte) {
+	m.openBus = value
+	if len(m.hooks.writes) > 0 {
+		var ok bool
+		if value, ok = m.hooks.write(address, value); !ok {
+			return
+		}
+	}
+
+	m.write(address, value)
+}
+
+func (m *Memory) write(address uint16, value byte) {
 	switch {
 	//Intenal Ram
 	case address >= 0x0000 && address <= 0x07FF:
@@ -52,19 +219,29 @@ func (m *Memory) WriteByteAt(address uint16, value byte) {
 		m.iRam[address-0x1800] = value
 	//PPU
 	case address >= 0x2000 && address <= 0x2007:
-		m.PpuRegisters.WriteByteAt(address, value)
+		m.fault(SubsystemPpu, address, true, m.PpuRegisters.WriteByteAt(address, value))
 	//Mirror of PPU repeats every 8 bytes
 	case address >= 0x2008 && address <= 0x3FFF:
-		m.PpuRegisters.WriteByteAt(0x2000+address%8, value)
+		m.fault(SubsystemPpu, address, true, m.PpuRegisters.WriteByteAt(0x2000+address%8, value))
+	//OAM DMA
+	case address == 0x4014:
+		m.Dma.StartOam(value)
+	//Controller strobe
+	case address == 0x4016:
+		m.Input.Strobe(value & 0x07)
 	//APU and IO
 	case address >= 0x4000 && address <= 0x4017:
-		m.Apu.WriteByteAt(address, value)
+		m.fault(SubsystemApu, address, true, m.Apu.WriteByteAt(address, value))
 	//Funky APU and IO
 	case address >= 0x4018 && address <= 0x401F:
-		panic(fmt.Errorf("funky APU and IO not created"))
+		m.fault(SubsystemIo, address, true, ErrInvalidAddress)
 	//Cart space: PRG, ROM, PRG, RAM and mappers
 	case address >= 0x4020 && address <= 0xFFFF:
-		m.cart.WriteByteAt(address, value)
+		if m.cart == nil {
+			m.fault(SubsystemCart, address, true, ErrNoCart)
+			return
+		}
+		m.fault(SubsystemCart, address, true, m.cart.WriteByteAt(address, value))
 	}
 }
 
@@ -74,6 +251,23 @@ func (m *Memory) WriteUint16At(address, value uint16) {
 }
 
 func (m *Memory) ReadByteAt(address uint16) byte {
+	value := m.read(address, false)
+	if len(m.hooks.reads) > 0 {
+		value = m.hooks.read(address, value)
+	}
+	m.openBus = value
+	return value
+}
+
+// PeekByteAt reads what the CPU would without any side effects, the open bus
+// and hooks are left alone. Debuggers and trace loggers use it.
+func (m *Memory) PeekByteAt(address uint16) byte {
+	return m.read(address, true)
+}
+
+// read returns the open bus value for anything that doesn't answer, peek
+// skips the side effects and errors
+func (m *Memory) read(address uint16, peek bool) byte {
 	switch {
 	//Intenal Ram
 	case address >= 0x0000 && address <= 0x07FF:
@@ -87,90 +281,133 @@ func (m *Memory) ReadByteAt(address uint16) byte {
 	//Mirror of Ram
 	case address >= 0x1800 && address <= 0x1FFF:
 		return m.iRam[address-0x1800]
-	//PPU
-	case address >= 0x2000 && address <= 0x2007:
-		return m.PpuRegisters.ReadByteAt(address)
-	//Mirror of PPU repeats every 8 bytes
-	case address >= 0x2008 && address <= 0x3FFF:
-		return m.PpuRegisters.ReadByteAt(0x2000 + address%8)
+	}
+
+	var subsystem Subsystem
+	var value byte
+	var err error
+	switch {
+	//PPU, mirrors repeat every 8 bytes
+	case address >= 0x2000 && address <= 0x3FFF:
+		subsystem = SubsystemPpu
+		if peek {
+			value, err = m.PpuRegisters.PeekByteAt(0x2000 + address%8)
+		} else {
+			value, err = m.PpuRegisters.ReadByteAt(0x2000 + address%8)
+		}
+	//Controllers, only the bottom bits are driven
+	case address == 0x4016 || address == 0x4017:
+		subsystem = SubsystemIo
+		if peek {
+			value = m.Input.Peek(int(address-0x4016) + 1)
+		} else {
+			value = m.Input.Read(int(address-0x4016) + 1)
+		}
+		value |= m.openBus &^ input.DataMask
 	//APU and IO
 	case address >= 0x4000 && address <= 0x4017:
-		return m.Apu.ReadByteAt(address)
+		subsystem = SubsystemApu
+		if peek {
+			value, err = m.Apu.PeekByteAt(address)
+		} else {
+			value, err = m.Apu.ReadByteAt(address)
+		}
+		// Bit 5 of the status isn't driven
+		if address == 0x4015 {
+			value = value&^0x20 | m.openBus&0x20
+		}
 	//Funky APU and IO
 	case address >= 0x4018 && address <= 0x401F:
-		panic(fmt.Errorf("funky APU and IO not created"))
+		subsystem = SubsystemIo
+		err = ErrInvalidAddress
 	//Cart space: PRG, ROM, PRG, RAM and mappers
-	case address >= 0x4020 && address <= 0xFFFF:
-		return m.cart.ReadByteAt(address)
+	default:
+		subsystem = SubsystemCart
+		if m.cart == nil {
+			err = ErrNoCart
+		} else if peeker, ok := m.cart.(CartPeeker); ok && peek {
+			value, err = peeker.PeekByteAt(address)
+		} else {
+			value, err = m.cart.ReadByteAt(address)
+		}
 	}
 
-	panic(fmt.Errorf("invalid address"))
-}
-
-func (m *Memory) ReadUint16At(address uint16) uint16 {
-	return binary.LittleEndian.Uint16(
-		[]byte{m.ReadByteAt(address), m.ReadByteAt(address + 1)})
+	if err != nil {
+		value = m.openBus
+	}
+	if !peek {
+		m.fault(subsystem, address, false, err)
+	}
+	return value
 }
 
-type bytesQueue struct {
-	r io.Reader
-}
+// PokeByteAt changes ram or the cart's PRG directly, ROM included, without
+// going through registers, mappers or hooks. Cheat searches and debuggers use
+// it. The PPU and APU registers can't be poked.
+func (m *Memory) PokeByteAt(address uint16, value byte) error {
+	switch {
+	case address <= 0x1FFF:
+		m.iRam[address%0x0800] = value
+	case address >= 0x4020:
+		if m.cart == nil {
+			return ErrNoCart
+		}
+		poker, ok := m.cart.(CartPeeker)
+		if !ok {
+			return ErrCantPoke
+		}
+		return poker.PokeByteAt(address, value)
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "can't poke $%04X", address)
+	}
 
-func (b *bytesQueue) Pop() (byte, error) {
-	buf := make([]byte, 1)
-	_, err := b.r.Read(buf)
-	return buf[0], err
+	return nil
 }
 
-func (b *bytesQueue) PopN(n int64) ([]byte, error) {
-	buf := make([]byte, n)
-	_, err := b.r.Read(buf)
-	return buf, err
+func (m *Memory) ReadUint16At(address uint16) uint16 {
+	return uint16(m.ReadByteAt(address)) | uint16(m.ReadByteAt(address+1))<<8
 }
 
+// LoadRom reads a .nes file and inserts it as the cart
 func (m *Memory) LoadRom(r io.Reader) error {
-	buffer := bytesQueue{
-		r: r,
-	}
-
-	info := CartInfo{}
-
-	dotNesHeaderPrefix := []byte{0x4E, 0x45, 0x53, 0x1A}
-	if cartPrefix, err := buffer.PopN(4); err != nil || !bytes.Equal(dotNesHeaderPrefix, cartPrefix) {
+	data := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, data); err != nil {
 		return ErrInvalidRom
 	}
-
-	var err error
-	info.PrgRomBanks, _ = buffer.Pop()
-	info.ChrRomBanks, _ = buffer.Pop()
-	controlByte1, _ := buffer.Pop()
-	info.ControlByte1 = createControlByte1(controlByte1)
-	controlByte2, _ := buffer.Pop()
-	info.ControlByte2, err = createControlByte2(controlByte2)
+	header, err := ParseHeader(data)
 	if err != nil {
 		return err
 	}
-	info.PrgRamLength, _ = buffer.Pop()
-
-	m.cart = createCart(info)
 
-	buffer.PopN(7)
+	cart, err := createCart(header)
+	if err != nil {
+		return err
+	}
 
-	for i := 0; i < int(info.PrgRomBanks); i++ {
-		data, err := buffer.PopN(16384)
-		if err != nil {
-			return ErrInvalidRom
+	// Nothing uses the copier trainer at $7000
+	if header.Trainer {
+		if _, err := io.ReadFull(r, make([]byte, TrainerSize)); err != nil {
+			return errors.Wrapf(ErrInvalidRom, "trainer: %v", err)
 		}
-		m.cart.WriteBytesPrg(data)
 	}
 
-	for i := 0; i < int(info.ChrRomBanks); i++ {
-		data, err := buffer.PopN(8192)
-		if err != nil {
-			return ErrInvalidRom
-		}
-		m.cart.WriteBytesPrg(data)
+	prg := make([]byte, header.PrgRomSize)
+	if n, err := io.ReadFull(r, prg); err != nil {
+		return errors.Wrapf(ErrInvalidRom, "PRG is %d bytes expected %d", n, len(prg))
+	}
+	chr := make([]byte, header.ChrRomSize)
+	if n, err := io.ReadFull(r, chr); err != nil {
+		return errors.Wrapf(ErrInvalidRom, "CHR is %d bytes expected %d", n, len(chr))
+	}
+
+	if err := cart.WriteBytesPrg(prg); err != nil {
+		return err
+	}
+	if err := cart.WriteBytesChr(chr); err != nil {
+		return err
 	}
+	m.SetCart(cart)
+	m.header = header
 
 	return nil
 }
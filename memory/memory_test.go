@@ -3,12 +3,17 @@ package memory_test
 import (
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/input"
 	"github.com/sardap/gos/memory"
 	"github.com/stretchr/testify/assert"
 )
 
+// createMemory is strict so tests catch unmapped accesses
 func createMemory() *memory.Memory {
-	return memory.Create()
+	m := memory.Create()
+	m.Policy = memory.PolicyStrict
+	return m
 }
 
 func TestRamMirroing(t *testing.T) {
@@ -25,3 +30,191 @@ func TestRamMirroing(t *testing.T) {
 		assert.Equal(t, value, m.ReadByteAt(i+0x1000))
 	}
 }
+
+func TestPowerOnAndReset(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+
+	m.WriteByteAt(0x0123, 0x45)
+	m.WriteByteAt(0x2000, 0x80)
+	m.WriteByteAt(0x4015, 0x0F)
+
+	m.Reset()
+
+	assert.Equal(t, byte(0x45), m.ReadByteAt(0x0123))
+	assert.Equal(t, byte(0x00), m.PpuRegisters.Ctrl.Read())
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x4015))
+
+	m.WriteByteAt(0x4000, 0x3F)
+
+	m.PowerOn()
+
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x0123))
+	assert.Equal(t, byte(0x00), m.Apu.Pluse1.ReadByteAt(0))
+}
+
+func TestUnmappedPolicy(t *testing.T) {
+	t.Parallel()
+
+	// Lenient unless asked
+	m := memory.Create()
+	m.ReadByteAt(0x4018)
+	assert.NoError(t, m.Err())
+
+	m = createMemory()
+	assert.Equal(t, byte(0), m.ReadByteAt(0x4018))
+	var busErr *memory.BusError
+	assert.True(t, errors.As(m.Err(), &busErr))
+	assert.Equal(t, memory.SubsystemIo, busErr.Subsystem)
+	assert.Equal(t, uint16(0x4018), busErr.Address)
+	assert.False(t, busErr.Write)
+	assert.True(t, errors.Is(m.Err(), memory.ErrInvalidAddress))
+
+	// Only the first is kept
+	m.WriteByteAt(0x8000, 0x01)
+	assert.Equal(t, uint16(0x4018), busErr.Address)
+
+	m.ClearErr()
+	m.WriteByteAt(0x8000, 0x01)
+	assert.True(t, errors.Is(m.Err(), memory.ErrNoCart))
+	assert.Equal(t, "cart write $8000: no cart inserted", m.Err().Error())
+
+	m.ClearErr()
+	m.ReadByteAt(0x401A)
+	assert.True(t, errors.Is(m.Err(), memory.ErrInvalidAddress))
+
+	m.ClearErr()
+	m.Policy = memory.PolicyLenient
+	m.ReadByteAt(0x401A)
+	m.WriteByteAt(0x4018, 0x01)
+	assert.NoError(t, m.Err())
+}
+
+func TestOpenBus(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	m.Policy = memory.PolicyLenient
+
+	m.WriteByteAt(0x0010, 0x5A)
+	assert.Equal(t, byte(0x5A), m.ReadByteAt(0x0010))
+	assert.Equal(t, byte(0x5A), m.ReadByteAt(0x4018))
+	// No cart
+	assert.Equal(t, byte(0x5A), m.ReadByteAt(0x8000))
+
+	m.WriteByteAt(0x0011, 0xA5)
+	assert.Equal(t, byte(0xA5), m.ReadByteAt(0x401F))
+	assert.Equal(t, byte(0xA5), m.OpenBus())
+
+	// Bit 5 of the APU status
+	m.WriteByteAt(0x4015, 0x0F)
+	m.ReadByteAt(0x0011)
+	assert.Equal(t, byte(0x2F), m.ReadByteAt(0x4015))
+
+	// The rest of the APU is write only
+	m.WriteByteAt(0x4000, 0x3F)
+	m.ReadByteAt(0x0011)
+	assert.Equal(t, byte(0xA5), m.ReadByteAt(0x4000))
+	assert.Equal(t, byte(0xA5), m.PeekByteAt(0x4013))
+
+	// The PPU has its own bus for the write only registers and the bottom of
+	// PPUSTATUS
+	m.PpuRegisters.Status.Write(0x80)
+	m.WriteByteAt(0x2000, 0x1B)
+	m.WriteByteAt(0x0010, 0x00)
+	assert.Equal(t, byte(0x1B), m.ReadByteAt(0x2005))
+	assert.Equal(t, byte(0x9B), m.ReadByteAt(0x2002))
+}
+
+func TestPeekPoke(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+
+	assert.NoError(t, m.PokeByteAt(0x0810, 0x42))
+	assert.Equal(t, byte(0x42), m.PeekByteAt(0x0010))
+	assert.Equal(t, byte(0x00), m.OpenBus())
+
+	var hooked bool
+	m.AddReadHook(0x0000, 0xFFFF, func(address uint16, value byte) byte {
+		hooked = true
+		return value
+	})
+	m.WriteByteAt(0x0000, 0x77)
+	assert.Equal(t, byte(0x77), m.PeekByteAt(0x4018))
+	assert.Equal(t, byte(0x42), m.PeekByteAt(0x1810))
+	assert.False(t, hooked)
+	assert.NoError(t, m.Err())
+
+	assert.True(t, errors.Is(m.PokeByteAt(0x2000, 0x01), memory.ErrInvalidAddress))
+	assert.Equal(t, memory.ErrNoCart, m.PokeByteAt(0x8000, 0x01))
+	assert.Equal(t, byte(0x00), m.PpuRegisters.Ctrl.Read())
+
+	// Poking would go through its registers
+	cart := &registerCart{}
+	m.SetCart(cart)
+	assert.Equal(t, memory.ErrCantPoke, m.PokeByteAt(0x8000, 0x01))
+	assert.False(t, cart.written)
+}
+
+// registerCart is a cart with only registers, it isn't a CartPeeker
+type registerCart struct {
+	written bool
+}
+
+func (c *registerCart) WriteBytesPrg(value []byte) error {
+	return nil
+}
+
+func (c *registerCart) WriteBytesChr(value []byte) error {
+	return nil
+}
+
+func (c *registerCart) WriteByteAt(address uint16, value byte) error {
+	c.written = true
+	return nil
+}
+
+func (c *registerCart) ReadByteAt(address uint16) (byte, error) {
+	return 0, nil
+}
+
+func TestControllerPorts(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	controller := &input.Controller{Buttons: input.ButtonB}
+	m.Input.Port2 = controller
+
+	m.WriteByteAt(0x4016, 0x01)
+	m.WriteByteAt(0x4016, 0x40)
+	assert.NoError(t, m.Err())
+
+	// The top bits are open bus, $40 from the write
+	assert.Equal(t, byte(0x40), m.ReadByteAt(0x4017))
+	assert.Equal(t, byte(0x41), m.PeekByteAt(0x4017))
+	assert.Equal(t, byte(0x41), m.ReadByteAt(0x4017))
+	assert.Equal(t, byte(0x40), m.ReadByteAt(0x4016))
+	assert.NoError(t, m.Err())
+}
+
+func TestPpuDataAddress(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	m.WriteByteAt(0x2006, 0x21)
+	m.WriteByteAt(0x2006, 0x00)
+	m.WriteByteAt(0x2007, 0x01)
+	// Down a column
+	m.WriteByteAt(0x2000, 0x04)
+	m.WriteByteAt(0x2007, 0x02)
+	m.WriteByteAt(0x2007, 0x03)
+
+	assert.Equal(t, []memory.PpuWrite{
+		{Address: 0x2100, Value: 0x01},
+		{Address: 0x2101, Value: 0x02},
+		{Address: 0x2121, Value: 0x03},
+	}, m.PpuRegisters.GetPendingWrites())
+	assert.NoError(t, m.Err())
+}
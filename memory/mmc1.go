@@ -0,0 +1,279 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	mmc1PrgBankSize = 0x4000
+	mmc1ChrBankSize = 0x1000
+	mmc1RamBankSize = 0x2000
+	// mmc1OuterPrgSize is the PRG one PRG register can reach, SUROM and
+	// SXROM pick which half of their 512KB with CHR bank bit 4
+	mmc1OuterPrgSize = 0x40000
+)
+
+// Mmc1 is mapper 1, the SxROM boards. Registers are loaded a bit at a time
+// through a 5 bit shift register, with CHR RAM the CHR bank bits select the
+// larger PRG ROM and RAM of SUROM, SOROM and SXROM.
+// https://wiki.nesdev.com/w/index.php/MMC1
+type Mmc1 struct {
+	Prg    []byte
+	Chr    []byte
+	PrgRam []byte
+
+	battery bool
+	chrRam  bool
+
+	shift byte
+	count int
+	// control is mirroring in bits 0-1, PRG mode in bits 2-3 and CHR mode in
+	// bit 4
+	control byte
+	chr0    byte
+	chr1    byte
+	prg     byte
+
+	// cycles is counted by Clock so writes on consecutive cycles, like a
+	// read-modify-write instruction's, can be ignored. Without a cycle
+	// accurate CPU they land on the same cycle.
+	cycles    int64
+	lastWrite int64
+}
+
+func createMmc1(header *Header) (Cart, error) {
+	if header.PrgRomSize == 0 || header.PrgRomSize%mmc1PrgBankSize != 0 {
+		return nil, errors.Wrapf(ErrInvalidRom, "MMC1 can't have %d bytes of PRG", header.PrgRomSize)
+	}
+
+	result := &Mmc1{
+		PrgRam:    make([]byte, header.PrgRamSize+header.PrgNvramSize),
+		battery:   header.PrgNvramSize > 0,
+		control:   0x0C,
+		lastWrite: -2,
+	}
+	if header.ChrRomSize == 0 {
+		size := header.ChrRamSize + header.ChrNvramSize
+		if size == 0 {
+			size = ChrBankSize
+		}
+		result.Chr = make([]byte, size)
+		result.chrRam = true
+	}
+
+	return result, nil
+}
+
+func (c *Mmc1) SaveRam() []byte {
+	if !c.battery {
+		return nil
+	}
+	return c.PrgRam
+}
+
+func (c *Mmc1) WriteBytesPrg(value []byte) error {
+	c.Prg = append(c.Prg, value...)
+	return nil
+}
+
+func (c *Mmc1) WriteBytesChr(value []byte) error {
+	if c.chrRam {
+		return nil
+	}
+	c.Chr = append(c.Chr, value...)
+	return nil
+}
+
+func (c *Mmc1) Clock() {
+	c.cycles++
+}
+
+// bankBits is the CHR bank register that drives the extra PRG and RAM lines.
+// In 4KB mode it's really whichever one the PPU last fetched through, games
+// keep both the same.
+func (c *Mmc1) bankBits() byte {
+	return c.chr0
+}
+
+func (c *Mmc1) ramOffset(address uint16) int {
+	if len(c.PrgRam) == 0 || c.prg&0x10 != 0 {
+		return -1
+	}
+
+	bank := 0
+	if c.chrRam {
+		switch len(c.PrgRam) / mmc1RamBankSize {
+		// SOROM
+		case 2:
+			bank = int(c.bankBits()>>3) & 0x01
+		// SXROM
+		case 4:
+			bank = int(c.bankBits()>>2) & 0x03
+		}
+	}
+
+	return (bank*mmc1RamBankSize + int(address-0x6000)) % len(c.PrgRam)
+}
+
+func (c *Mmc1) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+
+	outer := 0
+	if len(c.Prg) > mmc1OuterPrgSize && c.chrRam {
+		outer = int(c.bankBits()>>4) & 0x01
+	}
+	banks := mmc1OuterPrgSize / mmc1PrgBankSize
+	if len(c.Prg) < mmc1OuterPrgSize {
+		banks = len(c.Prg) / mmc1PrgBankSize
+	}
+
+	bank := int(c.prg & 0x0F)
+	high := address >= 0xC000
+	switch (c.control >> 2) & 0x03 {
+	// 32KB at $8000, the low bit is ignored
+	case 0, 1:
+		bank &^= 1
+		if high {
+			bank |= 1
+		}
+	// First bank fixed at $8000
+	case 2:
+		if !high {
+			bank = 0
+		}
+	// Last bank fixed at $C000
+	case 3:
+		if high {
+			bank = banks - 1
+		}
+	}
+
+	bank = outer*banks + bank%banks
+	return (bank*mmc1PrgBankSize + int(address&0x3FFF)) % len(c.Prg)
+}
+
+func (c *Mmc1) chrIndex(address uint16) int {
+	var bank int
+	switch {
+	// 8KB mode, the low bit is ignored
+	case c.control&0x10 == 0:
+		bank = int(c.chr0&^1) + int(address>>12)
+	case address < 0x1000:
+		bank = int(c.chr0)
+	default:
+		bank = int(c.chr1)
+	}
+
+	return (bank*mmc1ChrBankSize + int(address&0x0FFF)) % len(c.Chr)
+}
+
+// ChrOffset is -1 for CHR RAM, it's not in the ROM
+func (c *Mmc1) ChrOffset(address uint16) int {
+	if address >= 0x2000 || c.chrRam || len(c.Chr) == 0 {
+		return -1
+	}
+	return c.chrIndex(address)
+}
+
+func (c *Mmc1) ReadChr(address uint16) byte {
+	return c.Chr[c.chrIndex(address)]
+}
+
+func (c *Mmc1) WriteChr(address uint16, value byte) {
+	if c.chrRam {
+		c.Chr[c.chrIndex(address)] = value
+	}
+}
+
+func (c *Mmc1) Mirroring() MirrorType {
+	switch c.control & 0x03 {
+	case 0:
+		return MirrorTypeSingleLower
+	case 1:
+		return MirrorTypeSingleUpper
+	case 2:
+		return MirrorTypeVertical
+	}
+	return MirrorTypeHorizontal
+}
+
+// load shifts in a bit of a register write, the fifth picks the register by
+// address
+func (c *Mmc1) load(address uint16, value byte) {
+	consecutive := c.cycles-c.lastWrite <= 1
+	c.lastWrite = c.cycles
+	if consecutive {
+		return
+	}
+
+	if value&0x80 != 0 {
+		c.shift = 0
+		c.count = 0
+		c.control |= 0x0C
+		return
+	}
+
+	c.shift |= (value & 0x01) << c.count
+	c.count++
+	if c.count < 5 {
+		return
+	}
+
+	switch address & 0xE000 {
+	case 0x8000:
+		c.control = c.shift
+	case 0xA000:
+		c.chr0 = c.shift
+	case 0xC000:
+		c.chr1 = c.shift
+	case 0xE000:
+		c.prg = c.shift
+	}
+	c.shift = 0
+	c.count = 0
+}
+
+func (c *Mmc1) WriteByteAt(address uint16, value byte) error {
+	switch {
+	case address >= 0x8000:
+		c.load(address, value)
+	case address >= 0x6000:
+		offset := c.ramOffset(address)
+		if offset < 0 {
+			return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+		}
+		c.PrgRam[offset] = value
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (c *Mmc1) ReadByteAt(address uint16) (byte, error) {
+	switch {
+	case address >= 0x8000:
+		return c.Prg[c.PrgOffset(address)], nil
+	case address >= 0x6000:
+		if offset := c.ramOffset(address); offset >= 0 {
+			return c.PrgRam[offset], nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+}
+
+func (c *Mmc1) PeekByteAt(address uint16) (byte, error) {
+	return c.ReadByteAt(address)
+}
+
+// PokeByteAt patches the ROM instead of writing the registers
+func (c *Mmc1) PokeByteAt(address uint16, value byte) error {
+	if address >= 0x8000 {
+		c.Prg[c.PrgOffset(address)] = value
+		return nil
+	}
+	return c.WriteByteAt(address, value)
+}
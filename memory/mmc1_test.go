@@ -0,0 +1,208 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// bankedRom has the bank number at the start of every PRG and CHR bank
+func bankedRom(headerBytes []byte, prgBank, chrBank int) []byte {
+	rom := header(headerBytes...)
+	prg := make([]byte, int(headerBytes[0])*memory.PrgBankSize)
+	for i := 0; i < len(prg); i += prgBank {
+		prg[i] = byte(i / prgBank)
+	}
+	chr := make([]byte, int(headerBytes[1])*memory.ChrBankSize)
+	for i := 0; i < len(chr); i += chrBank {
+		chr[i] = byte(i / chrBank)
+	}
+	return append(append(rom, prg...), chr...)
+}
+
+func mmc1Write(m *memory.Memory, address uint16, value byte) {
+	for i := 0; i < 5; i++ {
+		// Writes on the same or the next cycle are ignored
+		m.Tick()
+		m.Tick()
+		m.WriteByteAt(address, value>>i&0x01)
+	}
+}
+
+func TestMmc1Prg(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom([]byte{0x08, 0x01, 0x10}, 0x4000, 0x1000))))
+	assert.IsType(t, &memory.Mmc1{}, m.Cart())
+	// Powers on with the last bank fixed at $C000
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+
+	mmc1Write(m, 0xE000, 0x03)
+	assert.Equal(t, byte(3), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+	assert.Equal(t, 3*0x4000+0x10, m.Cart().(memory.RomMapper).PrgOffset(0x8010))
+
+	// First bank fixed at $8000
+	mmc1Write(m, 0x8000, 0x08)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(3), m.ReadByteAt(0xC000))
+
+	// 32KB ignores the low bit
+	mmc1Write(m, 0x9FFF, 0x00)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(3), m.ReadByteAt(0xC000))
+
+	// Bit 7 resets the shift register and goes back to the last bank fixed
+	m.Tick()
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x01)
+	m.Tick()
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x80)
+	mmc1Write(m, 0xE000, 0x05)
+	assert.Equal(t, byte(5), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+	assert.NoError(t, m.Err())
+}
+
+func TestMmc1ConsecutiveWrites(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom([]byte{0x08, 0x01, 0x10}, 0x4000, 0x1000))))
+
+	// A read-modify-write's second write lands on the next cycle
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x01)
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x00)
+	for i := 0; i < 4; i++ {
+		m.Tick()
+		m.Tick()
+		m.WriteByteAt(0xE000, 0x00)
+	}
+	assert.Equal(t, byte(1), m.ReadByteAt(0x8000))
+
+	// Nor can the reset bit get in on the next cycle
+	m.Tick()
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x01)
+	m.Tick()
+	m.WriteByteAt(0xE000, 0x80)
+	for i := 0; i < 4; i++ {
+		m.Tick()
+		m.Tick()
+		m.WriteByteAt(0xE000, 0x01)
+	}
+	assert.Equal(t, byte(15%8), m.ReadByteAt(0x8000))
+}
+
+func TestMmc1Chr(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom([]byte{0x02, 0x04, 0x11}, 0x4000, 0x1000))))
+	cart := m.Cart().(memory.ChrCart)
+	// The header's mirroring is ignored
+	assert.Equal(t, memory.MirrorTypeSingleLower, cart.Mirroring())
+
+	// 8KB ignores the low bit
+	mmc1Write(m, 0xA000, 0x03)
+	assert.Equal(t, byte(2), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(3), cart.ReadChr(0x1000))
+
+	// 4KB mode and vertical mirroring
+	mmc1Write(m, 0x8000, 0x1E)
+	mmc1Write(m, 0xC000, 0x05)
+	assert.Equal(t, byte(3), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(5), cart.ReadChr(0x1000))
+	assert.Equal(t, 5*0x1000+0x10, m.Cart().(memory.RomMapper).ChrOffset(0x1010))
+	assert.Equal(t, memory.MirrorTypeVertical, cart.Mirroring())
+
+	cart.WriteChr(0x0000, 0xFF)
+	assert.Equal(t, byte(3), cart.ReadChr(0x0000))
+
+	for control, mirroring := range []memory.MirrorType{
+		memory.MirrorTypeSingleLower,
+		memory.MirrorTypeSingleUpper,
+		memory.MirrorTypeVertical,
+		memory.MirrorTypeHorizontal,
+	} {
+		mmc1Write(m, 0x8000, byte(control))
+		assert.Equal(t, mirroring, cart.Mirroring())
+	}
+}
+
+func TestMmc1PrgRam(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom([]byte{0x02, 0x00, 0x12}, 0x4000, 0x1000))))
+	m.WriteByteAt(0x6000, 0x42)
+	assert.Equal(t, byte(0x42), m.ReadByteAt(0x6000))
+	assert.Equal(t, byte(0x42), m.SaveRam()[0])
+
+	// Bit 4 of the PRG bank disables it
+	mmc1Write(m, 0xE000, 0x10)
+	m.WriteByteAt(0x6000, 0x24)
+	assert.Error(t, m.Err())
+	assert.Equal(t, byte(0x24), m.ReadByteAt(0x6000))
+	mmc1Write(m, 0xE000, 0x00)
+	assert.Equal(t, byte(0x42), m.ReadByteAt(0x6000))
+
+	// CHR RAM
+	cart := m.Cart().(memory.ChrCart)
+	cart.WriteChr(0x1234, 0x99)
+	assert.Equal(t, byte(0x99), cart.ReadChr(0x1234))
+	assert.Equal(t, -1, m.Cart().(memory.RomMapper).ChrOffset(0x1234))
+}
+
+func TestSurom(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom([]byte{0x20, 0x00, 0x10}, 0x4000, 0x1000))))
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(15), m.ReadByteAt(0xC000))
+
+	// CHR bit 4 is the 256KB half
+	mmc1Write(m, 0xA000, 0x10)
+	mmc1Write(m, 0xE000, 0x02)
+	assert.Equal(t, byte(18), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(31), m.ReadByteAt(0xC000))
+}
+
+func TestSxrom(t *testing.T) {
+	t.Parallel()
+
+	// NES 2.0 with 32KB of battery backed PRG RAM
+	rom := bankedRom([]byte{0x20, 0x00, 0x12, 0x08, 0x00, 0x00, 0x90}, 0x4000, 0x1000)
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+	assert.Len(t, m.SaveRam(), 0x8000)
+
+	for bank := 0; bank < 4; bank++ {
+		mmc1Write(m, 0xA000, byte(bank<<2))
+		m.WriteByteAt(0x6000, byte(bank+1))
+	}
+	mmc1Write(m, 0xA000, 0x08)
+	assert.Equal(t, byte(3), m.ReadByteAt(0x6000))
+	assert.Equal(t, byte(4), m.SaveRam()[0x6000])
+
+	// SOROM has 8KB of RAM and 8KB battery backed, only bit 3 picks
+	rom = bankedRom([]byte{0x10, 0x00, 0x12, 0x08, 0x00, 0x00, 0x77}, 0x4000, 0x1000)
+	m = createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+	assert.Len(t, m.Cart().(*memory.Mmc1).PrgRam, 0x4000)
+
+	mmc1Write(m, 0xA000, 0x04)
+	m.WriteByteAt(0x6000, 0x11)
+	mmc1Write(m, 0xA000, 0x08)
+	m.WriteByteAt(0x6000, 0x22)
+	mmc1Write(m, 0xA000, 0x00)
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0x6000))
+}
@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	mmc2PrgBankSize = 0x2000
+	mmc4PrgBankSize = 0x4000
+	mmc2ChrBankSize = 0x1000
+)
+
+// Mmc2 is mapper 9, PxROM, and with mmc4 set mapper 10, FxROM. Each 4KB
+// half of the pattern tables has an FD and an FE bank, the PPU fetching tile
+// $FD or $FE from that half switches to it for the fetches after.
+// https://wiki.nesdev.com/w/index.php/MMC2
+// https://wiki.nesdev.com/w/index.php/MMC4
+type Mmc2 struct {
+	Prg    []byte
+	Chr    []byte
+	PrgRam []byte
+
+	// mmc4 has 16KB PRG banks and both latches look at all 8 rows of the
+	// tiles' high planes, the MMC2's $0000 latch only sees the first
+	mmc4    bool
+	battery bool
+
+	prgBank byte
+	// chrBanks are the FD and FE banks for $0000 and $1000
+	chrBanks [2][2]byte
+	// latches pick FD with 0 or FE with 1 for $0000 and $1000
+	latches   [2]int
+	mirroring MirrorType
+}
+
+func createMmc2(header *Header, mmc4 bool) (Cart, error) {
+	if header.PrgRomSize == 0 || header.PrgRomSize%PrgBankSize != 0 {
+		return nil, errors.Wrapf(ErrInvalidRom, "MMC2 can't have %d bytes of PRG", header.PrgRomSize)
+	}
+	if header.ChrRomSize == 0 {
+		return nil, errors.Wrap(ErrInvalidRom, "MMC2 needs CHR ROM")
+	}
+
+	return &Mmc2{
+		PrgRam:    make([]byte, header.PrgRamSize+header.PrgNvramSize),
+		mmc4:      mmc4,
+		battery:   header.PrgNvramSize > 0,
+		latches:   [2]int{1, 1},
+		mirroring: header.Mirroring,
+	}, nil
+}
+
+func createPxrom(header *Header) (Cart, error) {
+	return createMmc2(header, false)
+}
+
+func createFxrom(header *Header) (Cart, error) {
+	return createMmc2(header, true)
+}
+
+func (c *Mmc2) SaveRam() []byte {
+	if !c.battery {
+		return nil
+	}
+	return c.PrgRam
+}
+
+func (c *Mmc2) WriteBytesPrg(value []byte) error {
+	c.Prg = append(c.Prg, value...)
+	return nil
+}
+
+func (c *Mmc2) WriteBytesChr(value []byte) error {
+	c.Chr = append(c.Chr, value...)
+	return nil
+}
+
+// PpuAddress sets the latches once the PPU has read the high plane of tile
+// $FD or $FE
+func (c *Mmc2) PpuAddress(address uint16) {
+	if address >= 0x2000 {
+		return
+	}
+
+	half := int(address>>12) & 0x01
+	tile := address & 0x0FF8
+	if half == 0 && !c.mmc4 {
+		tile = address & 0x0FFF
+	}
+	switch tile {
+	case 0x0FD8:
+		c.latches[half] = 0
+	case 0x0FE8:
+		c.latches[half] = 1
+	}
+}
+
+func (c *Mmc2) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+
+	size := mmc2PrgBankSize
+	if c.mmc4 {
+		size = mmc4PrgBankSize
+	}
+	banks := len(c.Prg) / size
+	slot := int(address-0x8000) / size
+
+	// Everything after the first slot is fixed to the last banks
+	bank := banks - (0x8000/size - slot)
+	if slot == 0 {
+		bank = int(c.prgBank&0x0F) % banks
+	}
+	return bank*size + int(address)%size
+}
+
+func (c *Mmc2) chrIndex(address uint16) int {
+	half := int(address>>12) & 0x01
+	bank := int(c.chrBanks[half][c.latches[half]] & 0x1F)
+	return (bank*mmc2ChrBankSize + int(address&0x0FFF)) % len(c.Chr)
+}
+
+func (c *Mmc2) ChrOffset(address uint16) int {
+	if address >= 0x2000 {
+		return -1
+	}
+	return c.chrIndex(address)
+}
+
+func (c *Mmc2) ReadChr(address uint16) byte {
+	return c.Chr[c.chrIndex(address)]
+}
+
+// WriteChr does nothing, it's always ROM
+func (c *Mmc2) WriteChr(address uint16, value byte) {
+}
+
+func (c *Mmc2) Mirroring() MirrorType {
+	return c.mirroring
+}
+
+func (c *Mmc2) WriteByteAt(address uint16, value byte) error {
+	switch {
+	case address >= 0xF000:
+		if value&0x01 == 0 {
+			c.mirroring = MirrorTypeVertical
+		} else {
+			c.mirroring = MirrorTypeHorizontal
+		}
+	case address >= 0xB000:
+		register := int(address-0xB000) >> 12
+		c.chrBanks[register>>1][register&0x01] = value
+	case address >= 0xA000:
+		c.prgBank = value
+	// $8000-$9FFF is ROM with nothing behind it
+	case address >= 0x8000:
+	case address >= 0x6000 && len(c.PrgRam) > 0:
+		c.PrgRam[int(address-0x6000)%len(c.PrgRam)] = value
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (c *Mmc2) ReadByteAt(address uint16) (byte, error) {
+	switch {
+	case address >= 0x8000:
+		return c.Prg[c.PrgOffset(address)], nil
+	case address >= 0x6000 && len(c.PrgRam) > 0:
+		return c.PrgRam[int(address-0x6000)%len(c.PrgRam)], nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+}
+
+func (c *Mmc2) PeekByteAt(address uint16) (byte, error) {
+	return c.ReadByteAt(address)
+}
+
+// PokeByteAt patches the ROM instead of writing the registers
+func (c *Mmc2) PokeByteAt(address uint16, value byte) error {
+	if address >= 0x8000 {
+		c.Prg[c.PrgOffset(address)] = value
+		return nil
+	}
+	return c.WriteByteAt(address, value)
+}
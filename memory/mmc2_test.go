@@ -0,0 +1,112 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func createMmc2(t *testing.T, prgBank int, headerBytes ...byte) *memory.Memory {
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom(headerBytes, prgBank, 0x1000))))
+	assert.IsType(t, &memory.Mmc2{}, m.Cart())
+	return m
+}
+
+func TestMmc2Prg(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc2(t, 0x2000, 0x08, 0x10, 0x90)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(13), m.ReadByteAt(0xA000))
+	assert.Equal(t, byte(14), m.ReadByteAt(0xC000))
+	assert.Equal(t, byte(15), m.ReadByteAt(0xE000))
+
+	m.WriteByteAt(0xA000, 0x03)
+	assert.Equal(t, byte(3), m.ReadByteAt(0x8000))
+	assert.Equal(t, 3*0x2000+1, m.Cart().(memory.RomMapper).PrgOffset(0x8001))
+	assert.NoError(t, m.Err())
+}
+
+func TestMmc2Chr(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc2(t, 0x2000, 0x08, 0x10, 0x90)
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0xB000, 0x04)
+	m.WriteByteAt(0xC000, 0x05)
+	m.WriteByteAt(0xD000, 0x06)
+	m.WriteByteAt(0xE000, 0x07)
+	// Both latches power on at FE
+	assert.Equal(t, byte(5), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(7), cart.ReadChr(0x1000))
+	assert.Equal(t, 7*0x1000+0x10, m.Cart().(memory.RomMapper).ChrOffset(0x1010))
+
+	// The $0000 latch only sees the last row of the tile
+	m.FetchChr(0x0FD0)
+	assert.Equal(t, byte(5), cart.ReadChr(0x0000))
+	m.FetchChr(0x0FD8)
+	assert.Equal(t, byte(4), cart.ReadChr(0x0000))
+	assert.Equal(t, byte(7), cart.ReadChr(0x1000))
+	m.FetchChr(0x0FE8)
+	assert.Equal(t, byte(5), cart.ReadChr(0x0000))
+
+	// The $1000 latch sees all of them
+	m.FetchChr(0x1FDB)
+	assert.Equal(t, byte(6), cart.ReadChr(0x1000))
+	m.FetchChr(0x1FEF)
+	assert.Equal(t, byte(7), cart.ReadChr(0x1000))
+
+	assert.Equal(t, memory.MirrorTypeHorizontal, cart.Mirroring())
+	m.WriteByteAt(0xF000, 0x00)
+	assert.Equal(t, memory.MirrorTypeVertical, cart.Mirroring())
+	m.WriteByteAt(0xF000, 0x01)
+	assert.Equal(t, memory.MirrorTypeHorizontal, cart.Mirroring())
+	assert.NoError(t, m.Err())
+}
+
+func TestMmc4(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc2(t, 0x4000, 0x08, 0x10, 0xA2)
+	assert.Equal(t, byte(0), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+	m.WriteByteAt(0xA000, 0x02)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xC000))
+
+	// Battery backed RAM at $6000
+	m.WriteByteAt(0x6000, 0x42)
+	assert.Equal(t, byte(0x42), m.ReadByteAt(0x6000))
+	assert.Equal(t, byte(0x42), m.SaveRam()[0])
+
+	// Both latches see every row of the high plane
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0xB000, 0x04)
+	m.FetchChr(0x0FD0)
+	assert.Equal(t, byte(0), cart.ReadChr(0x0000))
+	m.FetchChr(0x0FDC)
+	assert.Equal(t, byte(4), cart.ReadChr(0x0000))
+	assert.NoError(t, m.Err())
+}
+
+func TestChrHooks(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc2(t, 0x2000, 0x08, 0x10, 0x90)
+	m.WriteByteAt(0xC000, 0x03)
+	fetches := []uint16{}
+	hook := m.AddChrHook(func(address uint16, value byte) {
+		fetches = append(fetches, address)
+		assert.Equal(t, byte(3), value)
+	})
+
+	assert.Equal(t, byte(3), m.FetchChr(0x0000))
+	assert.Equal(t, []uint16{0x0000}, fetches)
+
+	m.RemoveHook(hook)
+	m.FetchChr(0x0000)
+	assert.Len(t, fetches, 1)
+}
@@ -0,0 +1,391 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	mmc3PrgBankSize = 0x2000
+	mmc3ChrBankSize = 0x0400
+	// mmc3A12Filter is how many CPU cycles A12 has to be low for before a
+	// rise clocks the IRQ counter, it ignores the rises between sprite
+	// fetches
+	mmc3A12Filter = 3
+	mmc6RamSize   = 0x0400
+)
+
+type mmc3Variant int
+
+const (
+	mmc3VariantStandard mmc3Variant = iota
+	// mmc3VariantMmc6 has 1KB of RAM at $7000 protected in two halves
+	mmc3VariantMmc6
+	// mmc3VariantTxsrom wires CHR bank bit 7 to CIRAM A10 instead of the
+	// mirroring register
+	mmc3VariantTxsrom
+	// mmc3VariantTqrom has 8KB of CHR RAM as well as ROM, CHR bank bit 6
+	// picks the RAM
+	mmc3VariantTqrom
+)
+
+// Mmc3 is mapper 4, the TxROM boards, along with MMC6 and the TxSROM
+// (118) and TQROM (119) boards built around it. The IRQ counts scanlines by
+// PPU A12 rising when the sprite and background pattern tables differ.
+// https://wiki.nesdev.com/w/index.php/MMC3
+type Mmc3 struct {
+	Prg    []byte
+	Chr    []byte
+	PrgRam []byte
+	// ChrRam is TQROM's RAM alongside its ROM, boards with only CHR RAM
+	// have it in Chr
+	ChrRam []byte
+
+	variant    mmc3Variant
+	battery    bool
+	chrRam     bool
+	fourScreen bool
+	// oldIrq is the MMC3A's IRQ, it doesn't fire again while the counter
+	// keeps reloading 0
+	oldIrq bool
+
+	bankSelect byte
+	banks      [8]byte
+	mirroring  MirrorType
+	ramProtect byte
+
+	latch      byte
+	counter    byte
+	reload     bool
+	irqEnabled bool
+	irq        bool
+
+	cycles int64
+	a12    bool
+	a12Low int64
+}
+
+func createMmc3(header *Header, variant mmc3Variant) (Cart, error) {
+	if header.PrgRomSize == 0 || header.PrgRomSize%mmc3PrgBankSize != 0 {
+		return nil, errors.Wrapf(ErrInvalidRom, "MMC3 can't have %d bytes of PRG", header.PrgRomSize)
+	}
+
+	ramSize := header.PrgRamSize + header.PrgNvramSize
+	if variant == mmc3VariantMmc6 {
+		ramSize = mmc6RamSize
+	}
+
+	result := &Mmc3{
+		PrgRam:     make([]byte, ramSize),
+		variant:    variant,
+		battery:    header.PrgNvramSize > 0,
+		fourScreen: header.FourScreen,
+		oldIrq:     header.Mapper == 4 && header.Submapper == 4,
+		mirroring:  header.Mirroring,
+		// Enabled and writable, plenty of games never touch it
+		ramProtect: 0x80,
+		a12Low:     -mmc3A12Filter,
+	}
+	if variant == mmc3VariantMmc6 {
+		result.ramProtect = 0
+	}
+	if variant == mmc3VariantTqrom {
+		result.ChrRam = make([]byte, ChrBankSize)
+	} else if header.ChrRomSize == 0 {
+		result.Chr = make([]byte, ChrBankSize)
+		result.chrRam = true
+	}
+
+	return result, nil
+}
+
+func createMmc3Standard(header *Header) (Cart, error) {
+	return createMmc3(header, mmc3VariantStandard)
+}
+
+func createMmc6(header *Header) (Cart, error) {
+	return createMmc3(header, mmc3VariantMmc6)
+}
+
+func createTxsrom(header *Header) (Cart, error) {
+	return createMmc3(header, mmc3VariantTxsrom)
+}
+
+func createTqrom(header *Header) (Cart, error) {
+	return createMmc3(header, mmc3VariantTqrom)
+}
+
+func (c *Mmc3) SaveRam() []byte {
+	if !c.battery {
+		return nil
+	}
+	return c.PrgRam
+}
+
+func (c *Mmc3) WriteBytesPrg(value []byte) error {
+	c.Prg = append(c.Prg, value...)
+	return nil
+}
+
+func (c *Mmc3) WriteBytesChr(value []byte) error {
+	if c.chrRam {
+		return nil
+	}
+	c.Chr = append(c.Chr, value...)
+	return nil
+}
+
+func (c *Mmc3) Clock() {
+	c.cycles++
+}
+
+func (c *Mmc3) Irq() bool {
+	return c.irq
+}
+
+// PpuAddress clocks the IRQ counter when A12 rises after being low long
+// enough
+func (c *Mmc3) PpuAddress(address uint16) {
+	high := address&0x1000 != 0
+	switch {
+	case high && !c.a12 && c.cycles-c.a12Low >= mmc3A12Filter:
+		c.clockIrq()
+	case !high && c.a12:
+		c.a12Low = c.cycles
+	}
+	c.a12 = high
+}
+
+func (c *Mmc3) clockIrq() {
+	zero := c.counter == 0
+	if zero || c.reload {
+		c.counter = c.latch
+	} else {
+		c.counter--
+	}
+
+	if c.counter == 0 && c.irqEnabled && (!c.oldIrq || !zero || c.reload) {
+		c.irq = true
+	}
+	c.reload = false
+}
+
+func (c *Mmc3) prgBank(address uint16) int {
+	banks := len(c.Prg) / mmc3PrgBankSize
+	slot := int(address-0x8000) / mmc3PrgBankSize
+	// PRG mode 1 swaps $8000 and $C000
+	if c.bankSelect&0x40 != 0 && slot&0x01 == 0 {
+		slot ^= 0x02
+	}
+
+	switch slot {
+	case 0:
+		return int(c.banks[6]&0x3F) % banks
+	case 1:
+		return int(c.banks[7]&0x3F) % banks
+	case 2:
+		return banks - 2
+	}
+	return banks - 1
+}
+
+func (c *Mmc3) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	return c.prgBank(address)*mmc3PrgBankSize + int(address&0x1FFF)
+}
+
+// chrBank is the bank register value for a 1KB slot of the pattern tables
+func (c *Mmc3) chrBank(address uint16) byte {
+	slot := int(address>>10) & 0x07
+	// CHR A12 inversion swaps the 2KB and 1KB halves
+	if c.bankSelect&0x80 != 0 {
+		slot ^= 0x04
+	}
+
+	if slot < 4 {
+		return c.banks[slot>>1]&^0x01 | byte(slot&0x01)
+	}
+	return c.banks[slot-2]
+}
+
+// chrIndex is where in Chr the pattern table address reads from, or in
+// ChrRam when ram is true
+func (c *Mmc3) chrIndex(address uint16) (index int, ram bool) {
+	bank := int(c.chrBank(address))
+	offset := int(address & 0x03FF)
+	if c.variant == mmc3VariantTqrom {
+		if bank&0x40 != 0 {
+			return (bank*mmc3ChrBankSize + offset) % len(c.ChrRam), true
+		}
+		bank &= 0x3F
+	}
+	return (bank*mmc3ChrBankSize + offset) % len(c.Chr), false
+}
+
+// ChrOffset is -1 for CHR RAM, it's not in the ROM
+func (c *Mmc3) ChrOffset(address uint16) int {
+	if address >= 0x2000 || c.chrRam || len(c.Chr) == 0 {
+		return -1
+	}
+
+	if index, ram := c.chrIndex(address); !ram {
+		return index
+	}
+	return -1
+}
+
+func (c *Mmc3) ReadChr(address uint16) byte {
+	if len(c.Chr) == 0 {
+		return 0
+	}
+
+	index, ram := c.chrIndex(address)
+	if ram {
+		return c.ChrRam[index]
+	}
+	return c.Chr[index]
+}
+
+func (c *Mmc3) WriteChr(address uint16, value byte) {
+	if len(c.Chr) == 0 {
+		return
+	}
+
+	index, ram := c.chrIndex(address)
+	switch {
+	case ram:
+		c.ChrRam[index] = value
+	case c.chrRam:
+		c.Chr[index] = value
+	}
+}
+
+func (c *Mmc3) Mirroring() MirrorType {
+	return c.mirroring
+}
+
+func (c *Mmc3) Nametable(index int) int {
+	switch {
+	case c.fourScreen:
+		return index & 0x03
+	// In CHR mode 0 R0 and R1 cover two nametables each, in mode 1 R2 to R5
+	// have one each
+	case c.variant == mmc3VariantTxsrom:
+		return int(c.chrBank(uint16(index)<<10)) >> 7
+	}
+	return c.mirroring.Nametable(index)
+}
+
+// ramOffset is where in PrgRam an address goes, -1 when it's disabled.
+// write is the write protect bit instead of the read enable.
+func (c *Mmc3) ramOffset(address uint16, write bool) int {
+	if len(c.PrgRam) == 0 {
+		return -1
+	}
+
+	if c.variant != mmc3VariantMmc6 {
+		if c.ramProtect&0x80 == 0 || write && c.ramProtect&0x40 != 0 {
+			return -1
+		}
+		return int(address-0x6000) % len(c.PrgRam)
+	}
+
+	// MMC6 has nothing at $6000 and the RAM has to be enabled in $8000 as well
+	if address < 0x7000 || c.bankSelect&0x20 == 0 {
+		return -1
+	}
+	index := int(address-0x7000) % mmc6RamSize
+	// Bits 7 and 6 are read and write for the upper 512 bytes, 5 and 4 for
+	// the lower
+	shift := uint(4)
+	if index >= mmc6RamSize/2 {
+		shift = 6
+	}
+	enable := c.ramProtect >> shift & 0x02
+	writable := c.ramProtect >> shift & 0x01
+	if enable == 0 || write && writable == 0 {
+		return -1
+	}
+	return index
+}
+
+func (c *Mmc3) writeRegister(address uint16, value byte) {
+	odd := address&0x01 != 0
+	switch address & 0xE000 {
+	case 0x8000:
+		if odd {
+			c.banks[c.bankSelect&0x07] = value
+		} else {
+			c.bankSelect = value
+		}
+	case 0xA000:
+		if odd {
+			c.ramProtect = value
+		} else if value&0x01 == 0 {
+			c.mirroring = MirrorTypeVertical
+		} else {
+			c.mirroring = MirrorTypeHorizontal
+		}
+	case 0xC000:
+		if odd {
+			c.counter = 0
+			c.reload = true
+		} else {
+			c.latch = value
+		}
+	case 0xE000:
+		c.irqEnabled = odd
+		if !odd {
+			c.irq = false
+		}
+	}
+}
+
+func (c *Mmc3) WriteByteAt(address uint16, value byte) error {
+	switch {
+	case address >= 0x8000:
+		c.writeRegister(address, value)
+	case address >= 0x6000:
+		offset := c.ramOffset(address, true)
+		if offset < 0 {
+			return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+		}
+		c.PrgRam[offset] = value
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (c *Mmc3) ReadByteAt(address uint16) (byte, error) {
+	switch {
+	case address >= 0x8000:
+		return c.Prg[c.PrgOffset(address)], nil
+	case address >= 0x6000:
+		if offset := c.ramOffset(address, false); offset >= 0 {
+			return c.PrgRam[offset], nil
+		}
+		// With one MMC6 half enabled the other reads 0
+		if c.variant == mmc3VariantMmc6 && address >= 0x7000 &&
+			c.bankSelect&0x20 != 0 && c.ramProtect&0xA0 != 0 {
+			return 0, nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+}
+
+func (c *Mmc3) PeekByteAt(address uint16) (byte, error) {
+	return c.ReadByteAt(address)
+}
+
+// PokeByteAt patches the ROM instead of writing the registers
+func (c *Mmc3) PokeByteAt(address uint16, value byte) error {
+	if address >= 0x8000 {
+		c.Prg[c.PrgOffset(address)] = value
+		return nil
+	}
+	return c.WriteByteAt(address, value)
+}
@@ -0,0 +1,254 @@
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func createMmc3(t *testing.T, headerBytes ...byte) *memory.Memory {
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(bankedRom(headerBytes, 0x2000, 0x0400))))
+	return m
+}
+
+// a12 toggles A12 with enough CPU cycles low in between to get past the filter
+func a12(m *memory.Memory) {
+	m.PpuAddress(0x0000)
+	for i := 0; i < 3; i++ {
+		m.Tick()
+	}
+	m.PpuAddress(0x1000)
+}
+
+func TestMmc3Prg(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x04, 0x01, 0x40)
+	assert.IsType(t, &memory.Mmc3{}, m.Cart())
+
+	m.WriteByteAt(0x8000, 0x06)
+	m.WriteByteAt(0x8001, 0x02)
+	m.WriteByteAt(0x8000, 0x07)
+	m.WriteByteAt(0x8001, 0x03)
+	assert.Equal(t, byte(2), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(3), m.ReadByteAt(0xA000))
+	assert.Equal(t, byte(6), m.ReadByteAt(0xC000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xE000))
+
+	// PRG mode 1 swaps $8000 and $C000
+	m.WriteByteAt(0x8000, 0x40)
+	assert.Equal(t, byte(6), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(3), m.ReadByteAt(0xA000))
+	assert.Equal(t, byte(2), m.ReadByteAt(0xC000))
+	assert.Equal(t, byte(7), m.ReadByteAt(0xE000))
+	assert.Equal(t, 2*0x2000+0x10, m.Cart().(memory.RomMapper).PrgOffset(0xC010))
+	assert.NoError(t, m.Err())
+}
+
+func TestMmc3Chr(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x04, 0x40)
+	cart := m.Cart().(memory.ChrCart)
+	for i, bank := range []byte{0x03, 0x08, 0x10, 0x11, 0x12, 0x13} {
+		m.WriteByteAt(0x8000, byte(i))
+		m.WriteByteAt(0x8001, bank)
+	}
+
+	// R0 and R1 are 2KB banks ignoring the low bit
+	expect := []byte{0x02, 0x03, 0x08, 0x09, 0x10, 0x11, 0x12, 0x13}
+	for i, bank := range expect {
+		assert.Equal(t, bank, cart.ReadChr(uint16(i)*0x400), "%d", i)
+	}
+	assert.Equal(t, 0x12*0x400+0x10, m.Cart().(memory.RomMapper).ChrOffset(0x1810))
+
+	// Inverted the 1KB banks are first
+	m.WriteByteAt(0x8000, 0x80)
+	for i, bank := range expect {
+		assert.Equal(t, bank, cart.ReadChr(uint16(i^4)*0x400), "%d", i)
+	}
+
+	// From the header until it's written
+	assert.Equal(t, memory.MirrorTypeHorizontal, cart.Mirroring())
+	m.WriteByteAt(0xA000, 0x00)
+	assert.Equal(t, memory.MirrorTypeVertical, cart.Mirroring())
+	assert.Equal(t, 1, m.Cart().(memory.NametableMapper).Nametable(1))
+	m.WriteByteAt(0xA000, 0x01)
+	assert.Equal(t, memory.MirrorTypeHorizontal, cart.Mirroring())
+	assert.Equal(t, 1, m.Cart().(memory.NametableMapper).Nametable(2))
+}
+
+func TestMmc3PrgRam(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x00, 0x42)
+	m.WriteByteAt(0x6000, 0x11)
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0x6000))
+	assert.Equal(t, byte(0x11), m.SaveRam()[0])
+
+	// Write protected
+	m.WriteByteAt(0xA001, 0xC0)
+	m.WriteByteAt(0x6000, 0x22)
+	assert.Error(t, m.Err())
+	m.ClearErr()
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0x6000))
+
+	// Disabled
+	m.WriteByteAt(0xA001, 0x00)
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x6000))
+	assert.Error(t, m.Err())
+
+	// CHR RAM
+	cart := m.Cart().(memory.ChrCart)
+	cart.WriteChr(0x1234, 0x99)
+	assert.Equal(t, byte(0x99), cart.ReadChr(0x1234))
+}
+
+func TestMmc3Irq(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x01, 0x40)
+	irq := m.Cart().(memory.IrqCart)
+	m.WriteByteAt(0xC000, 0x02)
+	m.WriteByteAt(0xC001, 0x00)
+	m.WriteByteAt(0xE001, 0x00)
+
+	// Reload to 2, then 1, then 0
+	a12(m)
+	a12(m)
+	assert.False(t, irq.Irq())
+	a12(m)
+	assert.True(t, m.CartIrq())
+
+	// Acknowledged
+	m.WriteByteAt(0xE000, 0x00)
+	assert.False(t, irq.Irq())
+	m.WriteByteAt(0xE001, 0x00)
+	a12(m)
+	a12(m)
+	assert.False(t, irq.Irq())
+
+	// Rises without A12 low for long enough are filtered out
+	for i := 0; i < 4; i++ {
+		m.PpuAddress(0x0000)
+		m.Tick()
+		m.PpuAddress(0x1000)
+	}
+	assert.False(t, irq.Irq())
+	a12(m)
+	assert.True(t, irq.Irq())
+
+	// A latch of 0 fires on every clock
+	m.WriteByteAt(0xE000, 0x00)
+	m.WriteByteAt(0xE001, 0x00)
+	m.WriteByteAt(0xC000, 0x00)
+	m.WriteByteAt(0xC001, 0x00)
+	a12(m)
+	assert.True(t, irq.Irq())
+	m.WriteByteAt(0xE000, 0x00)
+	m.WriteByteAt(0xE001, 0x00)
+	a12(m)
+	assert.True(t, irq.Irq())
+}
+
+func TestMmc3OldIrq(t *testing.T) {
+	t.Parallel()
+
+	// NES 2.0 submapper 4 is the MMC3A
+	m := createMmc3(t, 0x02, 0x01, 0x40, 0x08, 0x40)
+	irq := m.Cart().(memory.IrqCart)
+	m.WriteByteAt(0xC000, 0x00)
+	m.WriteByteAt(0xC001, 0x00)
+	m.WriteByteAt(0xE001, 0x00)
+
+	// Reloading fires but reloading 0 again doesn't
+	a12(m)
+	assert.True(t, irq.Irq())
+	m.WriteByteAt(0xE000, 0x00)
+	m.WriteByteAt(0xE001, 0x00)
+	a12(m)
+	assert.False(t, irq.Irq())
+}
+
+func TestMmc6(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x01, 0x42, 0x08, 0x10)
+	cart := m.Cart().(*memory.Mmc3)
+	assert.Len(t, cart.PrgRam, 0x400)
+
+	// Off until enabled in $8000 and $A001
+	m.WriteByteAt(0x7000, 0x11)
+	assert.Error(t, m.Err())
+	m.ClearErr()
+	m.WriteByteAt(0x8000, 0x20)
+	m.WriteByteAt(0xA001, 0x30)
+	m.WriteByteAt(0x7000, 0x11)
+	m.WriteByteAt(0x7C00, 0x22)
+	assert.NoError(t, m.Err())
+	assert.Equal(t, byte(0x22), m.ReadByteAt(0x7000))
+	assert.Equal(t, byte(0x22), cart.PrgRam[0])
+
+	// The upper half is disabled so it reads 0
+	m.WriteByteAt(0x7200, 0x33)
+	assert.Error(t, m.Err())
+	m.ClearErr()
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x7200))
+	assert.NoError(t, m.Err())
+
+	// Read only
+	m.WriteByteAt(0xA001, 0x20)
+	m.WriteByteAt(0x7000, 0x44)
+	assert.Equal(t, byte(0x22), m.ReadByteAt(0x7000))
+	m.ClearErr()
+	m.ReadByteAt(0x6000)
+	assert.Error(t, m.Err())
+}
+
+func TestTxsrom(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x04, 0x61, 0x70)
+	cart := m.Cart().(memory.NametableMapper)
+	m.WriteByteAt(0x8000, 0x00)
+	m.WriteByteAt(0x8001, 0x80)
+	m.WriteByteAt(0x8000, 0x01)
+	m.WriteByteAt(0x8001, 0x02)
+	assert.Equal(t, []int{1, 1, 0, 0}, []int{
+		cart.Nametable(0), cart.Nametable(1), cart.Nametable(2), cart.Nametable(3),
+	})
+
+	// The mirroring register does nothing
+	m.WriteByteAt(0xA000, 0x01)
+	assert.Equal(t, 1, cart.Nametable(1))
+
+	// Inverted R2 to R5 have one each
+	m.WriteByteAt(0x8000, 0x83)
+	m.WriteByteAt(0x8001, 0x80)
+	assert.Equal(t, []int{0, 1, 0, 0}, []int{
+		cart.Nametable(0), cart.Nametable(1), cart.Nametable(2), cart.Nametable(3),
+	})
+}
+
+func TestTqrom(t *testing.T) {
+	t.Parallel()
+
+	m := createMmc3(t, 0x02, 0x02, 0x70, 0x70)
+	cart := m.Cart().(memory.ChrCart)
+	m.WriteByteAt(0x8000, 0x02)
+	m.WriteByteAt(0x8001, 0x05)
+	m.WriteByteAt(0x8000, 0x03)
+	m.WriteByteAt(0x8001, 0x41)
+
+	assert.Equal(t, byte(0x05), cart.ReadChr(0x1000))
+	cart.WriteChr(0x1000, 0xFF)
+	assert.Equal(t, byte(0x05), cart.ReadChr(0x1000))
+
+	cart.WriteChr(0x1400, 0xAA)
+	assert.Equal(t, byte(0xAA), cart.ReadChr(0x1400))
+	assert.Equal(t, byte(0xAA), m.Cart().(*memory.Mmc3).ChrRam[0x400])
+	assert.Equal(t, -1, m.Cart().(memory.RomMapper).ChrOffset(0x1400))
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"github.com/pkg/errors"
+)
+
+// NRom is mapper 0, 16KB of PRG mirrored at $8000 and $C000 or 32KB mapped
+// straight through, and 8KB of CHR ROM or RAM
+// https://wiki.nesdev.com/w/index.php/NROM
+type NRom struct {
+	Prg []byte
+	Chr []byte
+	// PrgRam is at $6000-$7FFF mirrored to fill it, empty when the cart has
+	// none
+	PrgRam    []byte
+	battery   bool
+	chrRam    bool
+	mirroring MirrorType
+}
+
+func createNRom(header *Header) (Cart, error) {
+	if header.PrgRomSize == 0 || header.PrgRomSize > 2*PrgBankSize {
+		return nil, errors.Wrapf(ErrInvalidRom, "NROM can't have %d bytes of PRG", header.PrgRomSize)
+	}
+
+	result := &NRom{
+		PrgRam:    make([]byte, header.PrgRamSize+header.PrgNvramSize),
+		battery:   header.PrgNvramSize > 0,
+		mirroring: header.Mirroring,
+	}
+	if header.ChrRomSize == 0 {
+		result.Chr = make([]byte, ChrBankSize)
+		result.chrRam = true
+	}
+
+	return result, nil
+}
+
+func (c *NRom) SaveRam() []byte {
+	if !c.battery {
+		return nil
+	}
+	return c.PrgRam
+}
+
+func (c *NRom) WriteBytesPrg(value []byte) error {
+	c.Prg = append(c.Prg, value...)
+	return nil
+}
+
+func (c *NRom) WriteBytesChr(value []byte) error {
+	if c.chrRam {
+		return nil
+	}
+	c.Chr = append(c.Chr, value...)
+	return nil
+}
+
+func (c *NRom) WriteByteAt(address uint16, value byte) error {
+	switch {
+	// PRG ram
+	case address >= 0x6000 && address <= 0x7FFF && len(c.PrgRam) > 0:
+		c.PrgRam[int(address-0x6000)%len(c.PrgRam)] = value
+	// Writes to ROM go nowhere
+	case address >= 0x8000:
+	default:
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (c *NRom) ReadByteAt(address uint16) (byte, error) {
+	switch {
+	// PRG ram
+	case address >= 0x6000 && address <= 0x7FFF && len(c.PrgRam) > 0:
+		return c.PrgRam[int(address-0x6000)%len(c.PrgRam)], nil
+	case address >= 0x8000:
+		return c.Prg[c.PrgOffset(address)], nil
+	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+}
+
+func (c *NRom) PeekByteAt(address uint16) (byte, error) {
+	return c.ReadByteAt(address)
+}
+
+// PokeByteAt is WriteByteAt but it patches the ROM
+func (c *NRom) PokeByteAt(address uint16, value byte) error {
+	if address >= 0x8000 {
+		c.Prg[c.PrgOffset(address)] = value
+		return nil
+	}
+	return c.WriteByteAt(address, value)
+}
+
+func (c *NRom) ReadChr(address uint16) byte {
+	return c.Chr[int(address)%len(c.Chr)]
+}
+
+func (c *NRom) WriteChr(address uint16, value byte) {
+	if c.chrRam {
+		c.Chr[int(address)%len(c.Chr)] = value
+	}
+}
+
+func (c *NRom) Mirroring() MirrorType {
+	return c.mirroring
+}
+
+func (c *NRom) PrgOffset(address uint16) int {
+	if address >= 0x8000 && len(c.Prg) > 0 {
+		return int(address-0x8000) % len(c.Prg)
+	}
+
+	return -1
+}
+
+// ChrOffset is -1 for CHR RAM, it's not in the ROM
+func (c *NRom) ChrOffset(address uint16) int {
+	if address < 0x2000 && !c.chrRam && len(c.Chr) > 0 {
+		return int(address) % len(c.Chr)
+	}
+
+	return -1
+}
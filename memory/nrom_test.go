@@ -0,0 +1,110 @@
+package memory_test
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"testing"
+
+	"github.com/sardap/gos/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func nromFile(headerBytes ...byte) []byte {
+	rom := header(headerBytes...)
+	rom = append(rom, make([]byte, memory.PrgBankSize)...)
+	return append(rom, make([]byte, memory.ChrBankSize)...)
+}
+
+func TestPrgRam(t *testing.T) {
+	t.Parallel()
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(nromFile(0x01, 0x01, 0x02))))
+	m.WriteByteAt(0x6000, 0x12)
+	m.WriteByteAt(0x7FFF, 0x34)
+	assert.NoError(t, m.Err())
+	assert.Equal(t, byte(0x12), m.ReadByteAt(0x6000))
+	assert.Equal(t, byte(0x34), m.ReadByteAt(0x7FFF))
+	// The program is left alone
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0xBFFF))
+
+	save := m.SaveRam()
+	assert.Len(t, save, 0x2000)
+	assert.Equal(t, byte(0x12), save[0])
+
+	// Without a battery it's still there but there's nothing to save
+	m = createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(nromFile(0x01, 0x01))))
+	m.WriteByteAt(0x6000, 0x12)
+	assert.Equal(t, byte(0x12), m.ReadByteAt(0x6000))
+	assert.Nil(t, m.SaveRam())
+
+	// NES 2.0 can say there's none at all
+	m = createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(nromFile(0x01, 0x01, 0x00, 0x08))))
+	m.WriteByteAt(0x6000, 0x12)
+	m.ClearErr()
+	// Open bus, still the value written
+	assert.Equal(t, byte(0x12), m.ReadByteAt(0x6000))
+	assert.Error(t, m.Err())
+	assert.Equal(t, byte(0x00), m.ReadByteAt(0x8000))
+	assert.Nil(t, m.SaveRam())
+
+	m.SetCart(nil)
+	assert.Nil(t, m.SaveRam())
+}
+
+func TestNRom(t *testing.T) {
+	t.Parallel()
+
+	rom := nromFile(0x01, 0x00)
+	rom[memory.HeaderSize] = 0x11
+	rom[memory.HeaderSize+memory.PrgBankSize-1] = 0x22
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0xC000))
+	assert.Equal(t, byte(0x22), m.ReadByteAt(0xFFFF))
+
+	// ROM ignores writes but poking patches it
+	m.WriteByteAt(0x8000, 0x33)
+	assert.NoError(t, m.Err())
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0xC000))
+	assert.NoError(t, m.PokeByteAt(0xC000, 0x33))
+	assert.Equal(t, byte(0x33), m.ReadByteAt(0x8000))
+
+	// No CHR ROM is 8KB of CHR RAM
+	cart := m.Cart().(memory.ChrCart)
+	cart.WriteChr(0x1FFF, 0x44)
+	assert.Equal(t, byte(0x44), cart.ReadChr(0x1FFF))
+	assert.Equal(t, -1, m.Cart().(memory.RomMapper).ChrOffset(0x1FFF))
+}
+
+func TestNRom256(t *testing.T) {
+	t.Parallel()
+
+	rom := header(0x02, 0x01)
+	prg := make([]byte, 2*memory.PrgBankSize)
+	prg[0] = 0x11
+	prg[memory.PrgBankSize] = 0x22
+	rom = append(rom, prg...)
+	chr := make([]byte, memory.ChrBankSize)
+	chr[0x10] = 0x55
+	rom = append(rom, chr...)
+
+	m := createMemory()
+	assert.NoError(t, m.LoadRom(bytes.NewReader(rom)))
+	assert.Equal(t, byte(0x11), m.ReadByteAt(0x8000))
+	assert.Equal(t, byte(0x22), m.ReadByteAt(0xC000))
+	assert.Equal(t, 0x4000, m.Cart().(memory.RomMapper).PrgOffset(0xC000))
+
+	cart := m.Cart().(memory.ChrCart)
+	cart.WriteChr(0x0010, 0x44)
+	assert.Equal(t, byte(0x55), cart.ReadChr(0x0010))
+	assert.Equal(t, 0x10, m.Cart().(memory.RomMapper).ChrOffset(0x0010))
+
+	err := m.LoadRom(bytes.NewReader(header(0x03, 0x01)))
+	assert.True(t, errors.Is(err, memory.ErrInvalidRom))
+}
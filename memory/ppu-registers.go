@@ -1,8 +1,6 @@
 package memory
 
 import (
-	"encoding/binary"
-
 	"github.com/pkg/errors"
 
 	nesmath "github.com/sardap/gos/math"
@@ -76,9 +74,14 @@ type PpuRegisters struct {
 	Scroll     *PpuRegister // 0x2005
 	Address    *PpuRegister // 0x2006
 	Data       *PpuRegister // 0x2007
+	// Oam is the sprite memory, $2004 and DMA write to it at OamAddress
+	Oam [0x100]byte
 
 	pendingWrites []PpuWrite
 	addressLatch  byte
+	// latch is the last value on the PPU's data bus, reading a write only
+	// register returns it
+	latch byte
 }
 
 func CreatePpuRegisters() *PpuRegisters {
@@ -94,15 +97,44 @@ func CreatePpuRegisters() *PpuRegisters {
 	}
 }
 
+func (p *PpuRegisters) PowerOn() {
+	p.Ctrl.Write(0)
+	p.Mask.Write(0)
+	p.Status.Write(0)
+	p.OamAddress.Write(0)
+	p.OamData.Write(0)
+	p.Scroll.Write(0)
+	p.Address.Write(0)
+	p.Data.Write(0)
+	p.Oam = [0x100]byte{}
+	p.addressLatch = 0
+	p.latch = 0
+	p.pendingWrites = nil
+}
+
+// Reset only touches the registers the PPU reset line clears
+// https://wiki.nesdev.com/w/index.php/PPU_power_up_state
+func (p *PpuRegisters) Reset() {
+	p.Ctrl.Write(0)
+	p.Mask.Write(0)
+	p.Scroll.Write(0)
+	p.Data.Write(0)
+	p.addressLatch = 0
+}
+
 func (p *PpuRegisters) GetPendingWrites() []PpuWrite {
 	return p.pendingWrites
 }
 
+// ClearPendingWrites keeps the backing array so the next frame's writes
+// don't allocate
 func (p *PpuRegisters) ClearPendingWrites() {
-	p.pendingWrites = nil
+	p.pendingWrites = p.pendingWrites[:0]
 }
 
-func (p *PpuRegisters) WriteByteAt(address uint16, value byte) {
+func (p *PpuRegisters) WriteByteAt(address uint16, value byte) error {
+	p.latch = value
+
 	switch address {
 	case 0x2000:
 		p.Ctrl.Write(value)
@@ -112,32 +144,59 @@ func (p *PpuRegisters) WriteByteAt(address uint16, value byte) {
 		p.OamAddress.Write(value)
 	case 0x2004:
 		p.OamData.Write(value)
+		p.Oam[p.OamAddress.Read()] = value
+		p.OamAddress.Write(p.OamAddress.Read() + 1)
 	case 0x2005:
 		p.Scroll.Write(value)
 	case 0x2006:
 		p.addressLatch = p.Address.Read()
 		p.Address.Write(value)
 	case 0x2007:
-		address := binary.LittleEndian.Uint16([]byte{p.addressLatch, p.Address.Read()})
+		// The high byte is written first
+		address := uint16(p.addressLatch)<<8&0x3F00 | uint16(p.Address.Read())
 		p.Data.Write(value)
 		p.pendingWrites = append(p.pendingWrites, PpuWrite{
 			Address: address,
 			Value:   value,
 		})
+
+		// Across a row or down a column of the nametable
+		if p.Ctrl.BitSet(PpuFlagCtrlVramAddress) {
+			address += 32
+		} else {
+			address++
+		}
+		p.addressLatch = byte(address >> 8)
+		p.Address.Write(byte(address))
 	default:
-		panic(errors.Wrapf(ErrInvalidAddress, "0x%04X", address))
+		return errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
+	}
+
+	return nil
+}
+
+func (p *PpuRegisters) ReadByteAt(address uint16) (byte, error) {
+	value, err := p.PeekByteAt(address)
+	if err == nil {
+		p.latch = value
 	}
+
+	return value, err
 }
 
-func (p *PpuRegisters) ReadByteAt(address uint16) byte {
+// PeekByteAt is ReadByteAt without any side effects
+func (p *PpuRegisters) PeekByteAt(address uint16) (byte, error) {
 	switch address {
 	case 0x2002:
-		return p.Status.Read()
+		// Only the flags are driven, the rest is whatever was on the bus
+		return p.Status.Read()&0xE0 | p.latch&0x1F, nil
 	case 0x2004:
-		return p.OamData.Read()
+		return p.Oam[p.OamAddress.Read()], nil
 	case 0x2007:
-		return p.Data.Read()
-	default:
-		panic(errors.Wrapf(ErrInvalidAddress, "0x%04X", address))
+		return p.Data.Read(), nil
+	case 0x2000, 0x2001, 0x2003, 0x2005, 0x2006:
+		return p.latch, nil
 	}
+
+	return 0, errors.Wrapf(ErrInvalidAddress, "0x%04X", address)
 }
@@ -10,88 +10,275 @@ var (
 	ErrInvalidAddress = fmt.Errorf("invalid ppu address")
 )
 
+const (
+	DotsPerScanline   = 341
+	ScanlinesPerFrame = 262
+)
+
+// Ppu only fetches what rendering would, nothing is drawn yet. Scrolling isn't
+// done either so the background comes straight from the PPUCTRL nametable.
 type Ppu struct {
-	PatternTable0 [0x1000]byte // 0x0000 - 0x0FFF
-	PatternTable1 [0x1000]byte // 0x1000 - 0x1FFF
-	NameTable0    [0x0400]byte // 0x2000 - 0x23FF
-	NameTable1    [0x0400]byte // 0x2400 - 0x27FF
-	NameTable2    [0x0400]byte // 0x2800 - 0x2BFF
-	NameTable3    [0x0400]byte // 0x2C00 - 0x2FFF
+	// Ciram is the two 1KB nametables the cart mirrors into 0x2000 - 0x2FFF
+	Ciram [0x0800]byte
+	// FourScreenRam is the extra two nametables of four screen carts
+	FourScreenRam [0x0800]byte
 	PalRam        [0x0020]byte // 0x3F00 - 0x3F1F
+	Dot           int
+	Scanline      int
+	Frame         int
+
+	// Registers are the CPU side of the PPU, rendering follows PPUCTRL and
+	// PPUMASK
+	Registers *memory.PpuRegisters
+	// Watch sees the addresses the PPU puts on its bus for $2007
+	Watch func(address uint16)
+	// Fetch reads the pattern tables for rendering, the cart sees the fetch
+	// and can switch banks on it
+	Fetch func(address uint16) byte
+	// ReadChr and WriteChr are the cart's pattern tables at $0000-$1FFF,
+	// without them they read 0 and ignore writes
+	ReadChr  func(address uint16) byte
+	WriteChr func(address uint16, value byte)
+	// Nametable is the cart picking which 1KB page nametable index is shown
+	// from, 0 and 1 are Ciram and 2 and 3 FourScreenRam. Without it the
+	// nametables are mirrored vertically.
+	Nametable func(index int) int
+
+	sprites     [8]sprite
+	spriteCount int
+}
+
+// sprite is one found by sprite evaluation for the next line
+type sprite struct {
+	tile byte
+	// row is the row of the sprite the line is, already flipped
+	row byte
 }
 
 func Create() *Ppu {
 	return &Ppu{}
 }
 
-func (p *Ppu) Step(pendingWrites []memory.PpuWrite) {
+func (p *Ppu) Step(pendingWrites []memory.PpuWrite) error {
 	for _, write := range pendingWrites {
-		p.WriteByteAt(write.Address, write.Value)
+		if p.Watch != nil {
+			p.Watch(write.Address)
+		}
+		if err := p.WriteByteAt(write.Address, write.Value); err != nil {
+			return &memory.BusError{
+				Subsystem: memory.SubsystemPpu,
+				Address:   write.Address,
+				Write:     true,
+				Err:       err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// rendering is the background or sprites being shown, the PPU only fetches
+// then
+func (p *Ppu) rendering() bool {
+	mask := p.Registers.Mask
+	return mask.BitSet(memory.PpuFlagMaskShowBackground) || mask.BitSet(memory.PpuFlagMaskShowSprites)
+}
+
+// nametable is one of the four nametables from $2000 after the cart's
+// mirroring
+func (p *Ppu) nametable(index int) []byte {
+	index &= 0x03
+	page := memory.MirrorTypeVertical.Nametable(index)
+	if p.Nametable != nil {
+		page = p.Nametable(index)
+	}
+
+	ram := p.Ciram[:]
+	if page >= 2 {
+		ram = p.FourScreenRam[:]
 	}
+	start := (page & 0x01) * 0x0400
+	return ram[start : start+0x0400]
 }
 
-func (p *Ppu) WriteByteAt(address uint16, value byte) {
+// backgroundAddress is the pattern row of the tile being fetched at dot, the
+// nametable is looked up through the cart's mirroring
+func (p *Ppu) backgroundAddress(dot int) uint16 {
+	line := p.Scanline
+	column := (dot-1)/8 + 2
+	// The first two tiles of the next line are fetched at the end of this one
+	if dot > 320 {
+		line = (line + 1) % ScanlinesPerFrame
+		column = (dot - 321) / 8
+	}
+	if line >= 240 {
+		line = 0
+	}
+
+	ctrl := p.Registers.Ctrl
+	index := int(ctrl.NameTableAddress())
+	if column >= 32 {
+		index ^= 1
+		column -= 32
+	}
+	tile := p.nametable(index)[line/8*32+column]
+
+	var table uint16
+	if ctrl.BitSet(memory.PpuFlagCtrlBackgroundAddress) {
+		table = 0x1000
+	}
+	return table | uint16(tile)<<4 | uint16(line&0x07)
+}
+
+// evaluateSprites finds the first 8 sprites on the next line
+func (p *Ppu) evaluateSprites() {
+	p.spriteCount = 0
+	if p.Scanline >= 240 {
+		return
+	}
+
+	height := 8
+	if p.Registers.Ctrl.BitSet(memory.PpuFlagCtrlSpirteSize) {
+		height = 16
+	}
+	oam := &p.Registers.Oam
+	for i := 0; i < len(oam) && p.spriteCount < len(p.sprites); i += 4 {
+		row := p.Scanline - int(oam[i])
+		if row < 0 || row >= height {
+			continue
+		}
+		// Flipped vertically
+		if oam[i+2]&0x80 != 0 {
+			row = height - 1 - row
+		}
+		p.sprites[p.spriteCount] = sprite{tile: oam[i+1], row: byte(row)}
+		p.spriteCount++
+	}
+}
+
+// spriteAddress is the pattern row of the sprite in slot, empty slots fetch
+// tile $FF
+func (p *Ppu) spriteAddress(slot int) uint16 {
+	ctrl := p.Registers.Ctrl
+	tall := ctrl.BitSet(memory.PpuFlagCtrlSpirteSize)
+	s := sprite{tile: 0xFF}
+	if slot < p.spriteCount {
+		s = p.sprites[slot]
+	}
+
+	if !tall {
+		var table uint16
+		if ctrl.BitSet(memory.PpuFlagCtrlSpirtePatternTable) {
+			table = 0x1000
+		}
+		return table | uint16(s.tile)<<4 | uint16(s.row)
+	}
+
+	// 8x16 sprites take the table from bit 0 of the tile
+	tile := uint16(s.tile&0xFE) + uint16(s.row>>3)
+	return uint16(s.tile&0x01)<<12 | tile<<4 | uint16(s.row&0x07)
+}
+
+// fetch reads the pattern tables the way rendering does, the background's
+// low and high planes on dots 5 and 7 of every 8 and the sprites for the
+// next line from dot 257. Nothing is drawn yet but carts like MMC2 and MMC3
+// watch the fetches.
+func (p *Ppu) fetch() {
+	if p.Fetch == nil || p.Registers == nil || !p.rendering() {
+		return
+	}
+	if p.Scanline >= 240 && p.Scanline != ScanlinesPerFrame-1 {
+		return
+	}
+
+	dot := p.Dot
+	if dot == 257 {
+		p.evaluateSprites()
+	}
+	plane := dot & 0x07
+	if dot == 0 || dot > 336 || plane != 5 && plane != 7 {
+		return
+	}
+
+	var address uint16
+	if dot > 256 && dot <= 320 {
+		address = p.spriteAddress((dot - 257) / 8)
+	} else {
+		address = p.backgroundAddress(dot)
+	}
+	if plane == 7 {
+		address += 8
+	}
+	p.Fetch(address)
+}
+
+// Tick advances one dot, the PPU runs three dots per CPU cycle
+func (p *Ppu) Tick() {
+	p.Dot++
+	if p.Dot >= DotsPerScanline {
+		p.Dot = 0
+		p.Scanline++
+		if p.Scanline >= ScanlinesPerFrame {
+			p.Scanline = 0
+			p.Frame++
+		}
+	}
+
+	p.fetch()
+}
+
+// Position is where the PPU is for CPU traces
+func (p *Ppu) Position() (dot, scanline, frame int) {
+	return p.Dot, p.Scanline, p.Frame
+}
+
+func (p *Ppu) WriteByteAt(address uint16, value byte) error {
 	switch address & 0xF000 {
-	case 0x0000:
-		p.PatternTable0[address] = value
-	case 0x1000:
-		p.PatternTable1[address-0x1000] = value
-	case 0x2000:
-		switch address & 0x0F00 {
-		case 0x0000, 0x0100, 0x0200, 0x0300:
-			p.NameTable0[address-0x2000] = value
-		case 0x0400, 0x0500, 0x0600, 0x0700:
-			p.NameTable1[address-0x2400] = value
-		case 0x0800, 0x0900, 0x0A00, 0x0B00:
-			p.NameTable2[address-0x2800] = value
-		case 0x0C00, 0x0D00, 0x0E00, 0x0F00:
-			p.NameTable3[address-0x2C00] = value
+	case 0x0000, 0x1000:
+		if p.WriteChr != nil {
+			p.WriteChr(address, value)
 		}
+	case 0x2000:
+		p.nametable(int(address >> 10))[address&0x03FF] = value
 	case 0x3000:
 		switch {
 		// Mirror of 0x2000 - 0x2EFF
 		case address >= 0x3000 && address <= 0x3EFF:
-			p.WriteByteAt(address-0x1000, value)
+			return p.WriteByteAt(address-0x1000, value)
 		case address >= 0x3F00 && address <= 0x3F1F:
 			p.PalRam[address-0x3F00] = value
 		// Mirror of 0x3F00 - 0x3F1F
 		case address >= 0x3F20 && address <= 0x3FFF:
-			p.WriteByteAt(address-0x0020, value)
+			return p.WriteByteAt(address-0x0020, value)
 		}
 	default:
-		panic(ErrInvalidAddress)
+		return ErrInvalidAddress
 	}
+
+	return nil
 }
 
-func (p *Ppu) ReadByteAt(address uint16) byte {
+func (p *Ppu) ReadByteAt(address uint16) (byte, error) {
 	switch address & 0xF000 {
-	case 0x0000:
-		return p.PatternTable0[address]
-	case 0x1000:
-		return p.PatternTable1[address-0x1000]
-	case 0x2000:
-		switch address & 0x0F00 {
-		case 0x0000, 0x0100, 0x0200, 0x0300:
-			return p.NameTable0[address-0x2000]
-		case 0x0400, 0x0500, 0x0600, 0x0700:
-			return p.NameTable1[address-0x2400]
-		case 0x0800, 0x0900, 0x0A00, 0x0B00:
-			return p.NameTable2[address-0x2800]
-		case 0x0C00, 0x0D00, 0x0E00, 0x0F00:
-			return p.NameTable3[address-0x2C00]
+	case 0x0000, 0x1000:
+		if p.ReadChr == nil {
+			return 0, nil
 		}
+		return p.ReadChr(address), nil
+	case 0x2000:
+		return p.nametable(int(address >> 10))[address&0x03FF], nil
 	case 0x3000:
 		switch {
 		// Mirror of 0x2000 - 0x2EFF
 		case address >= 0x3000 && address <= 0x3EFF:
 			return p.ReadByteAt(address - 0x1000)
 		case address >= 0x3F00 && address <= 0x3F1F:
-			return p.PalRam[address-0x3F00]
+			return p.PalRam[address-0x3F00], nil
 		// Mirror of 0x3F00 - 0x3F1F
 		case address >= 0x3F20 && address <= 0x3FFF:
 			return p.ReadByteAt(address - 0x0020)
 		}
 	}
 
-	panic(ErrInvalidAddress)
+	return 0, ErrInvalidAddress
 }
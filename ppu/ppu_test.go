@@ -3,6 +3,7 @@ package ppu_test
 import (
 	"testing"
 
+	"github.com/sardap/gos/memory"
 	"github.com/sardap/gos/ppu"
 	"github.com/stretchr/testify/assert"
 )
@@ -11,45 +12,211 @@ func createPpu() *ppu.Ppu {
 	return &ppu.Ppu{}
 }
 
+func read(t *testing.T, p *ppu.Ppu, address uint16) byte {
+	value, err := p.ReadByteAt(address)
+	assert.NoError(t, err)
+	return value
+}
+
 func TestPpuMirroing(t *testing.T) {
 	t.Parallel()
 
 	p := createPpu()
 
-	// Name tables
-	for i := uint16(0x2000); i < 0x2EFF; i++ {
-		assert.Equalf(t, byte(0), p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, byte(0), p.ReadByteAt(i+0x1000), "%04X", i)
+	// Name tables, $2800 and $2C00 mirror $2000 and $2400 without a cart
+	for i := uint16(0x2000); i < 0x27FF; i++ {
+		assert.Equalf(t, byte(0), read(t, p, i), "%04X", i)
+		assert.Equalf(t, byte(0), read(t, p, i+0x1000), "%04X", i)
 
 		value := byte(0x10)
-		p.WriteByteAt(i, value)
+		assert.NoError(t, p.WriteByteAt(i, value))
 
-		assert.Equalf(t, value, p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, value, p.ReadByteAt(i+0x1000), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i+0x1000), "%04X", i)
 
 		value = byte(0x15)
-		p.WriteByteAt(i+0x1000, value)
+		assert.NoError(t, p.WriteByteAt(i+0x1000, value))
 
-		assert.Equalf(t, value, p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, value, p.ReadByteAt(i+0x1000), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i+0x1000), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i+0x0800), "%04X", i)
 	}
 
 	// PaltteeRam
 	for i := uint16(0x3F00); i < 0x3F1F; i++ {
-		assert.Equalf(t, byte(0), p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, byte(0), p.ReadByteAt(i+0x020), "%04X", i)
+		assert.Equalf(t, byte(0), read(t, p, i), "%04X", i)
+		assert.Equalf(t, byte(0), read(t, p, i+0x020), "%04X", i)
 
 		value := byte(0x20)
-		p.WriteByteAt(i, value)
+		assert.NoError(t, p.WriteByteAt(i, value))
 
-		assert.Equalf(t, value, p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, value, p.ReadByteAt(i+0x020), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i+0x020), "%04X", i)
 
 		value = byte(0x25)
-		p.WriteByteAt(i+0x020, value)
+		assert.NoError(t, p.WriteByteAt(i+0x020, value))
+
+		assert.Equalf(t, value, read(t, p, i), "%04X", i)
+		assert.Equalf(t, value, read(t, p, i+0x020), "%04X", i)
+
+	}
+}
+
+func TestNametableMirroring(t *testing.T) {
+	t.Parallel()
+
+	fourScreen := func(index int) int {
+		return index
+	}
+	testCases := []struct {
+		name      string
+		nametable func(index int) int
+		shown     [4]bool
+	}{
+		{"vertical", memory.MirrorTypeVertical.Nametable, [4]bool{false, true, false, true}},
+		{"horizontal", memory.MirrorTypeHorizontal.Nametable, [4]bool{false, false, true, true}},
+		{"single lower", memory.MirrorTypeSingleLower.Nametable, [4]bool{true, true, true, true}},
+		{"single upper", memory.MirrorTypeSingleUpper.Nametable, [4]bool{true, true, true, true}},
+		{"four screen", fourScreen, [4]bool{false, false, false, true}},
+	}
+
+	for _, test := range testCases {
+		p := createPpu()
+		p.Nametable = test.nametable
+		assert.NoError(t, p.WriteByteAt(0x2C10, 0xAB))
+
+		for i, shown := range test.shown {
+			address := 0x2010 + uint16(i)*0x0400
+			expected := byte(0)
+			if shown {
+				expected = 0xAB
+			}
+			assert.Equalf(t, expected, read(t, p, address), "%s %04X", test.name, address)
+		}
+	}
+
+	// A single screen cart shows $2400 at $2000
+	p := createPpu()
+	p.Nametable = memory.MirrorTypeSingleLower.Nametable
+	assert.NoError(t, p.WriteByteAt(0x2400, 0xCD))
+	assert.Equal(t, byte(0xCD), read(t, p, 0x2000))
+	assert.Equal(t, byte(0xCD), p.Ciram[0])
+}
+
+func TestChr(t *testing.T) {
+	t.Parallel()
+
+	p := createPpu()
+	assert.NoError(t, p.WriteByteAt(0x1234, 0x56))
+	assert.Equal(t, byte(0), read(t, p, 0x1234))
+
+	// The pattern tables are the cart's
+	chr := make([]byte, 0x2000)
+	p.ReadChr = func(address uint16) byte {
+		return chr[address]
+	}
+	p.WriteChr = func(address uint16, value byte) {
+		chr[address] = value
+	}
+	assert.NoError(t, p.WriteByteAt(0x1234, 0x56))
+	assert.Equal(t, byte(0x56), chr[0x1234])
+	assert.Equal(t, byte(0x56), read(t, p, 0x1234))
+}
+
+func TestTick(t *testing.T) {
+	t.Parallel()
+
+	p := createPpu()
+
+	for i := 0; i < ppu.DotsPerScanline-1; i++ {
+		p.Tick()
+	}
+	assert.Equal(t, ppu.DotsPerScanline-1, p.Dot)
+	assert.Equal(t, 0, p.Scanline)
+
+	p.Tick()
+	assert.Equal(t, 0, p.Dot)
+	assert.Equal(t, 1, p.Scanline)
+
+	for i := 0; i < ppu.DotsPerScanline*(ppu.ScanlinesPerFrame-1); i++ {
+		p.Tick()
+	}
+	assert.Equal(t, 0, p.Dot)
+	assert.Equal(t, 0, p.Scanline)
+	assert.Equal(t, 1, p.Frame)
+}
+
+func TestInvalidAddress(t *testing.T) {
+	t.Parallel()
+
+	p := createPpu()
+
+	assert.Equal(t, ppu.ErrInvalidAddress, p.WriteByteAt(0x4000, 0))
+	_, err := p.ReadByteAt(0x4000)
+	assert.Equal(t, ppu.ErrInvalidAddress, err)
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	p := createPpu()
+	addresses := []uint16{}
+	p.Watch = func(address uint16) {
+		addresses = append(addresses, address)
+	}
+
+	assert.NoError(t, p.Step([]memory.PpuWrite{{Address: 0x1234, Value: 0x01}}))
+	assert.Equal(t, []uint16{0x1234}, addresses)
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	p := createPpu()
+	p.Registers = memory.CreatePpuRegisters()
+	fetches := map[int][]uint16{}
+	p.Fetch = func(address uint16) byte {
+		fetches[p.Scanline] = append(fetches[p.Scanline], address)
+		return 0
+	}
+	frame := func() {
+		for i := 0; i < ppu.DotsPerScanline*ppu.ScanlinesPerFrame; i++ {
+			p.Tick()
+		}
+	}
 
-		assert.Equalf(t, value, p.ReadByteAt(i), "%04X", i)
-		assert.Equalf(t, value, p.ReadByteAt(i+0x020), "%04X", i)
+	// Nothing is fetched while rendering is off
+	frame()
+	assert.Empty(t, fetches)
 
+	// Background from $0000 and sprites from $1000, one flipped on line $13
+	p.Registers.WriteByteAt(0x2000, 0x08)
+	p.Registers.WriteByteAt(0x2001, 0x18)
+	for i := range p.Registers.Oam {
+		p.Registers.Oam[i] = 0xF0
 	}
+	copy(p.Registers.Oam[:], []byte{0x10, 0x42, 0x80, 0x00})
+	p.Ciram[2*32+5] = 0xFD
+	frame()
+
+	// 34 background tiles and 8 sprites with two planes each
+	assert.Len(t, fetches, 241)
+	assert.Len(t, fetches[0], 84)
+	assert.Len(t, fetches[ppu.ScanlinesPerFrame-1], 84)
+	assert.Equal(t, []uint16{0x0000, 0x0008}, fetches[0][:2])
+
+	// The sprite is fetched on the line before it's shown
+	assert.Equal(t, []uint16{0x1425, 0x142D, 0x1FF0, 0x1FF8}, fetches[0x12][64:68])
+	assert.Equal(t, []uint16{0x1420, 0x1428}, fetches[0x17][64:66])
+	assert.Equal(t, []uint16{0x1FF0, 0x1FF8}, fetches[0x18][64:66])
+
+	// Tile 5 of row 2 is the fourth fetched on its lines
+	assert.Equal(t, []uint16{0x0FD1, 0x0FD9}, fetches[0x11][6:8])
+
+	// With horizontal mirroring the tiles at $2400 are the ones at $2000
+	p.Nametable = memory.MirrorTypeHorizontal.Nametable
+	p.Registers.WriteByteAt(0x2000, 0x09)
+	fetches = map[int][]uint16{}
+	frame()
+	assert.Equal(t, []uint16{0x0FD1, 0x0FD9}, fetches[0x11][6:8])
 }
@@ -0,0 +1,222 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The pprof format is a gzipped protocol buffer
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+
+// protobuf encodes just what profile.proto needs
+type protobuf struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(value uint64) {
+	for value >= 0x80 {
+		b.data = append(b.data, byte(value)|0x80)
+		value >>= 7
+	}
+	b.data = append(b.data, byte(value))
+}
+
+func (b *protobuf) tag(field int, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64 skips zero like proto3 does
+func (b *protobuf) uint64(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.varint(value)
+}
+
+func (b *protobuf) int64(field int, value int64) {
+	b.uint64(field, uint64(value))
+}
+
+func (b *protobuf) bool(field int, value bool) {
+	if value {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protobuf) bytes(field int, value []byte) {
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(value)))
+	b.data = append(b.data, value...)
+}
+
+func (b *protobuf) message(field int, message *protobuf) {
+	b.bytes(field, message.data)
+}
+
+func (b *protobuf) packed(field int, values []uint64) {
+	inner := &protobuf{}
+	for _, value := range values {
+		inner.varint(value)
+	}
+	b.bytes(field, inner.data)
+}
+
+type locationKey struct {
+	routine *routine
+	pc      uint16
+}
+
+type pprofWriter struct {
+	profile   *protobuf
+	strings   map[string]int64
+	functions map[*routine]uint64
+	locations map[locationKey]uint64
+	name      func(r *routine) string
+}
+
+func (w *pprofWriter) string(value string) int64 {
+	if index, ok := w.strings[value]; ok {
+		return index
+	}
+
+	index := int64(len(w.strings))
+	w.strings[value] = index
+	w.profile.bytes(6, []byte(value))
+	return index
+}
+
+func (w *pprofWriter) valueType(field int, kind, unit string) {
+	valueType := &protobuf{}
+	valueType.int64(1, w.string(kind))
+	valueType.int64(2, w.string(unit))
+	w.profile.message(field, valueType)
+}
+
+func (w *pprofWriter) function(r *routine) uint64 {
+	if id, ok := w.functions[r]; ok {
+		return id
+	}
+
+	id := uint64(len(w.functions) + 1)
+	w.functions[r] = id
+
+	name := w.string(w.name(r))
+	function := &protobuf{}
+	function.uint64(1, id)
+	function.int64(2, name)
+	function.int64(3, name)
+	function.int64(5, int64(r.address))
+	w.profile.message(5, function)
+
+	return id
+}
+
+// location is pc inside routine, the line number is the address so pprof
+// can break routines down by instruction
+func (w *pprofWriter) location(r *routine, pc uint16) uint64 {
+	key := locationKey{r, pc}
+	if id, ok := w.locations[key]; ok {
+		return id
+	}
+
+	id := uint64(len(w.locations) + 1)
+	w.locations[key] = id
+
+	line := &protobuf{}
+	line.uint64(1, w.function(r))
+	line.int64(2, int64(pc))
+
+	location := &protobuf{}
+	location.uint64(1, id)
+	location.uint64(2, 1)
+	location.uint64(3, uint64(pc))
+	location.message(4, line)
+	w.profile.message(4, location)
+
+	return id
+}
+
+func (w *pprofWriter) samples(node *callNode) {
+	pcs := make([]int, 0, len(node.cycles))
+	for pc := range node.cycles {
+		pcs = append(pcs, int(pc))
+	}
+	sort.Ints(pcs)
+
+	for _, pc := range pcs {
+		// Leaf first then each call site up to the root
+		locations := []uint64{w.location(node.routine, uint16(pc))}
+		for n := node; n.parent != nil; n = n.parent {
+			locations = append(locations, w.location(n.parent.routine, n.callSite))
+		}
+
+		sample := &protobuf{}
+		sample.packed(1, locations)
+		sample.packed(2, []uint64{uint64(node.cycles[uint16(pc)])})
+		w.profile.message(2, sample)
+	}
+
+	keys := make([]callKey, 0, len(node.children))
+	for key := range node.children {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].callSite != keys[j].callSite {
+			return keys[i].callSite < keys[j].callSite
+		}
+		return keys[i].routine < keys[j].routine
+	})
+	for _, key := range keys {
+		w.samples(node.children[key])
+	}
+}
+
+// WritePprof writes the call graph in pprof's format, go tool pprof shows it
+// like any other CPU profile with cycles in place of time
+func (p *Profiler) WritePprof(w io.Writer) error {
+	writer := &pprofWriter{
+		profile:   &protobuf{},
+		strings:   map[string]int64{},
+		functions: map[*routine]uint64{},
+		locations: map[locationKey]uint64{},
+		name:      p.name,
+	}
+	writer.string("")
+
+	writer.valueType(1, "cycles", "count")
+	writer.valueType(11, "cycles", "count")
+	writer.profile.int64(12, 1)
+
+	mapping := &protobuf{}
+	mapping.uint64(1, 1)
+	mapping.uint64(3, 0x10000)
+	mapping.int64(5, writer.string("6502"))
+	mapping.bool(7, true)
+	mapping.bool(9, true)
+	writer.profile.message(3, mapping)
+
+	roots := make([]int, 0, len(p.roots))
+	for address := range p.roots {
+		roots = append(roots, int(address))
+	}
+	sort.Ints(roots)
+	for _, address := range roots {
+		writer.samples(p.roots[uint16(address)])
+	}
+
+	writer.profile.int64(13, writer.string(fmt.Sprintf("%d frames", p.frames)))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(writer.profile.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
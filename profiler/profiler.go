@@ -0,0 +1,369 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/sardap/gos/cpu"
+)
+
+// Routine is the cycles spent in a subroutine or interrupt handler
+type Routine struct {
+	Address uint16
+	Name    string
+	Calls   int64
+	// Inclusive counts everything it called as well, recursive calls are only
+	// counted once. Exclusive is only its own instructions.
+	Inclusive int64
+	Exclusive int64
+}
+
+type Frame struct {
+	Number int
+	Cycles int64
+	// Routines that ran in the frame, most inclusive cycles first
+	Routines []Routine
+}
+
+type counters struct {
+	calls     int64
+	inclusive int64
+	exclusive int64
+}
+
+func (c *counters) add(other counters) {
+	c.calls += other.calls
+	c.inclusive += other.inclusive
+	c.exclusive += other.exclusive
+}
+
+type routine struct {
+	address uint16
+	// kind is the interrupt the routine was first entered by
+	kind  string
+	total counters
+	frame counters
+	// active is how many times it's on the call stack
+	active int
+}
+
+type callKey struct {
+	callSite uint16
+	routine  uint16
+}
+
+// callNode is a routine reached by a particular chain of calls
+type callNode struct {
+	parent   *callNode
+	routine  *routine
+	callSite uint16
+	children map[callKey]*callNode
+	// cycles is the exclusive cycles by PC
+	cycles map[uint16]int64
+}
+
+type stackFrame struct {
+	node *callNode
+	// sp is the stack pointer before the call, the routine has returned once
+	// SP is back up to it
+	sp byte
+	// owner is false for recursive calls so inclusive cycles are only
+	// counted once
+	owner bool
+}
+
+// Profiler accumulates the cycles the CPU spends on every instruction and
+// follows JSR, RTS, interrupts and RTI to build a call graph
+type Profiler struct {
+	// ByPC is the cycles spent on the instruction at each address
+	ByPC []int64
+	// Names labels routines in reports, anything missing is shown as its
+	// address
+	Names map[uint16]string
+
+	cpu   *cpu.Cpu
+	hooks []cpu.Hook
+	jsr   *cpu.Operation
+	brk   *cpu.Operation
+
+	routines map[uint16]*routine
+	roots    map[uint16]*callNode
+	stack    []stackFrame
+	// sp is the stack pointer before the current instruction
+	sp byte
+	// last is the cpu.Cpu TotalCycles already accounted for
+	last int64
+
+	frames      int
+	frameCycles int64
+	totalCycles int64
+}
+
+func Create() *Profiler {
+	return &Profiler{
+		ByPC:     make([]int64, 0x10000),
+		Names:    map[uint16]string{},
+		routines: map[uint16]*routine{},
+		roots:    map[uint16]*callNode{},
+	}
+}
+
+// SetSymbols names routines after labels, like an assembler.Program's
+// Symbols. Where several share an address the first alphabetically wins.
+func (p *Profiler) SetSymbols(symbols map[string]uint16) {
+	for name, address := range symbols {
+		if current, ok := p.Names[address]; !ok || name < current {
+			p.Names[address] = name
+		}
+	}
+}
+
+// Attach starts profiling c, whatever is running is the root of the call
+// graph until the next reset
+func (p *Profiler) Attach(c *cpu.Cpu) {
+	p.Detach()
+
+	p.cpu = c
+	opcodes := cpu.GetVariantOpcodes(c.Variant())
+	p.jsr = opcodes[0x20]
+	p.brk = opcodes[0x00]
+	p.last = c.TotalCycles
+	p.root(c.Registers.PC, "")
+
+	p.hooks = []cpu.Hook{
+		c.AddBeforeHook(p.before),
+		c.AddAfterHook(p.after),
+		c.AddInterruptHook(p.interrupt),
+	}
+}
+
+func (p *Profiler) Detach() {
+	if p.cpu == nil {
+		return
+	}
+
+	for _, hook := range p.hooks {
+		p.cpu.RemoveHook(hook)
+	}
+	for len(p.stack) > 0 {
+		p.pop()
+	}
+	p.cpu = nil
+	p.hooks = nil
+}
+
+func (p *Profiler) routine(address uint16, kind string) *routine {
+	result, ok := p.routines[address]
+	if !ok {
+		result = &routine{address: address, kind: kind}
+		p.routines[address] = result
+	}
+	return result
+}
+
+func (p *Profiler) root(address uint16, kind string) {
+	for len(p.stack) > 0 {
+		p.pop()
+	}
+
+	node, ok := p.roots[address]
+	if !ok {
+		node = &callNode{
+			routine:  p.routine(address, kind),
+			children: map[callKey]*callNode{},
+			cycles:   map[uint16]int64{},
+		}
+		p.roots[address] = node
+	}
+	p.push(node, 0)
+}
+
+func (p *Profiler) push(node *callNode, sp byte) {
+	node.routine.frame.calls++
+	p.stack = append(p.stack, stackFrame{
+		node:  node,
+		sp:    sp,
+		owner: node.routine.active == 0,
+	})
+	node.routine.active++
+}
+
+func (p *Profiler) pop() {
+	top := p.stack[len(p.stack)-1]
+	top.node.routine.active--
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+func (p *Profiler) call(callSite, address uint16, sp byte, kind string) {
+	parent := p.stack[len(p.stack)-1].node
+	key := callKey{callSite, address}
+	node, ok := parent.children[key]
+	if !ok {
+		node = &callNode{
+			parent:   parent,
+			routine:  p.routine(address, kind),
+			callSite: callSite,
+			children: map[callKey]*callNode{},
+			cycles:   map[uint16]int64{},
+		}
+		parent.children[key] = node
+	}
+	p.push(node, sp)
+}
+
+// account gives the cycles since it was last called to pc
+func (p *Profiler) account(pc uint16) {
+	delta := p.cpu.TotalCycles - p.last
+	p.last = p.cpu.TotalCycles
+	if delta == 0 {
+		return
+	}
+
+	top := p.stack[len(p.stack)-1]
+	top.node.cycles[pc] += delta
+	top.node.routine.frame.exclusive += delta
+	for _, frame := range p.stack {
+		if frame.owner {
+			frame.node.routine.frame.inclusive += delta
+		}
+	}
+	p.ByPC[pc] += delta
+	p.frameCycles += delta
+}
+
+func (p *Profiler) before(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+	p.sp = c.Registers.SP
+}
+
+func (p *Profiler) after(c *cpu.Cpu, pc uint16, operation *cpu.Operation) {
+	p.account(pc)
+
+	// RTS, RTI and anything else that throws the return address away
+	for len(p.stack) > 1 && p.stack[len(p.stack)-1].sp <= c.Registers.SP {
+		p.pop()
+	}
+
+	switch operation {
+	case p.jsr:
+		p.call(pc, c.Registers.PC, p.sp, "")
+	case p.brk:
+		p.call(pc, c.Registers.PC, p.sp, "BRK")
+	}
+}
+
+func (p *Profiler) interrupt(c *cpu.Cpu, from uint16, vector uint16) {
+	switch vector {
+	case cpu.ResetVector:
+		p.root(c.Registers.PC, "RESET")
+	case cpu.NmiVector:
+		p.call(from, c.Registers.PC, c.Registers.SP+3, "NMI")
+	default:
+		p.call(from, c.Registers.PC, c.Registers.SP+3, "IRQ")
+	}
+
+	// The interrupt sequence is the handler's
+	p.account(c.Registers.PC)
+}
+
+func (p *Profiler) name(r *routine) string {
+	if name, ok := p.Names[r.address]; ok {
+		return name
+	}
+	if r.kind != "" {
+		return fmt.Sprintf("%s $%04X", r.kind, r.address)
+	}
+	return fmt.Sprintf("$%04X", r.address)
+}
+
+func (p *Profiler) report(get func(r *routine) counters) []Routine {
+	result := []Routine{}
+	for _, r := range p.routines {
+		counts := get(r)
+		if counts == (counters{}) {
+			continue
+		}
+
+		result = append(result, Routine{
+			Address:   r.address,
+			Name:      p.name(r),
+			Calls:     counts.calls,
+			Inclusive: counts.inclusive,
+			Exclusive: counts.exclusive,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Inclusive != result[j].Inclusive {
+			return result[i].Inclusive > result[j].Inclusive
+		}
+		return result[i].Address < result[j].Address
+	})
+	return result
+}
+
+// EndFrame finishes the current frame and returns what ran in it, call it
+// after emulator.RunFrame
+func (p *Profiler) EndFrame() Frame {
+	result := Frame{
+		Number: p.frames,
+		Cycles: p.frameCycles,
+		Routines: p.report(func(r *routine) counters {
+			return r.frame
+		}),
+	}
+
+	for _, r := range p.routines {
+		r.total.add(r.frame)
+		r.frame = counters{}
+	}
+	p.frames++
+	p.totalCycles += p.frameCycles
+	p.frameCycles = 0
+
+	return result
+}
+
+// Frames is how many frames have been ended
+func (p *Profiler) Frames() int {
+	return p.frames
+}
+
+// Routines is everything since the profiler was created, the current frame
+// included
+func (p *Profiler) Routines() []Routine {
+	return p.report(func(r *routine) counters {
+		result := r.total
+		result.add(r.frame)
+		return result
+	})
+}
+
+// WriteReport writes a table of the routines with their average cycles per
+// frame
+func (p *Profiler) WriteReport(w io.Writer) error {
+	frames := p.frames
+	if frames == 0 {
+		frames = 1
+	}
+	cycles := p.totalCycles + p.frameCycles
+	if cycles == 0 {
+		cycles = 1
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "calls/frame\tinclusive/frame\t\texclusive/frame\t\t\troutine\n")
+	for _, r := range p.Routines() {
+		fmt.Fprintf(tw, "%.2f\t%d\t%.2f%%\t%d\t%.2f%%\t\t%s\n",
+			float64(r.Calls)/float64(frames),
+			r.Inclusive/int64(frames),
+			float64(r.Inclusive)*100/float64(cycles),
+			r.Exclusive/int64(frames),
+			float64(r.Exclusive)*100/float64(cycles),
+			r.Name,
+		)
+	}
+
+	return tw.Flush()
+}
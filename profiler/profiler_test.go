@@ -0,0 +1,138 @@
+package profiler_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/sardap/gos/cpu"
+	"github.com/sardap/gos/profiler"
+	"github.com/stretchr/testify/assert"
+)
+
+func createProfiled() (*cpu.Cpu, *profiler.Profiler) {
+	ram := &cpu.Ram{}
+	// JSR $0300; JSR $0310; JMP $0206
+	ram.WriteBytes(0x0200, []byte{0x20, 0x00, 0x03, 0x20, 0x10, 0x03, 0x4C, 0x06, 0x02})
+	// JSR $0310; RTS
+	ram.WriteBytes(0x0300, []byte{0x20, 0x10, 0x03, 0x60})
+	// NOP; RTS
+	ram.WriteBytes(0x0310, []byte{0xEA, 0x60})
+	// RTI
+	ram.WriteBytes(0x0400, []byte{0x40})
+	ram.WriteBytes(cpu.NmiVector, []byte{0x00, 0x04})
+
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	c.Registers.SP = 0xFD
+
+	p := profiler.Create()
+	p.Attach(c)
+
+	return c, p
+}
+
+func excute(t *testing.T, c *cpu.Cpu, count int) {
+	for i := 0; i < count; i++ {
+		assert.NoError(t, c.Excute())
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	t.Parallel()
+
+	c, p := createProfiled()
+	p.SetSymbols(map[string]uint16{"main": 0x0200, "outer": 0x0300, "inner": 0x0310, "alias": 0x0310})
+
+	excute(t, c, 8)
+	frame := p.EndFrame()
+	assert.Equal(t, profiler.Frame{
+		Number: 0,
+		Cycles: 40,
+		Routines: []profiler.Routine{
+			{Address: 0x0200, Name: "main", Calls: 1, Inclusive: 40, Exclusive: 12},
+			{Address: 0x0300, Name: "outer", Calls: 1, Inclusive: 20, Exclusive: 12},
+			{Address: 0x0310, Name: "alias", Calls: 2, Inclusive: 16, Exclusive: 16},
+		},
+	}, frame)
+	assert.Equal(t, int64(4), p.ByPC[0x0310])
+	assert.Equal(t, int64(12), p.ByPC[0x0311])
+
+	// NMI, RTI then JMP
+	c.SetNmi(true)
+	excute(t, c, 3)
+	frame = p.EndFrame()
+	assert.Equal(t, profiler.Frame{
+		Number: 1,
+		Cycles: 16,
+		Routines: []profiler.Routine{
+			{Address: 0x0200, Name: "main", Inclusive: 16, Exclusive: 3},
+			{Address: 0x0400, Name: "NMI $0400", Calls: 1, Inclusive: 13, Exclusive: 13},
+		},
+	}, frame)
+
+	assert.Equal(t, 2, p.Frames())
+	assert.Equal(t, profiler.Routine{Address: 0x0200, Name: "main", Calls: 1, Inclusive: 56, Exclusive: 15}, p.Routines()[0])
+}
+
+func TestDiscardedReturn(t *testing.T) {
+	t.Parallel()
+
+	ram := &cpu.Ram{}
+	// JSR $0300; NOP
+	ram.WriteBytes(0x0200, []byte{0x20, 0x00, 0x03, 0xEA})
+	// PLA; PLA; JMP $0203
+	ram.WriteBytes(0x0300, []byte{0x68, 0x68, 0x4C, 0x03, 0x02})
+
+	c := cpu.CreateCpu(ram)
+	c.Registers.PC = 0x0200
+	c.Registers.SP = 0xFD
+	p := profiler.Create()
+	p.Attach(c)
+
+	excute(t, c, 5)
+	routines := p.Routines()
+	assert.Equal(t, "$0200", routines[0].Name)
+	// Popping the return address left the routine, the JMP was main's
+	assert.Equal(t, int64(6+3+2), routines[0].Exclusive)
+	assert.Equal(t, int64(8), routines[1].Exclusive)
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Parallel()
+
+	c, p := createProfiled()
+	excute(t, c, 8)
+	p.EndFrame()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, p.WriteReport(buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "inclusive/frame")
+	assert.Regexp(t, `^ *1\.00 +40 +100\.00% +12 +30\.00% +\$0200$`, lines[1])
+	assert.Regexp(t, `^ *2\.00 +16 +40\.00% +16 +40\.00% +\$0310$`, lines[3])
+}
+
+func TestWritePprof(t *testing.T) {
+	t.Parallel()
+
+	c, p := createProfiled()
+	p.Names[0x0310] = "inner"
+	excute(t, c, 8)
+	p.Detach()
+	excute(t, c, 1)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, p.WritePprof(buf))
+
+	r, err := gzip.NewReader(buf)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "cycles")
+	assert.Contains(t, string(data), "inner")
+	assert.Contains(t, string(data), "$0300")
+}
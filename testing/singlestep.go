@@ -0,0 +1,246 @@
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sardap/gos/cpu"
+)
+
+// The per opcode vectors from https://github.com/SingleStepTests/65x02 and
+// https://github.com/SingleStepTests/ProcessorTests. Each file is named after
+// the opcode in hex and holds a JSON array of single instruction tests.
+
+var (
+	ErrInvalidVector = fmt.Errorf("invalid test vector")
+)
+
+type SingleStepState struct {
+	PC uint16 `json:"pc"`
+	S  byte   `json:"s"`
+	A  byte   `json:"a"`
+	X  byte   `json:"x"`
+	Y  byte   `json:"y"`
+	P  byte   `json:"p"`
+	// Ram is address and value pairs, everything else is zero
+	Ram [][2]int `json:"ram"`
+}
+
+type SingleStepCycle struct {
+	Address uint16
+	Value   byte
+	// HasValue is false for the few cycles where the bus value isn't known
+	HasValue bool
+	Write    bool
+}
+
+func (c SingleStepCycle) String() string {
+	kind := "read "
+	if c.Write {
+		kind = "write"
+	}
+	if !c.HasValue {
+		return fmt.Sprintf("%s $%04X = ??", kind, c.Address)
+	}
+	return fmt.Sprintf("%s $%04X = $%02X", kind, c.Address, c.Value)
+}
+
+// UnmarshalJSON reads the [address, value, "read"|"write"] form
+func (c *SingleStepCycle) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return errors.Wrapf(ErrInvalidVector, "cycle %s", string(data))
+	}
+
+	address, ok := raw[0].(float64)
+	if !ok {
+		return errors.Wrapf(ErrInvalidVector, "cycle address %s", string(data))
+	}
+	c.Address = uint16(address)
+
+	if value, ok := raw[1].(float64); ok {
+		c.Value = byte(value)
+		c.HasValue = true
+	}
+
+	switch raw[2] {
+	case "read":
+		c.Write = false
+	case "write":
+		c.Write = true
+	default:
+		return errors.Wrapf(ErrInvalidVector, "cycle kind %s", string(data))
+	}
+
+	return nil
+}
+
+type SingleStepTest struct {
+	Name    string            `json:"name"`
+	Initial SingleStepState   `json:"initial"`
+	Final   SingleStepState   `json:"final"`
+	Cycles  []SingleStepCycle `json:"cycles"`
+}
+
+func LoadSingleStepTests(path string) ([]SingleStepTest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []SingleStepTest
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(ErrInvalidVector, "%s: %v", path, err)
+	}
+
+	return result, nil
+}
+
+// recordingRam logs every access the CPU makes
+type recordingRam struct {
+	cpu.Ram
+	cycles []SingleStepCycle
+}
+
+func (r *recordingRam) ReadByteAt(address uint16) byte {
+	value := r.Ram.ReadByteAt(address)
+	r.cycles = append(r.cycles, SingleStepCycle{Address: address, Value: value, HasValue: true})
+	return value
+}
+
+func (r *recordingRam) WriteByteAt(address uint16, value byte) {
+	r.cycles = append(r.cycles, SingleStepCycle{Address: address, Value: value, HasValue: true, Write: true})
+	r.Ram.WriteByteAt(address, value)
+}
+
+func (t *SingleStepTest) run(variant cpu.Variant, accurate bool) (*cpu.Cpu, *recordingRam, error) {
+	ram := &recordingRam{}
+	for _, pair := range t.Initial.Ram {
+		ram.Ram.WriteByteAt(uint16(pair[0]), byte(pair[1]))
+	}
+
+	c := cpu.CreateCpuVariant(ram, variant)
+	c.CycleAccurate = accurate
+	c.Registers.PC = t.Initial.PC
+	c.Registers.SP = t.Initial.S
+	c.Registers.A = t.Initial.A
+	c.Registers.X = t.Initial.X
+	c.Registers.Y = t.Initial.Y
+	c.Registers.P.Write(t.Initial.P)
+
+	err := c.Excute()
+
+	return c, ram, err
+}
+
+func (t *SingleStepTest) diffState(c *cpu.Cpu, ram *recordingRam) []string {
+	result := []string{}
+	register := func(name string, expected, got int, width int) {
+		if expected != got {
+			result = append(result, fmt.Sprintf("%s expected $%0*X got $%0*X", name, width, expected, width, got))
+		}
+	}
+
+	register("PC", int(t.Final.PC), int(c.Registers.PC), 4)
+	register("S", int(t.Final.S), int(c.Registers.SP), 2)
+	register("A", int(t.Final.A), int(c.Registers.A), 2)
+	register("X", int(t.Final.X), int(c.Registers.X), 2)
+	register("Y", int(t.Final.Y), int(c.Registers.Y), 2)
+	if t.Final.P != c.Registers.P.Read() {
+		result = append(result, fmt.Sprintf("P expected %s got %s", flagString(t.Final.P), flagString(c.Registers.P.Read())))
+	}
+
+	for _, pair := range t.Final.Ram {
+		address := uint16(pair[0])
+		register(fmt.Sprintf("$%04X", address), pair[1], int(ram.Ram.ReadByteAt(address)), 2)
+	}
+
+	return result
+}
+
+func flagString(p byte) string {
+	const flags = "NVUBDIZC"
+	result := []byte(strings.ToLower(flags))
+	for i := 0; i < 8; i++ {
+		if p&(0x80>>i) != 0 {
+			result[i] = flags[i]
+		}
+	}
+	return fmt.Sprintf("$%02X %s", p, string(result))
+}
+
+func cyclesMatch(expected, got SingleStepCycle) bool {
+	return expected.Address == got.Address &&
+		expected.Write == got.Write &&
+		(!expected.HasValue || expected.Value == got.Value)
+}
+
+// diffCycles lays the bus activity out side by side marking the cycles that
+// differ
+func (t *SingleStepTest) diffCycles(got []SingleStepCycle) []string {
+	matched := len(got) == len(t.Cycles)
+	for i := 0; matched && i < len(got); i++ {
+		matched = cyclesMatch(t.Cycles[i], got[i])
+	}
+	if matched {
+		return nil
+	}
+
+	result := []string{fmt.Sprintf("bus activity differs, expected %d cycles got %d", len(t.Cycles), len(got))}
+	count := len(t.Cycles)
+	if len(got) > count {
+		count = len(got)
+	}
+	for i := 0; i < count; i++ {
+		var expected, actual string
+		if i < len(t.Cycles) {
+			expected = t.Cycles[i].String()
+		}
+		if i < len(got) {
+			actual = got[i].String()
+		}
+
+		marker := ""
+		if i >= len(t.Cycles) || i >= len(got) || !cyclesMatch(t.Cycles[i], got[i]) {
+			marker = "<"
+		}
+		line := fmt.Sprintf("  %2d  %-17s  %-17s %s", i, expected, actual, marker)
+		result = append(result, strings.TrimRight(line, " "))
+	}
+
+	return result
+}
+
+// Diff runs the test twice, once cycle accurate to compare every bus access
+// and once in the fast mode to make sure it ends in the same state. Every
+// difference is a line in the result, it's empty when the test passed.
+func (t *SingleStepTest) Diff(variant cpu.Variant) (result []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = append(result, fmt.Sprintf("panic: %v", r))
+		}
+	}()
+
+	c, ram, err := t.run(variant, true)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	result = t.diffState(c, ram)
+	result = append(result, t.diffCycles(ram.cycles)...)
+
+	c, ram, _ = t.run(variant, false)
+	for _, line := range t.diffState(c, ram) {
+		result = append(result, "fast mode "+line)
+	}
+	if c.Cycles != len(t.Cycles) {
+		result = append(result, fmt.Sprintf("fast mode took %d cycles expected %d", c.Cycles, len(t.Cycles)))
+	}
+
+	return result
+}